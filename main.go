@@ -10,7 +10,13 @@ import (
 
 func main() {
 	fname := flag.String("f", "", "the protocol file to use")
-	mode := flag.String("m", "go", "the mode to use, modes: \"go\": golang")
+	mode := flag.String("m", "go", "the mode to use, modes: \"go\": golang, \"c\": c single file, \"python\": python3, \"ts\": typescript, \"rust\": rust, \"java\": java")
+	outFile := flag.String("o", "", "the file to write generated code, default stdout")
+	outDir := flag.String("out-dir", "", "the directory to write generated code, file is named after the protocol file if -o not specified; go mode: the runtime shared by the package is written to <pkg>_runtime.go")
+	pkg := flag.String("pkg", "", "go mode: package name of the generated code, default derived from mspace")
+	goAppend := flag.Bool("go-append", false, "go mode: generate reflection free AppendX/UnmarshalX on []byte instead of io.Writer/io.Reader codec")
+	goSlice := flag.Bool("go-slice", false, "go mode: arrays limited by a field are slices, the field is set from the slice length on encode")
+	rustFixed := flag.Bool("rust-fixed", false, "rust mode: generate fixed arrays sized by the limit max instead of Vec")
 
 	flag.Parse()
 
@@ -41,10 +47,31 @@ func main() {
 
 	interp := protoc.NewInterpreter()
 	interp.SrcFile = *fname
+	interp.Package = *pkg
+	interp.GoAppend = *goAppend
+	interp.GoSlice = *goSlice
+	interp.OutFile = *outFile
+	interp.OutDir = *outDir
 	switch *mode {
 	case "go":
 		interp.Mode = protoc.INTERP_MODE_GO
 
+	case "c":
+		interp.Mode = protoc.INTERP_MODE_C
+
+	case "python":
+		interp.Mode = protoc.INTERP_MODE_PYTHON
+
+	case "ts":
+		interp.Mode = protoc.INTERP_MODE_TS
+
+	case "rust":
+		interp.Mode = protoc.INTERP_MODE_RUST
+		interp.RustFixedArray = *rustFixed
+
+	case "java":
+		interp.Mode = protoc.INTERP_MODE_JAVA
+
 	default:
 		os.Stderr.WriteString(fmt.Sprintf("unknown mode: %s\n", *mode))
 		os.Exit(-1)
@@ -13,10 +13,12 @@ const (
 	AST_Program = iota + 1
 	AST_INT_CONST
 	AST_STRING_CONST
+	AST_FLOAT_CONST
 	AST_VarDecl
 	AST_SrcComment
 	AST_ConstDef
 	AST_IdDef
+	AST_FlagsDef
 	AST_BindDef
 	AST_FuncDecl
 	AST_BuiltinFunc
@@ -39,6 +41,7 @@ const (
 	AST_TP_TypeRef
 	AST_TP_UndefType
 	AST_TP_ExistIf
+	AST_TP_Union
 )
 
 var verbPanic bool
@@ -78,6 +81,7 @@ type AstBase struct {
 type AstProgram struct {
 	AstBase
 	mspace    string
+	endian    string
 	decl_list []AstNode
 	tpMap     map[string]AstType
 }
@@ -124,11 +128,12 @@ type idItem struct {
 
 type AstIdGroupDef struct {
 	AstBase
-	isMsgId bool
-	name    string
-	items   []*idItem
-	notes   []*AstSrcComment
-	line    int
+	isMsgId  bool
+	name     string
+	items    []*idItem
+	notes    []*AstSrcComment
+	line     int
+	enumBits int //storage bits of the fields typed by the group, 0 if no field uses it
 }
 
 func (ast *AstIdGroupDef) astType() int {
@@ -143,6 +148,28 @@ func (ast *AstIdGroupDef) desc() string {
 	return fmt.Sprintf("idgroup, len: %d", len(ast.items))
 }
 
+//AstFlagsDef define the bit positions of a flags int type, fields of the type hold a set of the flags
+type AstFlagsDef struct {
+	AstBase
+	name  string
+	base  *AstPrimType
+	items []*idItem
+	notes []*AstSrcComment
+	line  int
+}
+
+func (ast *AstFlagsDef) astType() int {
+	return AST_FlagsDef
+}
+
+func (ast *AstFlagsDef) String() string {
+	return fmt.Sprintf("AstFlagsDef")
+}
+
+func (ast *AstFlagsDef) desc() string {
+	return fmt.Sprintf("flags %s, len: %d", ast.name, len(ast.items))
+}
+
 type AstSrcComment struct {
 	AstBase
 	value string
@@ -173,6 +200,18 @@ type AstVarDecl struct {
 	existIf         AstNode
 	existCondFollow bool
 	dlim            bool
+	order           string         //byte order declared on field: le, be or empty for the mspace default
+	le              bool           //resolved in semantic analysis: multi-byte int field in little endian
+	enum            *AstVarNameRef //id group of the field values, declared by 'of'
+	enumGroup       *AstIdGroupDef //resolved in semantic analysis from enum
+	strict          bool           //flags field rejects undefined bits on decode
+	optional        bool           //field encoded only when its bit in the presence bitmap is set
+	sized           *AstVarNameRef //field holding the byte length of a nested message, declared by 'sized by'
+	untilEnd        bool           //last array field takes the elements up to the end of the message
+	cstring         bool           //string field ends with a NUL, its max length is declared by max
+	fixed           *AstVarNameRef //byte size of a fixed size string field, padded by zeros or spaces
+	padSpace        bool           //fixed size string field padded by spaces
+	utf8            bool           //string field checked to be valid UTF-8 on decode
 	comment         *AstSrcComment
 	line            int
 }
@@ -281,6 +320,24 @@ func (ast *AstNoopStat) desc() string {
 	return fmt.Sprintf("not impl")
 }
 
+type AstFloatConst struct {
+	AstBase
+	value float64
+	line  int
+}
+
+func (ast *AstFloatConst) astType() int {
+	return AST_FLOAT_CONST
+}
+
+func (ast *AstFloatConst) String() string {
+	return fmt.Sprintf("AstFloatConst")
+}
+
+func (ast *AstFloatConst) desc() string {
+	return fmt.Sprintf("float const: %v", ast.value)
+}
+
 type AstIntConst struct {
 	AstBase
 	value int
@@ -439,7 +496,8 @@ type AstType interface {
 }
 
 type AstPrimType struct {
-	name string
+	name  string
+	flags *AstFlagsDef //int type defined by defflags
 }
 
 func (ast *AstPrimType) astType() int {
@@ -467,13 +525,28 @@ func (ast *AstPrimType) signature() string {
 		symTypeU32,
 		symTypeU64,
 		symTypeV32,
-		symTypeV64:
+		symTypeV64,
+		symTypeI8,
+		symTypeI16,
+		symTypeI32,
+		symTypeI64,
+		symTypeS32,
+		symTypeS64:
 		return "I"
 
+	case symTypeFloat,
+		symTypeF32,
+		symTypeF64:
+		return "F"
+
 	case symTypeString:
 		return "S"
 
 	default:
+		if _, ok := symTypeBits[ast.name]; ok {
+			return "I"
+		}
+
 		doPanic("unknown primitive type: " + ast.name)
 	}
 	return "-"
@@ -507,12 +580,49 @@ func (ast *AstArrayType) desc() string {
 	return "[]" + ast.elemType.desc()
 }
 
+//unionCase is one case of a union, label is an int const or the name of a const or id
+type unionCase struct {
+	label AstNode
+	value int //resolved in semantic analysis from label
+	type_ AstType
+	line  int
+}
+
+//AstUnionType is a field type chosen by the value of a tag field above it
+type AstUnionType struct {
+	tag   *AstVarNameRef
+	cases []*unionCase
+	def   AstType //type of the tags not in cases, nil to reject them
+	line  int
+}
+
+func (ast *AstUnionType) astType() int {
+	return AST_TP_Union
+}
+
+func (ast *AstUnionType) String() string {
+	return fmt.Sprintf("AstUnionType: " + ast.tag.name)
+}
+
+func (ast *AstUnionType) signature() string {
+	return "u" + ast.tag.name + ";"
+}
+
+func (ast *AstUnionType) desc() string {
+	return fmt.Sprintf("switch %s, cases: %d", ast.tag.name, len(ast.cases))
+}
+
 type AstStructType struct {
 	AstBase
 	name   string
 	fields []*AstVarDecl
 	notes  []*AstSrcComment
 	line   int
+	mend   bool //decode fails if bytes remain after the message
+	//resolved in semantic analysis: optional fields in the order of their presence bits,
+	//and the bitmap put before the fields, u8/u16/v64 by the number of optional fields
+	optionals []*AstVarDecl
+	presence  *AstVarDecl
 }
 
 func (ast *AstStructType) astType() int {
@@ -579,11 +689,35 @@ func intConstVal(str string) int {
 	return int(val)
 }
 
+func floatConstVal(str string) float64 {
+	val, _ := strconv.ParseFloat(str, 64)
+	return val
+}
+
+//floatLiteral format a float const, always with a '.' or exponent so it is not taken as an int
+func floatLiteral(val float64) string {
+	str := strconv.FormatFloat(val, 'g', -1, 64)
+	if !strings.ContainsAny(str, ".e") {
+		str += ".0"
+	}
+	return str
+}
+
 func currentTimeString() string {
 	t := time.Now()
 	return t.Format("2006-01-02 15:04:05")
 }
 
+func getMsgField(node *AstStructType, name string) *AstVarDecl {
+	for _, f := range node.fields {
+		if f.name == name {
+			return f
+		}
+	}
+
+	return nil
+}
+
 func getLimitFieldMax(node *AstStructType, name string) *AstVarNameRef {
 	for _, f := range node.fields {
 		if f.name == name {
@@ -0,0 +1,1063 @@
+package protoc
+
+import (
+	"fmt"
+	"strings"
+)
+
+//byte buffer helpers shared by the generated encode/decode functions, integers are in network order,
+//the *le variants are for little endian fields, floats are put by their IEEE-754 bits
+var byteBufCode_C = []string{
+	"typedef struct byte_buf {",
+	"    uint8_t *data;",
+	"    uint32_t size; //capacity when encode, data length when decode",
+	"    uint32_t pos;",
+	"} byte_buf;",
+	"",
+	"//decode of a mend message returns BYTE_BUF_EXTRA when buf->size - buf->pos bytes remain after it, -1 for other errors",
+	"#define BYTE_BUF_EXTRA (-2)",
+	"",
+	"static inline void byte_buf_init(byte_buf *buf, uint8_t *data, uint32_t size) {",
+	"    buf->data = data;",
+	"    buf->size = size;",
+	"    buf->pos = 0;",
+	"}",
+	"",
+	"static inline int byte_buf_put_u8(byte_buf *buf, uint8_t v) {",
+	"    if (buf->pos + 1 > buf->size) return -1;",
+	"    buf->data[buf->pos++] = v;",
+	"    return 0;",
+	"}",
+	"",
+	"static inline int byte_buf_put_u16(byte_buf *buf, uint16_t v) {",
+	"    if (buf->pos + 2 > buf->size) return -1;",
+	"    buf->data[buf->pos++] = (uint8_t)(v >> 8);",
+	"    buf->data[buf->pos++] = (uint8_t)v;",
+	"    return 0;",
+	"}",
+	"",
+	"static inline int byte_buf_put_u32(byte_buf *buf, uint32_t v) {",
+	"    if (buf->pos + 4 > buf->size) return -1;",
+	"    buf->data[buf->pos++] = (uint8_t)(v >> 24);",
+	"    buf->data[buf->pos++] = (uint8_t)(v >> 16);",
+	"    buf->data[buf->pos++] = (uint8_t)(v >> 8);",
+	"    buf->data[buf->pos++] = (uint8_t)v;",
+	"    return 0;",
+	"}",
+	"",
+	"static inline int byte_buf_put_u64(byte_buf *buf, uint64_t v) {",
+	"    if (byte_buf_put_u32(buf, (uint32_t)(v >> 32)) < 0) return -1;",
+	"    return byte_buf_put_u32(buf, (uint32_t)v);",
+	"}",
+	"",
+	"static inline int byte_buf_put_u16le(byte_buf *buf, uint16_t v) {",
+	"    if (buf->pos + 2 > buf->size) return -1;",
+	"    buf->data[buf->pos++] = (uint8_t)v;",
+	"    buf->data[buf->pos++] = (uint8_t)(v >> 8);",
+	"    return 0;",
+	"}",
+	"",
+	"static inline int byte_buf_put_u32le(byte_buf *buf, uint32_t v) {",
+	"    if (buf->pos + 4 > buf->size) return -1;",
+	"    buf->data[buf->pos++] = (uint8_t)v;",
+	"    buf->data[buf->pos++] = (uint8_t)(v >> 8);",
+	"    buf->data[buf->pos++] = (uint8_t)(v >> 16);",
+	"    buf->data[buf->pos++] = (uint8_t)(v >> 24);",
+	"    return 0;",
+	"}",
+	"",
+	"static inline int byte_buf_put_u64le(byte_buf *buf, uint64_t v) {",
+	"    if (byte_buf_put_u32le(buf, (uint32_t)v) < 0) return -1;",
+	"    return byte_buf_put_u32le(buf, (uint32_t)(v >> 32));",
+	"}",
+	"",
+	"static inline int byte_buf_put_f32(byte_buf *buf, float v) {",
+	"    uint32_t u;",
+	"    memcpy(&u, &v, sizeof(u));",
+	"    return byte_buf_put_u32(buf, u);",
+	"}",
+	"",
+	"static inline int byte_buf_put_f64(byte_buf *buf, double v) {",
+	"    uint64_t u;",
+	"    memcpy(&u, &v, sizeof(u));",
+	"    return byte_buf_put_u64(buf, u);",
+	"}",
+	"",
+	"static inline int byte_buf_put_f32le(byte_buf *buf, float v) {",
+	"    uint32_t u;",
+	"    memcpy(&u, &v, sizeof(u));",
+	"    return byte_buf_put_u32le(buf, u);",
+	"}",
+	"",
+	"static inline int byte_buf_put_f64le(byte_buf *buf, double v) {",
+	"    uint64_t u;",
+	"    memcpy(&u, &v, sizeof(u));",
+	"    return byte_buf_put_u64le(buf, u);",
+	"}",
+	"",
+	"static inline int byte_buf_put_bytes(byte_buf *buf, const uint8_t *src, uint32_t n) {",
+	"    if (buf->pos + n > buf->size) return -1;",
+	"    memcpy(buf->data + buf->pos, src, n);",
+	"    buf->pos += n;",
+	"    return 0;",
+	"}",
+	"",
+	"static inline int byte_buf_get_u8(byte_buf *buf, uint8_t *v) {",
+	"    if (buf->pos + 1 > buf->size) return -1;",
+	"    *v = buf->data[buf->pos++];",
+	"    return 0;",
+	"}",
+	"",
+	"static inline int byte_buf_get_u16(byte_buf *buf, uint16_t *v) {",
+	"    if (buf->pos + 2 > buf->size) return -1;",
+	"    *v = (uint16_t)((uint16_t)buf->data[buf->pos] << 8 | buf->data[buf->pos + 1]);",
+	"    buf->pos += 2;",
+	"    return 0;",
+	"}",
+	"",
+	"static inline int byte_buf_get_u32(byte_buf *buf, uint32_t *v) {",
+	"    if (buf->pos + 4 > buf->size) return -1;",
+	"    *v = (uint32_t)buf->data[buf->pos] << 24 | (uint32_t)buf->data[buf->pos + 1] << 16 |",
+	"        (uint32_t)buf->data[buf->pos + 2] << 8 | buf->data[buf->pos + 3];",
+	"    buf->pos += 4;",
+	"    return 0;",
+	"}",
+	"",
+	"static inline int byte_buf_get_u64(byte_buf *buf, uint64_t *v) {",
+	"    uint32_t hi, lo;",
+	"    if (byte_buf_get_u32(buf, &hi) < 0) return -1;",
+	"    if (byte_buf_get_u32(buf, &lo) < 0) return -1;",
+	"    *v = (uint64_t)hi << 32 | lo;",
+	"    return 0;",
+	"}",
+	"",
+	"static inline int byte_buf_get_u16le(byte_buf *buf, uint16_t *v) {",
+	"    if (buf->pos + 2 > buf->size) return -1;",
+	"    *v = (uint16_t)((uint16_t)buf->data[buf->pos + 1] << 8 | buf->data[buf->pos]);",
+	"    buf->pos += 2;",
+	"    return 0;",
+	"}",
+	"",
+	"static inline int byte_buf_get_u32le(byte_buf *buf, uint32_t *v) {",
+	"    if (buf->pos + 4 > buf->size) return -1;",
+	"    *v = (uint32_t)buf->data[buf->pos + 3] << 24 | (uint32_t)buf->data[buf->pos + 2] << 16 |",
+	"        (uint32_t)buf->data[buf->pos + 1] << 8 | buf->data[buf->pos];",
+	"    buf->pos += 4;",
+	"    return 0;",
+	"}",
+	"",
+	"static inline int byte_buf_get_u64le(byte_buf *buf, uint64_t *v) {",
+	"    uint32_t hi, lo;",
+	"    if (byte_buf_get_u32le(buf, &lo) < 0) return -1;",
+	"    if (byte_buf_get_u32le(buf, &hi) < 0) return -1;",
+	"    *v = (uint64_t)hi << 32 | lo;",
+	"    return 0;",
+	"}",
+	"",
+	"static inline int byte_buf_get_f32(byte_buf *buf, float *v) {",
+	"    uint32_t u;",
+	"    if (byte_buf_get_u32(buf, &u) < 0) return -1;",
+	"    memcpy(v, &u, sizeof(u));",
+	"    return 0;",
+	"}",
+	"",
+	"static inline int byte_buf_get_f64(byte_buf *buf, double *v) {",
+	"    uint64_t u;",
+	"    if (byte_buf_get_u64(buf, &u) < 0) return -1;",
+	"    memcpy(v, &u, sizeof(u));",
+	"    return 0;",
+	"}",
+	"",
+	"static inline int byte_buf_get_f32le(byte_buf *buf, float *v) {",
+	"    uint32_t u;",
+	"    if (byte_buf_get_u32le(buf, &u) < 0) return -1;",
+	"    memcpy(v, &u, sizeof(u));",
+	"    return 0;",
+	"}",
+	"",
+	"static inline int byte_buf_get_f64le(byte_buf *buf, double *v) {",
+	"    uint64_t u;",
+	"    if (byte_buf_get_u64le(buf, &u) < 0) return -1;",
+	"    memcpy(v, &u, sizeof(u));",
+	"    return 0;",
+	"}",
+	"",
+	"static inline int byte_buf_get_bytes(byte_buf *buf, uint8_t *dst, uint32_t n) {",
+	"    if (buf->pos + n > buf->size) return -1;",
+	"    memcpy(dst, buf->data + buf->pos, n);",
+	"    buf->pos += n;",
+	"    return 0;",
+	"}",
+}
+
+//string helpers, only emitted for messages with string fields, which are NUL terminated char arrays one byte over their most bytes
+var stringCode_C = []string{
+	"//byte_buf_str_len return the length of s cut to at most max bytes, never in the middle of a UTF-8 sequence",
+	"static inline uint32_t byte_buf_str_len(const char *s, uint32_t max) {",
+	"    uint32_t n = 0;",
+	"    while (n < max && s[n] != 0) n++;",
+	"    while (n > 0 && ((uint8_t)s[n] & 0xc0) == 0x80) n--;",
+	"    return n;",
+	"}",
+	"",
+	"static inline int byte_buf_put_cstring(byte_buf *buf, const char *s, uint32_t max) {",
+	"    if (byte_buf_put_bytes(buf, (const uint8_t *)s, byte_buf_str_len(s, max)) < 0) return -1;",
+	"    return byte_buf_put_u8(buf, 0);",
+	"}",
+	"",
+	"//byte_buf_put_fixed put s cut or padded to n bytes",
+	"static inline int byte_buf_put_fixed(byte_buf *buf, const char *s, uint32_t n, uint8_t pad) {",
+	"    uint32_t len = byte_buf_str_len(s, n);",
+	"    if (buf->pos + n > buf->size) return -1;",
+	"    memcpy(buf->data + buf->pos, s, len);",
+	"    memset(buf->data + buf->pos + len, pad, n - len);",
+	"    buf->pos += n;",
+	"    return 0;",
+	"}",
+	"",
+	"static inline int byte_buf_get_string(byte_buf *buf, char *s, uint32_t n) {",
+	"    if (byte_buf_get_bytes(buf, (uint8_t *)s, n) < 0) return -1;",
+	"    s[n] = 0;",
+	"    return 0;",
+	"}",
+	"",
+	"//byte_buf_get_cstring get a string ended by a NUL, fail if no NUL is within max bytes",
+	"static inline int byte_buf_get_cstring(byte_buf *buf, char *s, uint32_t max) {",
+	"    uint32_t n = 0;",
+	"    for (;;) {",
+	"        if (buf->pos + n >= buf->size) return -1;",
+	"        if (buf->data[buf->pos + n] == 0) break;",
+	"        if (n == max) return -1;",
+	"        n++;",
+	"    }",
+	"",
+	"    memcpy(s, buf->data + buf->pos, n);",
+	"    s[n] = 0;",
+	"    buf->pos += n + 1;",
+	"    return 0;",
+	"}",
+	"",
+	"//byte_buf_get_fixed get the text of a fixed size string, up to the first NUL and without the trailing padding",
+	"static inline int byte_buf_get_fixed(byte_buf *buf, char *s, uint32_t n, uint8_t pad) {",
+	"    uint32_t len = 0;",
+	"    if (buf->pos + n > buf->size) return -1;",
+	"    while (len < n && buf->data[buf->pos + len] != 0) len++;",
+	"    while (len > 0 && buf->data[buf->pos + len - 1] == pad) len--;",
+	"    memcpy(s, buf->data + buf->pos, len);",
+	"    s[len] = 0;",
+	"    buf->pos += n;",
+	"    return 0;",
+	"}",
+	"",
+	"//byte_buf_utf8 check the n bytes of s are valid UTF-8, without overlong forms, surrogates or code points over U+10FFFF",
+	"static inline int byte_buf_utf8(const char *s, uint32_t n) {",
+	"    const uint8_t *b = (const uint8_t *)s;",
+	"    uint32_t i = 0, k, len, c, min;",
+	"    while (i < n) {",
+	"        if (b[i] < 0x80) {",
+	"            i++;",
+	"            continue;",
+	"        }",
+	"",
+	"        if ((b[i] & 0xe0) == 0xc0) {",
+	"            len = 2, c = b[i] & 0x1f, min = 0x80;",
+	"        } else if ((b[i] & 0xf0) == 0xe0) {",
+	"            len = 3, c = b[i] & 0x0f, min = 0x800;",
+	"        } else if ((b[i] & 0xf8) == 0xf0) {",
+	"            len = 4, c = b[i] & 0x07, min = 0x10000;",
+	"        } else {",
+	"            return 0;",
+	"        }",
+	"",
+	"        if (n - i < len) return 0;",
+	"        for (k = 1; k < len; k++) {",
+	"            if ((b[i + k] & 0xc0) != 0x80) return 0;",
+	"            c = c << 6 | (b[i + k] & 0x3f);",
+	"        }",
+	"",
+	"        if (c < min || c > 0x10ffff || (c >= 0xd800 && c <= 0xdfff)) return 0;",
+	"        i += len;",
+	"    }",
+	"    return 1;",
+	"}",
+}
+
+//numSuffix_C return the byte_buf function suffix of an int or float field of type tp
+func numSuffix_C(f *AstVarDecl, tp AstType) string {
+	suffix := fmt.Sprintf("u%d", primBits(tp))
+	if float, bn := isFloatType(tp); float {
+		suffix = fmt.Sprintf("f%d", bn)
+	}
+
+	if f.le {
+		return suffix + "le"
+	}
+	return suffix
+}
+
+//putArg_C return the value passed to byte_buf_put_xx, signed ints are put by their two's complement bits
+func putArg_C(tp AstType, val string) string {
+	if _, bn := isIntType(tp); isSigned(tp) {
+		return fmt.Sprintf("(uint%d_t)%s", bn, val)
+	}
+	return val
+}
+
+//getArg_C return the pointer passed to byte_buf_get_xx, signed ints are got by their two's complement bits
+func getArg_C(tp AstType, ref string) string {
+	if _, bn := isIntType(tp); isSigned(tp) {
+		return fmt.Sprintf("(uint%d_t *)&%s", bn, ref)
+	}
+	return "&" + ref
+}
+
+func (interp *interpreter) visitPrelude_C(program *AstProgram) {
+	interp.addLine("#include <stddef.h>")
+	interp.addLine("#include <stdint.h>")
+	for _, decl := range program.decl_list {
+		if _, ok := decl.(*AstFlagsDef); ok {
+			//flags string helpers format with snprintf
+			interp.addLine("#include <stdio.h>")
+			break
+		}
+	}
+	interp.addLine("#include <string.h>")
+	interp.addNewLine()
+
+	if hasField(program, func(f *AstVarDecl) bool { return f.untilEnd }) {
+		interp.addLine("//until end arrays hold at most UNTIL_END_MAX elements, define it at compile time to change")
+		interp.addLine("#ifndef UNTIL_END_MAX")
+		interp.addLine("#define UNTIL_END_MAX 256")
+		interp.addLine("#endif")
+		interp.addNewLine()
+	}
+	for _, line := range byteBufCode_C {
+		interp.addLine("%s", line)
+	}
+	interp.addNewLine()
+
+	if hasField(program, func(f *AstVarDecl) bool { return isString(f.type_) }) {
+		for _, line := range stringCode_C {
+			interp.addLine("%s", line)
+		}
+		interp.addNewLine()
+	}
+
+	//forward declare all messages, so they can be referenced before defined
+	has := false
+	for _, decl := range program.decl_list {
+		if node, ok := decl.(*AstStructType); ok {
+			interp.addLine("typedef struct %s %s;", node.name, node.name)
+			has = true
+		}
+	}
+
+	if has {
+		interp.addNewLine()
+	}
+}
+
+func (interp *interpreter) visitIdGroupDefine_C(node *AstIdGroupDef) {
+	var notes []*AstSrcComment
+	if len(node.notes) > 0 {
+		notes = node.notes[:]
+	}
+
+	for idx, id := range node.items {
+		if id.base && idx > 0 {
+			interp.addNewLine()
+		}
+
+		for len(notes) > 0 && id.line > notes[0].line {
+			interp.addLine("//" + notes[0].value)
+			notes = notes[1:]
+		}
+
+		interp.addLine("#define %s %d //hex: 0x%x", id.name, id.idVal, id.idVal)
+	}
+
+	interp.idGroupName_C(node)
+}
+
+func (interp *interpreter) idGroupName_C(node *AstIdGroupDef) {
+	interp.addNewLine()
+	interp.addLine("const char *%s_name(uint16_t id) {", node.name)
+	interp.pushStackFrame()
+
+	interp.addLine("switch (id) {")
+	for idx, id := range node.items {
+		if idx != 0 {
+			interp.addNewLine()
+		}
+		interp.addLine("case %s:", id.name)
+		interp.pushStackFrame()
+		interp.addLine("return \"%s\";", id.name)
+		interp.popStackFrame()
+	}
+
+	interp.addLine("}")
+	interp.addLine("return NULL;")
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+//visitFlagsDefine_C add the flags typedef with typed masks, has/set/clear helpers and the string of the set flags
+func (interp *interpreter) visitFlagsDefine_C(node *AstFlagsDef) {
+	interp.addNewLine()
+	_, bn := isIntType(node.base)
+	interp.addLine("typedef uint%d_t %s;", storageBits(bn), node.name)
+	interp.addNewLine()
+
+	var notes []*AstSrcComment
+	if len(node.notes) > 0 {
+		notes = node.notes[:]
+	}
+
+	for _, id := range node.items {
+		for len(notes) > 0 && id.line > notes[0].line {
+			interp.addLine("//%s", notes[0].value)
+			notes = notes[1:]
+		}
+
+		interp.addLine("#define %s ((%s)0x%x)", id.name, node.name, uint64(1)<<uint(id.idVal))
+	}
+	interp.addLine("#define %s_mask ((%s)0x%x) //all defined flags", node.name, node.name, flagsMask(node))
+
+	interp.addNewLine()
+	interp.addLine("//%s_has check if all flags of f are set", node.name)
+	interp.addLine("static inline int %s_has(%s v, %s f) { return (v & f) == f; }", node.name, node.name, node.name)
+	interp.addNewLine()
+	interp.addLine("static inline void %s_set(%s *v, %s f) { *v |= f; }", node.name, node.name, node.name)
+	interp.addNewLine()
+	interp.addLine("static inline void %s_clear(%s *v, %s f) { *v &= (%s)~f; }", node.name, node.name, node.name, node.name)
+
+	interp.addNewLine()
+	interp.addLine("//%s_string list the set flags joined by '|' into s of n > 0 bytes, undefined bits are in hex, truncated if s is short", node.name)
+	interp.addLine("const char *%s_string(%s v, char *s, size_t n) {", node.name, node.name)
+	interp.pushStackFrame()
+	interp.addLine("static const struct { %s f; const char *name; } flags[] = {", node.name)
+	interp.pushStackFrame()
+	for _, id := range node.items {
+		interp.addLine("{%s, \"%s\"},", id.name, id.name)
+	}
+	interp.popStackFrame()
+	interp.addLine("};")
+	interp.addLine("%s rest = v & (%s)~%s_mask;", node.name, node.name, node.name)
+	interp.addLine("size_t len = 0;")
+	interp.addLine("size_t i;")
+	interp.addNewLine()
+	interp.addLine("s[0] = '\\0';")
+	interp.addLine("for (i = 0; i < sizeof(flags) / sizeof(flags[0]) && len < n; i++) {")
+	interp.pushStackFrame()
+	interp.addLine("if (v & flags[i].f) len += (size_t)snprintf(s + len, n - len, \"%%s%%s\", len ? \"|\" : \"\", flags[i].name);")
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.addLine("if (rest && len < n) snprintf(s + len, n - len, \"%%s0x%%llx\", len ? \"|\" : \"\", (unsigned long long)rest);")
+	interp.addLine("else if (len == 0) snprintf(s, n, \"0\");")
+	interp.addLine("return s;")
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+func (interp *interpreter) visitConstDef_C(node *AstConstDef) {
+	tp := interp.visitAst(node.val)
+	switch val := tp.(type) {
+	case int:
+		if val < 0 {
+			//keep negative macros safe in expressions like 'x-Neg'
+			interp.addLine("#define %s (%d) //%s", node.name, val,
+				interp.intConstComment_go(val, node.val))
+		} else {
+			interp.addLine("#define %s %d //%s", node.name, val,
+				interp.intConstComment_go(val, node.val))
+		}
+
+	case float64:
+		if val < 0 {
+			interp.addLine("#define %s (%s)", node.name, floatLiteral(val))
+		} else {
+			interp.addLine("#define %s %s", node.name, floatLiteral(val))
+		}
+
+	case string:
+		interp.addLine("#define %s \"%s\"", node.name, val)
+
+	default:
+		doPanic("unknown val type: %s:%T", val, val)
+	}
+}
+
+func typeName4C(tp AstType) string {
+	switch ft := tp.(type) {
+	case *AstPrimType:
+		switch ft.name {
+		case symTypeU1, symTypeU2, symTypeU3,
+			symTypeU4, symTypeU5, symTypeU6, symTypeU7, symTypeU8, symTypeChar:
+			return "uint8_t"
+
+		case symTypeU16:
+			return "uint16_t"
+
+		case symTypeU32:
+			return "uint32_t"
+
+		case symTypeU64:
+			return "uint64_t"
+
+		case symTypeI8, symTypeI16, symTypeI32, symTypeI64:
+			_, bn := isIntType(ft)
+			return fmt.Sprintf("int%d_t", bn)
+
+		case symTypeF32:
+			return "float"
+
+		case symTypeF64:
+			return "double"
+		}
+
+		if bn, ok := symTypeBits[ft.name]; ok {
+			return fmt.Sprintf("uint%d_t", storageBits(bn))
+		}
+
+	case *AstStructType:
+		return ft.name
+
+	case *AstUndefType:
+		return ft.name
+	}
+
+	doPanic("unsupported type in c: %s", tp)
+	return ""
+}
+
+func visitVarRef_C(ref *AstVarNameRef) string {
+	if ref.this {
+		return fmt.Sprintf("m->%s", ref.name)
+	}
+
+	return ref.name
+}
+
+func (interp *interpreter) wrapExist_C(f *AstVarDecl, op func()) {
+	if f.existIf != nil {
+		//c shares the same operators with golang
+		interp.addLine("if (%s) {", interp.traveseCond(true, f.existIf, visitVarRef_C, visitBinOP_Go))
+		interp.pushStackFrame()
+	}
+
+	op()
+
+	if f.existIf != nil {
+		interp.popStackFrame()
+		interp.addLine("}")
+	}
+}
+
+//strictCheck_C return the check rejecting a decoded strict flags field holding undefined bits
+func strictCheck_C(f *AstVarDecl) string {
+	name := flagsType(f.type_).name
+	return fmt.Sprintf("if (m->%s & (%s)~%s_mask) return -1;", f.name, name, name)
+}
+
+//arrayLimit_C return the element count expression of an array field
+func arrayLimit_C(node *AstStructType, f *AstVarDecl) string {
+	if f.untilEnd {
+		return fmt.Sprintf("m->%s_count", f.name)
+	}
+
+	for _, lf := range node.fields {
+		if lf.name == f.limit.name && lf.max == nil {
+			doPanic("array \"%s\" limited by field \"%s\" which has no max, line: %d", f.name, lf.name, f.line)
+		}
+	}
+
+	return arrayLimitRef(node, f, "m->")
+}
+
+//arrayMax_C return the capacity of an array field
+func arrayMax_C(node *AstStructType, f *AstVarDecl) string {
+	if f.untilEnd {
+		return "UNTIL_END_MAX"
+	}
+
+	if lm := getLimitFieldMax(node, f.limit.name); lm != nil {
+		return lm.name
+	}
+
+	return f.limit.name
+}
+
+//stringMax_C return the most bytes of a string field, its char array holds one more for the NUL
+func stringMax_C(node *AstStructType, f *AstVarDecl) string {
+	if f.cstring {
+		return f.max.name
+	} else if f.fixed != nil {
+		return f.fixed.name
+	} else if lm := getLimitFieldMax(node, f.limit.name); lm != nil {
+		return lm.name
+	}
+
+	doPanic("string \"%s\" limited by field \"%s\" which has no max, line: %d", f.name, f.limit.name, f.line)
+	return ""
+}
+
+//stringPad_C return the padding byte of a fixed size string field
+func stringPad_C(f *AstVarDecl) string {
+	if f.padSpace {
+		return "' '"
+	}
+	return "0"
+}
+
+//encodeString_C put a string field, the limit field of a limited string is already set from it
+func (interp *interpreter) encodeString_C(f *AstVarDecl) {
+	if f.cstring {
+		interp.addLine("if (byte_buf_put_cstring(buf, m->%s, %s) < 0) return -1;", f.name, f.max.name)
+	} else if f.fixed != nil {
+		interp.addLine("if (byte_buf_put_fixed(buf, m->%s, %s, %s) < 0) return -1;", f.name, f.fixed.name, stringPad_C(f))
+	} else {
+		interp.addLine("if (byte_buf_put_bytes(buf, (const uint8_t *)m->%s, m->%s) < 0) return -1;", f.name, f.limit.name)
+	}
+}
+
+//decodeString_C get a string field by its limit field, up to a NUL or of the fixed size, then check UTF-8 if required
+func (interp *interpreter) decodeString_C(f *AstVarDecl) {
+	size := fmt.Sprintf("(uint32_t)strlen(m->%s)", f.name)
+	if f.cstring {
+		interp.addLine("if (byte_buf_get_cstring(buf, m->%s, %s) < 0) return -1;", f.name, f.max.name)
+	} else if f.fixed != nil {
+		interp.addLine("if (byte_buf_get_fixed(buf, m->%s, %s, %s) < 0) return -1;", f.name, f.fixed.name, stringPad_C(f))
+	} else {
+		size = "m->" + f.limit.name
+		interp.addLine("if (byte_buf_get_string(buf, m->%s, %s) < 0) return -1;", f.name, size)
+	}
+
+	if f.utf8 {
+		interp.addLine("if (!byte_buf_utf8(m->%s, %s)) return -1;", f.name, size)
+	}
+}
+
+func (interp *interpreter) msgLocals_C(node *AstStructType, units []*fieldUnit) {
+	declared := map[int]bool{}
+	for _, u := range units {
+		if u.bits > 0 && !declared[u.bits] {
+			declared[u.bits] = true
+			interp.addLine("%s %s;", typeName4C(u.wordType()), bitWord_Go(u.bits))
+		}
+	}
+
+	for _, f := range node.fields {
+		if ft, ok := f.type_.(*AstArrayType); ok && !isByteArray(ft) {
+			interp.addLine("uint32_t i;")
+			break
+		}
+	}
+}
+
+func (interp *interpreter) visitMsgEncode_C(node *AstStructType) {
+	interp.addLine("int encode_%s(byte_buf *buf, %s *m) {", node.name, node.name)
+	interp.pushStackFrame()
+
+	units := msgFieldUnits(node)
+	interp.msgLocals_C(node, units)
+
+	//limit fields of strings are set from the strings cut on a rune boundary
+	for _, f := range node.fields {
+		if isString(f.type_) && f.limit != nil {
+			lf := getMsgField(node, f.limit.name)
+			interp.addLine("m->%s = (%s)byte_buf_str_len(m->%s, %s);", lf.name, typeName4C(lf.type_), f.name, stringMax_C(node, f))
+			interp.addNewLine()
+		}
+	}
+
+	var notes []*AstSrcComment
+	if len(node.notes) > 0 {
+		notes = node.notes[:]
+	}
+
+	for _, u := range units {
+		for len(notes) > 0 && u.fields[0].line > notes[0].line {
+			interp.addLine("//" + notes[0].value)
+			notes = notes[1:]
+		}
+
+		if u.bits > 0 {
+			word, wt := bitWord_Go(u.bits), u.wordType()
+			interp.addLine("%s = 0;", word)
+			for idx, f := range u.fields {
+				_, bn := isIntType(f.type_)
+				val := fmt.Sprintf("m->%s & 0x%x", f.name, 1<<bn-1)
+				shift := u.bitShift(idx)
+				if typeName4C(f.type_) != typeName4C(wt) {
+					//widen before the shift, or it is done in int
+					val = fmt.Sprintf("(%s)(%s)", typeName4C(wt), val)
+				} else if shift > 0 {
+					val = "(" + val + ")"
+				}
+
+				if shift > 0 {
+					interp.addLine("%s |= %s << %d;", word, val, shift)
+				} else {
+					interp.addLine("%s |= %s;", word, val)
+				}
+			}
+
+			if xor := u.fields[0].xor; xor != nil {
+				interp.addLine("%s ^= (%s)%s;", word, typeName4C(wt), xor.name)
+			}
+			interp.addLine("if (byte_buf_put_%s(buf, %s) < 0) return -1;", numSuffix_C(u.fields[0], wt), word)
+			interp.addNewLine()
+			continue
+		}
+
+		f := u.fields[0]
+		if isString(f.type_) {
+			interp.wrapExist_C(f, func() {
+				interp.encodeString_C(f)
+			})
+			continue
+		}
+
+		switch ft := f.type_.(type) {
+		case *AstPrimType:
+			if primBits(ft) == 0 {
+				doPanic("msg encode not support non int types")
+			}
+
+			if isVarInt(ft) {
+				doPanic("var int encode is not supported in c style")
+			}
+
+			interp.wrapExist_C(f, func() {
+				if f.max != nil {
+					interp.addNewLine()
+					interp.addLine("if (m->%s > %s) m->%s = %s;", f.name, f.max.name, f.name, f.max.name)
+				}
+
+				if f.min != nil {
+					interp.addLine("if (m->%s < %s) m->%s = %s;", f.name, f.min.name, f.name, f.min.name)
+				}
+
+				if f.xor == nil {
+					interp.addLine("if (byte_buf_put_%s(buf, %s) < 0) return -1;", numSuffix_C(f, ft), putArg_C(ft, "m->"+f.name))
+				} else {
+					interp.addLine("if (byte_buf_put_%s(buf, m->%s ^ (%s)%s) < 0) return -1;", numSuffix_C(f, ft), f.name, typeName4C(ft), f.xor.name)
+				}
+			})
+
+		case *AstStructType, *AstUndefType:
+			interp.wrapExist_C(f, func() {
+				interp.addLine("if (encode_%s(buf, &m->%s) < 0) return -1;", typeName4C(ft), f.name)
+			})
+
+		case *AstArrayType:
+			interp.wrapExist_C(f, func() {
+				limit := arrayLimit_C(node, f)
+				if f.untilEnd {
+					interp.addNewLine()
+					interp.addLine("if (%s > UNTIL_END_MAX) return -1;", limit)
+				}
+
+				if isByteArray(ft) {
+					interp.addNewLine()
+					interp.addLine("if (byte_buf_put_bytes(buf, m->%s, %s) < 0) return -1;", f.name, limit)
+					return
+				}
+
+				interp.addLine("for (i = 0; i < %s; i++) {", limit)
+				interp.pushStackFrame()
+				switch et := ft.elemType.(type) {
+				case *AstPrimType:
+					if bn := primBits(et); bn == 0 || bn%8 != 0 || isVarInt(et) {
+						doPanic("msg encode not support non int type or type int of bits not div by 8")
+					}
+					interp.addLine("if (byte_buf_put_%s(buf, %s) < 0) return -1;", numSuffix_C(f, et), putArg_C(et, fmt.Sprintf("m->%s[i]", f.name)))
+
+				case *AstStructType, *AstUndefType:
+					interp.addLine("if (encode_%s(buf, &m->%s[i]) < 0) return -1;", typeName4C(et), f.name)
+
+				default:
+					doPanic("unsupported array elem type encode: %s %s", f.name, ft)
+				}
+				interp.popStackFrame()
+				interp.addLine("}")
+				interp.addNewLine()
+			})
+
+		default:
+			doPanic("encode unsupported type: %s %s", f.name, ft)
+		}
+	}
+
+	interp.addLine("return 0;")
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+func (interp *interpreter) visitMsgDecode_C(node *AstStructType) {
+	interp.addLine("int decode_%s(byte_buf *buf, %s *m) {", node.name, node.name)
+	interp.pushStackFrame()
+
+	units := msgFieldUnits(node)
+	interp.msgLocals_C(node, units)
+
+	for _, u := range units {
+		if u.bits > 0 {
+			word, wt := bitWord_Go(u.bits), u.wordType()
+			interp.addLine("if (byte_buf_get_%s(buf, &%s) < 0) return -1;", numSuffix_C(u.fields[0], wt), word)
+			if xor := u.fields[0].xor; xor != nil {
+				interp.addLine("%s ^= (%s)%s;", word, typeName4C(wt), xor.name)
+			}
+
+			for idx, f := range u.fields {
+				_, bn := isIntType(f.type_)
+				val := word
+				if shift := u.bitShift(idx); shift > 0 {
+					val = fmt.Sprintf("(%s >> %d)", word, shift)
+				}
+
+				val = fmt.Sprintf("%s & 0x%x", val, 1<<bn-1)
+				if typeName4C(f.type_) != typeName4C(wt) {
+					val = fmt.Sprintf("(%s)(%s)", typeName4C(f.type_), val)
+				}
+				interp.addLine("m->%s = %s;", f.name, val)
+
+				if f.equ != nil {
+					interp.addLine("if (m->%s != %s) return -1;", f.name, f.equ.name)
+				}
+
+				if f.strict {
+					interp.addLine(strictCheck_C(f))
+				}
+			}
+			interp.addNewLine()
+			continue
+		}
+
+		f := u.fields[0]
+		if isString(f.type_) {
+			interp.wrapExist_C(f, func() {
+				interp.decodeString_C(f)
+			})
+			continue
+		}
+
+		switch ft := f.type_.(type) {
+		case *AstPrimType:
+			if primBits(ft) == 0 {
+				doPanic("msg decode not support non int types")
+			}
+
+			if isVarInt(ft) {
+				doPanic("var int decode is not supported in c style")
+			}
+
+			interp.wrapExist_C(f, func() {
+				interp.addLine("if (byte_buf_get_%s(buf, %s) < 0) return -1;", numSuffix_C(f, ft), getArg_C(ft, "m->"+f.name))
+				if f.xor != nil {
+					interp.addLine("m->%s ^= (%s)%s;", f.name, typeName4C(ft), f.xor.name)
+				}
+
+				if f.max != nil {
+					interp.addLine("if (m->%s > %s) return -1;", f.name, f.max.name)
+				}
+
+				if f.min != nil {
+					interp.addLine("if (m->%s < %s) return -1;", f.name, f.min.name)
+				}
+
+				if f.equ != nil {
+					interp.addLine("if (m->%s != %s) return -1;", f.name, f.equ.name)
+				}
+
+				if f.strict {
+					interp.addLine(strictCheck_C(f))
+				}
+			})
+
+		case *AstStructType, *AstUndefType:
+			interp.wrapExist_C(f, func() {
+				interp.addLine("if (decode_%s(buf, &m->%s) < 0) return -1;", typeName4C(ft), f.name)
+			})
+
+		case *AstArrayType:
+			if f.untilEnd {
+				interp.decodeUntilEnd_C(f, ft)
+				continue
+			}
+
+			interp.wrapExist_C(f, func() {
+				limit := arrayLimit_C(node, f)
+				if isByteArray(ft) {
+					interp.addLine("if (byte_buf_get_bytes(buf, m->%s, %s) < 0) return -1;", f.name, limit)
+					return
+				}
+
+				interp.addLine("for (i = 0; i < %s; i++) {", limit)
+				interp.pushStackFrame()
+				switch et := ft.elemType.(type) {
+				case *AstPrimType:
+					if bn := primBits(et); bn == 0 || bn%8 != 0 || isVarInt(et) {
+						doPanic("msg decode not support non int type or type int of bits not div by 8")
+					}
+					interp.addLine("if (byte_buf_get_%s(buf, %s) < 0) return -1;", numSuffix_C(f, et), getArg_C(et, fmt.Sprintf("m->%s[i]", f.name)))
+
+				case *AstStructType, *AstUndefType:
+					interp.addLine("if (decode_%s(buf, &m->%s[i]) < 0) return -1;", typeName4C(et), f.name)
+
+				default:
+					doPanic("unsupported array elem type decode: %s %s", f.name, ft)
+				}
+				interp.popStackFrame()
+				interp.addLine("}")
+				interp.addNewLine()
+			})
+
+		default:
+			doPanic("decode unsupported type: %s %s", f.name, ft)
+		}
+	}
+
+	if node.mend {
+		interp.addLine("if (buf->pos < buf->size) return BYTE_BUF_EXTRA; //extra bytes: buf->size - buf->pos")
+	}
+	interp.addLine("return 0;")
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+//decodeUntilEnd_C decode the elements of an until end array from the buf->size - buf->pos bytes left
+func (interp *interpreter) decodeUntilEnd_C(f *AstVarDecl, ft *AstArrayType) {
+	if isByteArray(ft) {
+		interp.addLine("m->%s_count = buf->size - buf->pos;", f.name)
+		interp.addLine("if (m->%s_count > UNTIL_END_MAX) return -1;", f.name)
+		interp.addLine("if (byte_buf_get_bytes(buf, m->%s, m->%s_count) < 0) return -1;", f.name, f.name)
+		return
+	}
+
+	interp.addLine("for (i = 0; buf->pos < buf->size; i++) {")
+	interp.pushStackFrame()
+	interp.addLine("if (i == UNTIL_END_MAX) return -1;")
+	switch et := ft.elemType.(type) {
+	case *AstPrimType:
+		interp.addLine("if (byte_buf_get_%s(buf, %s) < 0) return -1;", numSuffix_C(f, et), getArg_C(et, fmt.Sprintf("m->%s[i]", f.name)))
+
+	default:
+		interp.addLine("if (decode_%s(buf, &m->%s[i]) < 0) return -1;", typeName4C(et), f.name)
+	}
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.addLine("m->%s_count = i;", f.name)
+}
+
+func (interp *interpreter) visitMsgCodec_C(node *AstStructType) {
+	interp.visitMsgEncode_C(node)
+	interp.addLine("")
+	interp.visitMsgDecode_C(node)
+}
+
+func (interp *interpreter) visitMsgDefine_C(node *AstStructType) {
+	interp.addLine("")
+	interp.addLine("struct %s {", node.name)
+	interp.pushStackFrame()
+	for _, f := range node.fields {
+		if isString(f.type_) {
+			if f.comment != nil {
+				interp.addLine("char %s[%s + 1]; //string %s", f.name, stringMax_C(node, f), f.comment.value)
+			} else {
+				interp.addLine("char %s[%s + 1]; //string", f.name, stringMax_C(node, f))
+			}
+			continue
+		}
+
+		switch ft := f.type_.(type) {
+		case *AstPrimType:
+			tn := typeName4C(ft)
+			if ft.flags != nil {
+				tn = ft.flags.name
+			}
+
+			if f.comment != nil {
+				interp.addLine("%s %s; //%s %s", tn, f.name, ft.name, f.comment.value)
+			} else {
+				interp.addLine("%s %s; //%s", tn, f.name, ft.name)
+			}
+
+		case *AstStructType, *AstUndefType:
+			//members are stored by value, so the type must be complete here
+			if !interp.visited_C[typeName4C(ft)] {
+				doPanic("message \"%s\" must be defined before field \"%s\" in c mode, line: %d", typeName4C(ft), f.name, f.line)
+			}
+
+			if f.comment != nil {
+				interp.addLine("%s %s; //%s", typeName4C(ft), f.name, f.comment.value)
+			} else {
+				interp.addLine("%s %s;", typeName4C(ft), f.name)
+			}
+
+		case *AstArrayType:
+			interp.addLine("%s %s[%s];", typeName4C(ft.elemType), f.name, arrayMax_C(node, f))
+			if f.untilEnd {
+				interp.addLine("uint32_t %s_count; //elements of %s, until end", f.name, f.name)
+			}
+
+		default:
+			doPanic("unsupported type: %s %s", f.name, ft)
+		}
+	}
+	interp.popStackFrame()
+	interp.addLine("};")
+	interp.addLine("")
+	interp.visited_C[node.name] = true
+
+	interp.visitMsgCodec_C(node)
+}
+
+func (interp *interpreter) visitTypeDef_C(node *AstTypeDef) {
+	interp.addLine("typedef %s %s;", typeName4C(node.impl), node.name)
+
+	if node.impl.astType() == AST_TP_Struct {
+		impl := node.impl.(*AstStructType)
+		oname := impl.name
+		impl.name = node.name
+		interp.visitMsgCodec_C(impl)
+		impl.name = oname
+	}
+}
+
+func msgByIdName_C(op string, mspace string) string {
+	return fmt.Sprint(op, strings.ToUpper(mspace[:1]), mspace[1:], "MsgById")
+}
+
+func (interp *interpreter) visitBindCodec_C(binds []*AstBindDef, op string) {
+	interp.addNewLine()
+	interp.addLine("int %s(byte_buf *buf, uint16_t mid, void *msg) {", msgByIdName_C(op, interp.program.mspace))
+	interp.pushStackFrame()
+
+	interp.addLine("switch (mid) {")
+	for idx, bind := range binds {
+		if idx != 0 {
+			interp.addNewLine()
+		}
+		interp.addLine("case %s:", bind.msgId)
+		interp.pushStackFrame()
+		if len(bind.msgName) != 0 {
+			interp.addLine("return %s_%s(buf, (%s *)msg);", op, bind.msgName, bind.msgName)
+		} else {
+			interp.addLine("return 0;")
+		}
+		interp.popStackFrame()
+	}
+	interp.addLine("}")
+
+	interp.addNewLine()
+	interp.addLine("return -1;")
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.addNewLine()
+}
+
+func (interp *interpreter) visitBinds_C(binds []*AstBindDef) {
+	interp.visitBindCodec_C(binds, "encode")
+	interp.visitBindCodec_C(binds, "decode")
+}
@@ -1,11 +1,810 @@
 package protoc
 
 import (
+	"bytes"
 	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"sort"
 	"strings"
 	"unicode"
 )
 
+//packages the generated go code may refer to, keyed by package name
+var knownImports_Go = map[string]string{
+	"binary":  "encoding/binary",
+	"bytes":   "bytes",
+	"errors":  "errors",
+	"fmt":     "fmt",
+	"io":      "io",
+	"math":    "math",
+	"strings": "strings",
+	"utf8":    "unicode/utf8",
+}
+
+//packageName_Go return the package name of generated go code, which is derived from mspace if not specified
+func (interp *interpreter) packageName_Go() string {
+	if len(interp.Package) > 0 {
+		return interp.Package
+	}
+
+	name := strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, interp.program.mspace)
+
+	if len(name) == 0 || unicode.IsDigit(rune(name[0])) {
+		name = "proto" + name
+	}
+
+	return name
+}
+
+//error types of generated go code, $package is replaced by the package name
+var errorCode_Go = []string{
+	"//DecodeError describe why a message failed to decode, Reason is one of:",
+	"//\"short\": the input ended early, Err holds the io error",
+	"//\"overflow\": the varint is too long for the field",
+	"//\"max\", \"min\", \"equal\": the field value broke the constraint, \"max\" also for no NUL within the max of a cstring",
+	"//\"enum\": the field value is not an id of its group",
+	"//\"flags\": the strict flags field has undefined bits set",
+	"//\"mend\": bytes remain after a message marked mend, Err tells how many",
+	"//\"tag\": no case of the union field for the tag value",
+	"//\"optional\": the presence bitmap has bits of no optional field",
+	"//\"utf8\": the string field is not valid UTF-8",
+	"//\"unknown id\": no message bound to the message id",
+	"type DecodeError struct {",
+	"    Msg    string",
+	"    Field  string",
+	"    Offset int",
+	"    Reason string",
+	"    Err    error",
+	"}",
+	"",
+	"func (e *DecodeError) Error() string {",
+	"    return codecErrorString(\"decode\", e.Msg, e.Field, e.Offset, e.Reason, e.Err)",
+	"}",
+	"",
+	"func (e *DecodeError) Unwrap() error {",
+	"    return e.Err",
+	"}",
+	"",
+	"//EncodeError describe why a message failed to encode, Reason is one of:",
+	"//\"write\": the writer failed, Err holds the io error",
+	"//\"tag\", \"union\": no case of the union field for the tag value, or the value is not of the case type",
+	"//\"size\": the sized message is too long for its size field, or the slices sharing a limit field differ in length",
+	"//\"unknown id\": no message bound to the message id",
+	"type EncodeError struct {",
+	"    Msg    string",
+	"    Field  string",
+	"    Offset int",
+	"    Reason string",
+	"    Err    error",
+	"}",
+	"",
+	"func (e *EncodeError) Error() string {",
+	"    return codecErrorString(\"encode\", e.Msg, e.Field, e.Offset, e.Reason, e.Err)",
+	"}",
+	"",
+	"func (e *EncodeError) Unwrap() error {",
+	"    return e.Err",
+	"}",
+	"",
+	"func codecErrorString(op string, msg string, field string, off int, reason string, err error) string {",
+	"    desc := \"$package: \" + op + \" \" + msg",
+	"    if len(field) > 0 {",
+	"        desc += fmt.Sprintf(\".%s at offset %d\", field, off)",
+	"    }",
+	"",
+	"    desc += \" failed: \" + reason",
+	"    if err != nil {",
+	"        desc += \": \" + err.Error()",
+	"    }",
+	"    return desc",
+	"}",
+}
+
+//byte counting reader/writer of the io.Reader/io.Writer style, the count is the offset of codec errors
+var countCode_Go = []string{
+	"type countWriter struct {",
+	"    w io.Writer",
+	"    n int",
+	"}",
+	"",
+	"func newCountWriter(w io.Writer) *countWriter {",
+	"    if cw, ok := w.(*countWriter); ok {",
+	"        return cw",
+	"    }",
+	"    return &countWriter{w: w}",
+	"}",
+	"",
+	"func (c *countWriter) Write(p []byte) (int, error) {",
+	"    n, err := c.w.Write(p)",
+	"    c.n += n",
+	"    return n, err",
+	"}",
+	"",
+	"func (c *countWriter) write(msg string, field string, data interface{}) error {",
+	"    return c.writeOrder(msg, field, binary.BigEndian, data)",
+	"}",
+	"",
+	"func (c *countWriter) writeLE(msg string, field string, data interface{}) error {",
+	"    return c.writeOrder(msg, field, binary.LittleEndian, data)",
+	"}",
+	"",
+	"func (c *countWriter) writeOrder(msg string, field string, order binary.ByteOrder, data interface{}) error {",
+	"    off := c.n",
+	"    if err := binary.Write(c, order, data); err != nil {",
+	"        return &EncodeError{Msg: msg, Field: field, Offset: off, Reason: \"write\", Err: err}",
+	"    }",
+	"    return nil",
+	"}",
+	"",
+	"//writeUvarint write v in LEB128, 7 bits per byte from the lowest, the high bit set if more bytes follow",
+	"func (c *countWriter) writeUvarint(msg string, field string, v uint64) error {",
+	"    var b [binary.MaxVarintLen64]byte",
+	"    off := c.n",
+	"    if _, err := c.Write(b[:binary.PutUvarint(b[:], v)]); err != nil {",
+	"        return &EncodeError{Msg: msg, Field: field, Offset: off, Reason: \"write\", Err: err}",
+	"    }",
+	"    return nil",
+	"}",
+	"",
+	"//countReader keep the offset of the last field read for constraint errors",
+	"type countReader struct {",
+	"    r    io.Reader",
+	"    n    int",
+	"    last int",
+	"}",
+	"",
+	"func newCountReader(r io.Reader) *countReader {",
+	"    if cr, ok := r.(*countReader); ok {",
+	"        return cr",
+	"    }",
+	"    return &countReader{r: r}",
+	"}",
+	"",
+	"func (c *countReader) Read(p []byte) (int, error) {",
+	"    n, err := c.r.Read(p)",
+	"    c.n += n",
+	"    return n, err",
+	"}",
+	"",
+	"func (c *countReader) read(msg string, field string, data interface{}) error {",
+	"    return c.readOrder(msg, field, binary.BigEndian, data)",
+	"}",
+	"",
+	"func (c *countReader) readLE(msg string, field string, data interface{}) error {",
+	"    return c.readOrder(msg, field, binary.LittleEndian, data)",
+	"}",
+	"",
+	"func (c *countReader) readOrder(msg string, field string, order binary.ByteOrder, data interface{}) error {",
+	"    c.last = c.n",
+	"    if err := binary.Read(c, order, data); err != nil {",
+	"        return &DecodeError{Msg: msg, Field: field, Offset: c.last, Reason: \"short\", Err: err}",
+	"    }",
+	"    return nil",
+	"}",
+	"",
+	"//readRest read the input to the end",
+	"func (c *countReader) readRest(msg string, field string) ([]byte, error) {",
+	"    c.last = c.n",
+	"    var rest []byte",
+	"    var b [256]byte",
+	"    for {",
+	"        k, err := c.Read(b[:])",
+	"        rest = append(rest, b[:k]...)",
+	"        if err == io.EOF {",
+	"            return rest, nil",
+	"        } else if err != nil {",
+	"            return rest, &DecodeError{Msg: msg, Field: field, Offset: c.last, Reason: \"short\", Err: err}",
+	"        }",
+	"    }",
+	"}",
+	"",
+	"//readEnd read the input to the end, a message marked mend fails if any byte remains",
+	"func (c *countReader) readEnd(msg string) error {",
+	"    rest, err := c.readRest(msg, \"\")",
+	"    if err == nil && len(rest) > 0 {",
+	"        err = &DecodeError{Msg: msg, Offset: c.last, Reason: \"mend\", Err: fmt.Errorf(\"%d extra bytes\", len(rest))}",
+	"    }",
+	"    return err",
+	"}",
+	"",
+	"//sized return the reader of a sized message, it reads at most size bytes and goes on counting from c",
+	"func (c *countReader) sized(size uint64) *countReader {",
+	"    return &countReader{r: io.LimitReader(c, int64(size)), n: c.n}",
+	"}",
+	"",
+	"//skipRest skip the unknown bytes left in a sized message, fail if the input ends before its size",
+	"func (c *countReader) skipRest(msg string, field string) error {",
+	"    if _, err := c.readRest(msg, field); err != nil {",
+	"        return err",
+	"    }",
+	"",
+	"    if left := c.r.(*io.LimitedReader).N; left > 0 {",
+	"        return &DecodeError{Msg: msg, Field: field, Offset: c.n, Reason: \"short\", Err: io.ErrUnexpectedEOF}",
+	"    }",
+	"    return nil",
+	"}",
+	"",
+	"func (c *countReader) readUvarint(msg string, field string, bits uint) (uint64, error) {",
+	"    c.last = c.n",
+	"    var b [1]byte",
+	"    v := uint64(0)",
+	"    for shift := uint(0); ; shift += 7 {",
+	"        if _, err := io.ReadFull(c, b[:]); err != nil {",
+	"            return 0, &DecodeError{Msg: msg, Field: field, Offset: c.last, Reason: \"short\", Err: err}",
+	"        }",
+	"",
+	"        if shift >= 64 || (shift == 63 && b[0] > 1) {",
+	"            return 0, &DecodeError{Msg: msg, Field: field, Offset: c.last, Reason: \"overflow\"}",
+	"        }",
+	"",
+	"        v |= uint64(b[0]&0x7f) << shift",
+	"        if b[0] < 0x80 {",
+	"            break",
+	"        }",
+	"    }",
+	"",
+	"    if bits < 64 && v>>bits != 0 {",
+	"        return 0, &DecodeError{Msg: msg, Field: field, Offset: c.last, Reason: \"overflow\"}",
+	"    }",
+	"    return v, nil",
+	"}",
+	"",
+	"//writeVarint write v in zig-zag LEB128, the sign is moved to the lowest bit so small negatives are short",
+	"func (c *countWriter) writeVarint(msg string, field string, v int64) error {",
+	"    return c.writeUvarint(msg, field, uint64(v<<1)^uint64(v>>63))",
+	"}",
+	"",
+	"func (c *countReader) readUvarint32(msg string, field string, v *uint32) error {",
+	"    u, err := c.readUvarint(msg, field, 32)",
+	"    *v = uint32(u)",
+	"    return err",
+	"}",
+	"",
+	"func (c *countReader) readUvarint64(msg string, field string, v *uint64) error {",
+	"    u, err := c.readUvarint(msg, field, 64)",
+	"    *v = u",
+	"    return err",
+	"}",
+	"",
+	"func (c *countReader) readVarint32(msg string, field string, v *int32) error {",
+	"    u, err := c.readUvarint(msg, field, 32)",
+	"    *v = int32(u>>1) ^ -int32(u&1)",
+	"    return err",
+	"}",
+	"",
+	"func (c *countReader) readVarint64(msg string, field string, v *int64) error {",
+	"    u, err := c.readUvarint(msg, field, 64)",
+	"    *v = int64(u>>1) ^ -int64(u&1)",
+	"    return err",
+	"}",
+}
+
+//varint codec of the append style and offset fixing of nested message errors
+var nestedCode_Go = []string{
+	"//appendUvarint append v in LEB128, 7 bits per byte from the lowest, the high bit set if more bytes follow",
+	"func appendUvarint(dst []byte, v uint64) []byte {",
+	"    for v >= 0x80 {",
+	"        dst = append(dst, byte(v)|0x80)",
+	"        v >>= 7",
+	"    }",
+	"    return append(dst, byte(v))",
+	"}",
+	"",
+	"//uvarint read a LEB128 varint of at most bits, return the bytes read; it fails as readUvarint of the io style does",
+	"func uvarint(b []byte, msg string, field string, bits uint) (uint64, int, error) {",
+	"    v := uint64(0)",
+	"    for k, shift := 0, uint(0); ; k, shift = k+1, shift+7 {",
+	"        if k == len(b) {",
+	"            return 0, 0, &DecodeError{Msg: msg, Field: field, Reason: \"short\", Err: io.ErrUnexpectedEOF}",
+	"        }",
+	"",
+	"        if shift >= 64 || (shift == 63 && b[k] > 1) {",
+	"            return 0, 0, &DecodeError{Msg: msg, Field: field, Reason: \"overflow\"}",
+	"        }",
+	"",
+	"        v |= uint64(b[k]&0x7f) << shift",
+	"        if b[k] < 0x80 {",
+	"            if bits < 64 && v>>bits != 0 {",
+	"                return 0, 0, &DecodeError{Msg: msg, Field: field, Reason: \"overflow\"}",
+	"            }",
+	"            return v, k + 1, nil",
+	"        }",
+	"    }",
+	"}",
+	"",
+	"//appendVarint append v in zig-zag LEB128, the sign is moved to the lowest bit so small negatives are short",
+	"func appendVarint(dst []byte, v int64) []byte {",
+	"    return appendUvarint(dst, uint64(v<<1)^uint64(v>>63))",
+	"}",
+	"",
+	"func uvarint32(b []byte, msg string, field string, v *uint32) (int, error) {",
+	"    u, k, err := uvarint(b, msg, field, 32)",
+	"    *v = uint32(u)",
+	"    return k, err",
+	"}",
+	"",
+	"func uvarint64(b []byte, msg string, field string, v *uint64) (int, error) {",
+	"    u, k, err := uvarint(b, msg, field, 64)",
+	"    *v = u",
+	"    return k, err",
+	"}",
+	"",
+	"func varint32(b []byte, msg string, field string, v *int32) (int, error) {",
+	"    u, k, err := uvarint(b, msg, field, 32)",
+	"    *v = int32(u>>1) ^ -int32(u&1)",
+	"    return k, err",
+	"}",
+	"",
+	"func varint64(b []byte, msg string, field string, v *int64) (int, error) {",
+	"    u, k, err := uvarint(b, msg, field, 64)",
+	"    *v = int64(u>>1) ^ -int64(u&1)",
+	"    return k, err",
+	"}",
+	"",
+	"//nestedError shift the offset of a nested message error to the outer message",
+	"func nestedError(err error, off int) error {",
+	"    switch e := err.(type) {",
+	"    case *DecodeError:",
+	"        e.Offset += off",
+	"    case *EncodeError:",
+	"        e.Offset += off",
+	"    }",
+	"    return err",
+	"}",
+}
+
+//string cutting and padding shared by both styles, only emitted for messages with string fields
+var stringCode_Go = []string{
+	"//cutString cut s to at most max bytes, never in the middle of a UTF-8 sequence",
+	"func cutString(s string, max uint64) string {",
+	"    if uint64(len(s)) <= max {",
+	"        return s",
+	"    }",
+	"",
+	"    n := int(max)",
+	"    for n > 0 && !utf8.RuneStart(s[n]) {",
+	"        n--",
+	"    }",
+	"    return s[:n]",
+	"}",
+	"",
+	"//appendCString append s ended by a NUL, s is cut at its first NUL and to at most max bytes",
+	"func appendCString(dst []byte, s string, max int) []byte {",
+	"    if i := strings.IndexByte(s, 0); i >= 0 {",
+	"        s = s[:i]",
+	"    }",
+	"    return append(append(dst, cutString(s, uint64(max))...), 0)",
+	"}",
+	"",
+	"//appendFixedString append s cut or padded to n bytes",
+	"func appendFixedString(dst []byte, s string, n int, pad byte) []byte {",
+	"    s = cutString(s, uint64(n))",
+	"    dst = append(dst, s...)",
+	"    for i := len(s); i < n; i++ {",
+	"        dst = append(dst, pad)",
+	"    }",
+	"    return dst",
+	"}",
+	"",
+	"//trimString return the text of a fixed size string, up to the first NUL and without the trailing padding",
+	"func trimString(b []byte, pad byte) string {",
+	"    if i := bytes.IndexByte(b, 0); i >= 0 {",
+	"        b = b[:i]",
+	"    }",
+	"    return string(bytes.TrimRight(b, string(pad)))",
+	"}",
+}
+
+//string reading of the io.Reader style
+var readStringCode_Go = []string{
+	"func (c *countReader) readString(msg string, field string, n int, v *string) error {",
+	"    b := make([]byte, n)",
+	"    if err := c.read(msg, field, b); err != nil {",
+	"        return err",
+	"    }",
+	"    *v = string(b)",
+	"    return nil",
+	"}",
+	"",
+	"func (c *countReader) readFixedString(msg string, field string, n int, pad byte, v *string) error {",
+	"    b := make([]byte, n)",
+	"    if err := c.read(msg, field, b); err != nil {",
+	"        return err",
+	"    }",
+	"    *v = trimString(b, pad)",
+	"    return nil",
+	"}",
+	"",
+	"//readCString read a string ended by a NUL, fail if no NUL is within max bytes",
+	"func (c *countReader) readCString(msg string, field string, max int, v *string) error {",
+	"    c.last = c.n",
+	"    var s []byte",
+	"    var b [1]byte",
+	"    for {",
+	"        if _, err := io.ReadFull(c, b[:]); err != nil {",
+	"            return &DecodeError{Msg: msg, Field: field, Offset: c.last, Reason: \"short\", Err: err}",
+	"        }",
+	"",
+	"        if b[0] == 0 {",
+	"            break",
+	"        }",
+	"",
+	"        if len(s) == max {",
+	"            return &DecodeError{Msg: msg, Field: field, Offset: c.last, Reason: \"max\"}",
+	"        }",
+	"        s = append(s, b[0])",
+	"    }",
+	"",
+	"    *v = string(s)",
+	"    return nil",
+	"}",
+}
+
+//string reading of the append style, the error offset is fixed by nestedError
+var cstringCode_Go = []string{
+	"//cstring read a string ended by a NUL, fail if no NUL is within max bytes, return the bytes read with the NUL",
+	"func cstring(b []byte, msg string, field string, max int, v *string) (int, error) {",
+	"    if len(b) > max+1 {",
+	"        b = b[:max+1]",
+	"    }",
+	"",
+	"    i := bytes.IndexByte(b, 0)",
+	"    if i < 0 && len(b) > max {",
+	"        return 0, &DecodeError{Msg: msg, Field: field, Reason: \"max\"}",
+	"    } else if i < 0 {",
+	"        return 0, &DecodeError{Msg: msg, Field: field, Reason: \"short\", Err: io.ErrUnexpectedEOF}",
+	"    }",
+	"",
+	"    *v = string(b[:i])",
+	"    return i + 1, nil",
+	"}",
+}
+
+func (interp *interpreter) visitPrelude_Go(program *AstProgram) {
+	interp.addLine("package %s", interp.packageName_Go())
+	interp.addNewLine()
+}
+
+//runtime_Go return the runtime shared by the generated messages: error types, the helpers of both codec styles and strings
+func (interp *interpreter) runtime_Go() string {
+	var lines []string
+	for _, code := range [][]string{errorCode_Go, countCode_Go, nestedCode_Go, stringCode_Go, readStringCode_Go, cstringCode_Go} {
+		lines = append(lines, code...)
+		lines = append(lines, "")
+	}
+
+	return strings.ReplaceAll(strings.Join(lines, "\n"), "$package", interp.packageName_Go())
+}
+
+//runtimeFile_Go return the file of the whole runtime, written once to the output dir and shared by all the files of the package
+func (interp *interpreter) runtimeFile_Go() ([]byte, error) {
+	var code bytes.Buffer
+	code.WriteString("/*\n")
+	code.WriteString(fmt.Sprintf(" * runtime of the codec generated by lwe_proto in package %s, Do NOT touch by hand!!!\n", interp.packageName_Go()))
+	code.WriteString(fmt.Sprintf(" * generator %s; mode: golang\n", INTERP_VERSION))
+	code.WriteString("*/\n")
+	code.WriteString(fmt.Sprintf("package %s\n\n", interp.packageName_Go()))
+	code.WriteString(interp.runtime_Go())
+	return completeFile_Go(code.Bytes())
+}
+
+//runtimeFileName_Go return the name of the runtime file in the output dir
+func (interp *interpreter) runtimeFileName_Go() string {
+	return interp.packageName_Go() + "_runtime.go"
+}
+
+//linkRuntime_Go put the runtime declarations used by the generated code right after its package clause, the others are dropped
+func (interp *interpreter) linkRuntime_Go(code []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", code, 0)
+	if err != nil {
+		return nil, fmt.Errorf("parse generated go code failed: %v", err)
+	}
+
+	runtime := []byte("package " + interp.packageName_Go() + "\n\n" + interp.runtime_Go())
+	rtFile, err := parser.ParseFile(fset, "", runtime, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("parse go runtime failed: %v", err)
+	}
+
+	//names referred by the generated code and the kept runtime, methods and fields are referred by name only
+	names := map[string]bool{}
+	refer := func(node ast.Node) {
+		ast.Inspect(node, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok {
+				names[id.Name] = true
+			}
+			return true
+		})
+	}
+	refer(file)
+
+	//exported methods such as Error are kept with their type, they may be called through an interface
+	needed := func(decl ast.Decl) bool {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				return names[d.Name.Name]
+			}
+
+			recv := d.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			return names[recv.(*ast.Ident).Name] && (ast.IsExported(d.Name.Name) || names[d.Name.Name])
+
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok && names[ts.Name.Name] {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	keep := make([]bool, len(rtFile.Decls))
+	for changed := true; changed; {
+		changed = false
+		for i, decl := range rtFile.Decls {
+			if !keep[i] && needed(decl) {
+				keep[i] = true
+				changed = true
+				refer(decl)
+			}
+		}
+	}
+
+	var src bytes.Buffer
+	pos := fset.Position(file.Name.End()).Offset
+	src.Write(code[:pos])
+	for i, decl := range rtFile.Decls {
+		if !keep[i] {
+			continue
+		}
+
+		start := decl.Pos()
+		if fd, ok := decl.(*ast.FuncDecl); ok && fd.Doc != nil {
+			start = fd.Doc.Pos()
+		} else if gd, ok := decl.(*ast.GenDecl); ok && gd.Doc != nil {
+			start = gd.Doc.Pos()
+		}
+		src.WriteString("\n\n")
+		src.Write(runtime[fset.Position(start).Offset:fset.Position(decl.End()).Offset])
+	}
+	src.Write(code[pos:])
+
+	return src.Bytes(), nil
+}
+
+//varint_Go return the codec name of a varint type, signed varints are zig-zag encoded
+func varint_Go(tp AstType) string {
+	if isSigned(tp) {
+		return "Varint"
+	}
+	return "Uvarint"
+}
+
+//varintCast_Go return the conversion of a varint field to the codec value
+func varintCast_Go(tp AstType) string {
+	if isSigned(tp) {
+		return "int64"
+	}
+	return "uint64"
+}
+
+//orderSuffix_Go return the method suffix of the field byte order, bit field aggregates are single bytes
+func orderSuffix_Go(node *AstStructType, field string) string {
+	if f := getMsgField(node, field); f != nil && f.le {
+		return "LE"
+	}
+	return ""
+}
+
+//writeField_Go return the statement writing the data of a field in the io.Writer style
+func writeField_Go(node *AstStructType, field string, data string) string {
+	return fmt.Sprintf("if err := w.write%s(\"%s\", \"%s\", %s); err != nil { return err }", orderSuffix_Go(node, field), node.name, field, data)
+}
+
+//readField_Go return the statement reading the data of a field in the io.Reader style
+func readField_Go(node *AstStructType, field string, data string) string {
+	return fmt.Sprintf("if err := r.read%s(\"%s\", \"%s\", %s); err != nil { return err }", orderSuffix_Go(node, field), node.name, field, data)
+}
+
+//isSlice_Go check if an array field is a slice, until end arrays are always slices, arrays limited by a field are slices in slice mode
+func isSlice_Go(interp *interpreter, node *AstStructType, f *AstVarDecl) bool {
+	return f.untilEnd || (interp.GoSlice && getMsgField(node, f.limit.name) != nil)
+}
+
+//sharedSlices_Go return the slices sharing a limit field with others, grouped by the limit field in the field order
+func (interp *interpreter) sharedSlices_Go(node *AstStructType) [][]*AstVarDecl {
+	var names []string
+	groups := map[string][]*AstVarDecl{}
+	for _, f := range node.fields {
+		if f.type_.astType() != AST_TP_Array || f.untilEnd || !isSlice_Go(interp, node, f) {
+			continue
+		}
+
+		if _, ok := groups[f.limit.name]; !ok {
+			names = append(names, f.limit.name)
+		}
+		groups[f.limit.name] = append(groups[f.limit.name], f)
+	}
+
+	var shared [][]*AstVarDecl
+	for _, name := range names {
+		if len(groups[name]) > 1 {
+			shared = append(shared, groups[name])
+		}
+	}
+	return shared
+}
+
+//deriveLimits_Go set the limit fields from the length of slices, clamped to the max or the limit field range, 0 for absent optional fields,
+//slices sharing a limit field must be of the same length, ret is the values returned before the error otherwise
+func (interp *interpreter) deriveLimits_Go(node *AstStructType, off string, ret string) {
+	for _, group := range interp.sharedSlices_Go(node) {
+		for _, f := range group[1:] {
+			interp.addLine("if len(m.%s) != len(m.%s) { return %s&EncodeError{Msg: \"%s\", Field: \"%s\", Offset: %s, Reason: \"size\", Err: fmt.Errorf(\"%%d elements, %s has %%d\", len(m.%s), len(m.%s))} }",
+				f.name, group[0].name, ret, node.name, f.name, off, group[0].name, f.name, group[0].name)
+		}
+	}
+
+	done := map[string]bool{}
+	for _, f := range node.fields {
+		if isString(f.type_) && f.limit != nil {
+			interp.deriveStringLimit_Go(node, f)
+			continue
+		}
+
+		if f.type_.astType() != AST_TP_Array || f.untilEnd || !isSlice_Go(interp, node, f) || done[f.limit.name] {
+			continue
+		}
+
+		done[f.limit.name] = true
+		lf := getMsgField(node, f.limit.name)
+		if lf.min != nil {
+			//clamp up to min would index out of the slice
+			doPanic("min of slice limit field is not supported, field: \"%s\" line: %d", lf.name, lf.line)
+		}
+
+		_, bn := isIntType(lf.type_)
+		max := fmt.Sprintf("0x%x", uint64(1)<<uint(bn)-1)
+		if lf.max != nil {
+			max = lf.max.name
+		} else if bn == 64 {
+			interp.addLine("m.%s = uint64(len(m.%s))", lf.name, f.name)
+			continue
+		}
+
+		interp.addLine("if n := uint64(len(m.%s)); n > %s { m.%s = %s } else { m.%s = %s(n) }",
+			f.name, max, lf.name, max, lf.name, typeName4Go(lf.type_))
+	}
+
+	//an absent optional field is not encoded, its limit field is 0 whatever is left in the field
+	for _, f := range node.optionals {
+		if f.limit != nil && getMsgField(node, f.limit.name) != nil {
+			interp.addLine("if !m.Has%s() { m.%s = 0 }", f.name, f.limit.name)
+		}
+	}
+}
+
+//deriveStringLimit_Go cut a string field to the range of its limit field and set the limit field from its length
+func (interp *interpreter) deriveStringLimit_Go(node *AstStructType, f *AstVarDecl) {
+	lf := getMsgField(node, f.limit.name)
+	_, bn := isIntType(lf.type_)
+	if lf.max != nil {
+		interp.addLine("m.%s = cutString(m.%s, uint64(%s))", f.name, f.name, lf.max.name)
+	} else if bn < 64 {
+		interp.addLine("m.%s = cutString(m.%s, 0x%x)", f.name, f.name, uint64(1)<<uint(bn)-1)
+	}
+	interp.addLine("m.%s = %s(len(m.%s))", lf.name, typeName4Go(lf.type_), f.name)
+}
+
+//stringPad_Go return the padding byte of a fixed size string field
+func stringPad_Go(f *AstVarDecl) string {
+	if f.padSpace {
+		return "' '"
+	}
+	return "0"
+}
+
+//encodeString_Go return the bytes of a string field to write
+func encodeString_Go(f *AstVarDecl, dst string) string {
+	if f.cstring {
+		return fmt.Sprintf("appendCString(%s, m.%s, %s)", dst, f.name, f.max.name)
+	} else if f.fixed != nil {
+		return fmt.Sprintf("appendFixedString(%s, m.%s, %s, %s)", dst, f.name, f.fixed.name, stringPad_Go(f))
+	} else if dst == "nil" {
+		return fmt.Sprintf("[]byte(m.%s)", f.name)
+	}
+	return fmt.Sprintf("append(%s, m.%s...)", dst, f.name)
+}
+
+//decodeString_Go read a string field by its limit field, up to a NUL or of the fixed size, then check UTF-8 if required
+func (interp *interpreter) decodeString_Go(node *AstStructType, f *AstVarDecl) {
+	if f.cstring {
+		interp.addLine("if err := r.readCString(\"%s\", \"%s\", %s, &m.%s); err != nil { return err }", node.name, f.name, f.max.name, f.name)
+	} else if f.fixed != nil {
+		interp.addLine("if err := r.readFixedString(\"%s\", \"%s\", %s, %s, &m.%s); err != nil { return err }",
+			node.name, f.name, f.fixed.name, stringPad_Go(f), f.name)
+	} else {
+		interp.addLine("if err := r.readString(\"%s\", \"%s\", int(m.%s), &m.%s); err != nil { return err }", node.name, f.name, f.limit.name, f.name)
+	}
+
+	if f.utf8 {
+		interp.addLine(decodeCheck_Go(node, f, fmt.Sprintf("!utf8.ValidString(m.%s)", f.name), "utf8"))
+	}
+}
+
+//makeSlice_Go allocate the slice of an array field to decode, the limit field is already read and checked
+func (interp *interpreter) makeSlice_Go(node *AstStructType, f *AstVarDecl) {
+	if isSlice_Go(interp, node, f) {
+		ft := f.type_.(*AstArrayType)
+		interp.addLine("m.%s = make([]%s, %s)", f.name, typeName4Go(ft.elemType), arrayLimitRef(node, f, "m."))
+	}
+}
+
+//decodeCheck_Go return the constraint check of the field just read, its offset is kept by the count reader
+func decodeCheck_Go(node *AstStructType, f *AstVarDecl, cond string, reason string) string {
+	return fmt.Sprintf("if %s { return &DecodeError{Msg: \"%s\", Field: \"%s\", Offset: r.last, Reason: \"%s\"} }",
+		cond, node.name, f.name, reason)
+}
+
+//completeFile_Go add the imports used by the generated code and format it
+func completeFile_Go(code []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", code, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("parse generated go code failed: %v", err)
+	}
+
+	used := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok && id.Obj == nil {
+				if path, ok := knownImports_Go[id.Name]; ok {
+					used[path] = true
+				}
+			}
+		}
+		return true
+	})
+
+	var paths []string
+	for path := range used {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var src bytes.Buffer
+	pos := fset.Position(file.Name.End()).Offset
+	src.Write(code[:pos])
+	if len(paths) > 0 {
+		src.WriteString("\n\nimport (\n")
+		for _, path := range paths {
+			src.WriteString(fmt.Sprintf("\t\"%s\"\n", path))
+		}
+		src.WriteString(")\n")
+	}
+	src.Write(code[pos:])
+
+	out, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated go code failed: %v", err)
+	}
+
+	return out, nil
+}
+
 func (interp *interpreter) visitIdGroupDefine_Go(node *AstIdGroupDef) {
 	interp.addLine("const (")
 	interp.pushStackFrame()
@@ -31,6 +830,9 @@ func (interp *interpreter) visitIdGroupDefine_Go(node *AstIdGroupDef) {
 	interp.addLine(")")
 
 	interp.idGroupName_Go(node)
+	if node.enumBits > 0 {
+		interp.idGroupType_Go(node)
+	}
 }
 
 func (interp *interpreter) idGroupName_Go(node *AstIdGroupDef) {
@@ -55,6 +857,155 @@ func (interp *interpreter) idGroupName_Go(node *AstIdGroupDef) {
 	interp.addLine("}")
 }
 
+//idGroupType_Go add the go type of an id group which types fields, decode rejects values not in the group
+func (interp *interpreter) idGroupType_Go(node *AstIdGroupDef) {
+	name := camelName_Go(node.name)
+	interp.addNewLine()
+	interp.addLine("type %s uint%d", name, node.enumBits)
+	interp.addNewLine()
+	interp.addLine("func (v %s) String() string {", name)
+	interp.pushStackFrame()
+	interp.addLine("switch v {")
+	ids := []string{}
+	for _, id := range node.items {
+		interp.addLine("case %s:", id.name)
+		interp.pushStackFrame()
+		interp.addLine("return \"%s\"", id.name)
+		interp.popStackFrame()
+		ids = append(ids, id.name)
+	}
+	interp.addLine("}")
+	interp.addLine("return fmt.Sprintf(\"%s(%%d)\", uint64(v))", name)
+	interp.popStackFrame()
+	interp.addLine("}")
+
+	interp.addNewLine()
+	interp.addLine("//Valid check if v is an id of %s", node.name)
+	interp.addLine("func (v %s) Valid() bool {", name)
+	interp.pushStackFrame()
+	interp.addLine("switch v {")
+	interp.addLine("case %s:", strings.Join(ids, ", "))
+	interp.pushStackFrame()
+	interp.addLine("return true")
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.addLine("return false")
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+//visitFlagsDefine_Go add the go type of flags with typed masks, Has/Set/Clear and String listing the set flags
+func (interp *interpreter) visitFlagsDefine_Go(node *AstFlagsDef) {
+	name := camelName_Go(node.name)
+	_, bn := isIntType(node.base)
+	interp.addLine("type %s uint%d", name, storageBits(bn))
+	interp.addNewLine()
+
+	interp.addLine("const (")
+	interp.pushStackFrame()
+	var notes []*AstSrcComment
+	if len(node.notes) > 0 {
+		notes = node.notes[:]
+	}
+
+	for _, id := range node.items {
+		for len(notes) > 0 && id.line > notes[0].line {
+			interp.addLine("//%s", notes[0].value)
+			notes = notes[1:]
+		}
+
+		interp.addLine("%s %s = 1 << %d", id.name, name, id.idVal)
+	}
+	interp.addNewLine()
+	interp.addLine("%sMask %s = 0x%x //all defined flags", name, name, flagsMask(node))
+	interp.popStackFrame()
+	interp.addLine(")")
+
+	interp.addNewLine()
+	interp.addLine("//Has check if all flags of f are set")
+	interp.addLine("func (v %s) Has(f %s) bool { return v&f == f }", name, name)
+	interp.addNewLine()
+	interp.addLine("func (v *%s) Set(f %s) { *v |= f }", name, name)
+	interp.addNewLine()
+	interp.addLine("func (v *%s) Clear(f %s) { *v &^= f }", name, name)
+
+	interp.addNewLine()
+	interp.addLine("//String list the set flags joined by '|', undefined bits are in hex")
+	interp.addLine("func (v %s) String() string {", name)
+	interp.pushStackFrame()
+	interp.addLine("s := \"\"")
+	for _, id := range node.items {
+		interp.addLine("if v&%s != 0 { s += \"|%s\" }", id.name, id.name)
+	}
+	interp.addLine("if rest := v &^ %sMask; rest != 0 { s += fmt.Sprintf(\"|0x%%x\", uint64(rest)) }", name)
+	interp.addLine("if s == \"\" { return \"0\" }")
+	interp.addLine("return s[1:]")
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+//camelName_Go return the go type name of an id group or flags, lwe_kind -> LweKind
+func camelName_Go(node string) string {
+	name := ""
+	for _, part := range strings.Split(node, "_") {
+		if len(part) > 0 {
+			name += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+
+	return name
+}
+
+//namedType_Go return the go type of an int field typed by an id group or flags, empty for plain ints
+func namedType_Go(f *AstVarDecl) string {
+	if f.enumGroup != nil {
+		return camelName_Go(f.enumGroup.name)
+	}
+
+	if flags := flagsType(f.type_); flags != nil {
+		return camelName_Go(flags.name)
+	}
+
+	return ""
+}
+
+//fieldType_Go return the go type of an int field, fields of an id group or flags have the named type
+func fieldType_Go(f *AstVarDecl) string {
+	if name := namedType_Go(f); name != "" {
+		return name
+	}
+
+	return typeName4Go(f.type_)
+}
+
+//fieldVal_Go return the value of an int field to encode, named type values are converted to the plain int
+func fieldVal_Go(f *AstVarDecl) string {
+	if namedType_Go(f) != "" {
+		return fmt.Sprintf("%s(m.%s)", typeName4Go(f.type_), f.name)
+	}
+
+	return "m." + f.name
+}
+
+//fieldRef_Go return the pointer of an int field to decode into
+func fieldRef_Go(f *AstVarDecl) string {
+	if namedType_Go(f) != "" {
+		return fmt.Sprintf("(*%s)(&m.%s)", typeName4Go(f.type_), f.name)
+	}
+
+	return "&m." + f.name
+}
+
+//enumCheck_Go return the check rejecting a decoded value not in the id group of the field
+func enumCheck_Go(node *AstStructType, f *AstVarDecl) string {
+	return decodeCheck_Go(node, f, fmt.Sprintf("!m.%s.Valid()", f.name), "enum")
+}
+
+//strictCond_Go return the condition of a strict flags field holding undefined bits
+func strictCond_Go(f *AstVarDecl) string {
+	return fmt.Sprintf("m.%s&^%sMask != 0", f.name, camelName_Go(flagsType(f.type_).name))
+}
+
 func (interp *interpreter) intConstComment_go(val int, node AstNode) string {
 	if tp, ok := node.(*AstBinOP); ok {
 		if tp.op == LSHIFT {
@@ -64,6 +1015,9 @@ func (interp *interpreter) intConstComment_go(val int, node AstNode) string {
 		}
 	}
 
+	if val < 0 {
+		return fmt.Sprintf("-0x%x", -val)
+	}
 	return fmt.Sprintf("0x%x", val)
 }
 
@@ -74,6 +1028,9 @@ func (interp *interpreter) visitConstDef_Go(node *AstConstDef) {
 		interp.addLine("const %s = %d //%s", node.name, val,
 			interp.intConstComment_go(val, node.val))
 
+	case float64:
+		interp.addLine("const %s = %s", node.name, floatLiteral(val))
+
 	case string:
 		interp.addLine("const %s = \"%s\"", node.name, val)
 
@@ -121,6 +1078,31 @@ func typeName4Go(tp AstType) string {
 
 		case symTypeU64, symTypeV64:
 			return "uint64"
+
+		case symTypeI8:
+			return "int8"
+
+		case symTypeI16:
+			return "int16"
+
+		case symTypeI32, symTypeS32:
+			return "int32"
+
+		case symTypeI64, symTypeS64:
+			return "int64"
+
+		case symTypeF32:
+			return "float32"
+
+		case symTypeF64:
+			return "float64"
+
+		case symTypeString:
+			return "string"
+		}
+
+		if bn, ok := symTypeBits[ft.name]; ok {
+			return wordType_Go(bn)
 		}
 
 	case *AstStructType:
@@ -134,19 +1116,92 @@ func typeName4Go(tp AstType) string {
 	return ""
 }
 
+//wordType_Go return the smallest unsigned go type holding 'bits' bits
+func wordType_Go(bits int) string {
+	return fmt.Sprintf("uint%d", storageBits(bits))
+}
+
+//bitWords_Go map the first field of every bit field series to the width of its word
+func bitWords_Go(node *AstStructType) map[*AstVarDecl]int {
+	words := map[*AstVarDecl]int{}
+	for _, u := range msgFieldUnits(node) {
+		if u.bits > 0 {
+			words[u.fields[0]] = u.bits
+		}
+	}
+
+	return words
+}
+
+//bitWord_Go return the name of the variable holding a word of bit fields, 8 bits words keep the plain name
+func bitWord_Go(bits int) string {
+	if bits == 8 {
+		return "tmp"
+	}
+	return fmt.Sprintf("tmp%d", bits)
+}
+
+//putBits_Go return the statement packing a bit field into its word at shift
+func putBits_Go(f *AstVarDecl, bits int, shift int) string {
+	_, bn := isIntType(f.type_)
+	val := fmt.Sprintf("m.%s & 0x%x", f.name, 1<<bn-1)
+	if tp := wordType_Go(bits); tp != fieldType_Go(f) {
+		val = fmt.Sprintf("%s(%s)", tp, val)
+	} else if shift > 0 {
+		val = "(" + val + ")"
+	}
+
+	if shift > 0 {
+		return fmt.Sprintf("%s |= %s << %d", bitWord_Go(bits), val, shift)
+	}
+	return fmt.Sprintf("%s |= %s", bitWord_Go(bits), val)
+}
+
+//getBits_Go return the statement unpacking a bit field from its word at shift
+func getBits_Go(f *AstVarDecl, bits int, shift int) string {
+	_, bn := isIntType(f.type_)
+	val := bitWord_Go(bits)
+	if shift > 0 {
+		val = fmt.Sprintf("(%s >> %d)", val, shift)
+	}
+
+	val = fmt.Sprintf("%s & 0x%x", val, 1<<bn-1)
+	if tp := fieldType_Go(f); tp != wordType_Go(bits) {
+		val = fmt.Sprintf("%s(%s)", tp, val)
+	}
+	return fmt.Sprintf("m.%s = %s", f.name, val)
+}
+
 func (interp *interpreter) visitMsgEncode_Go(node *AstStructType) {
 	node.name = nameForMsg(node.name)
-	interp.addLine("func encode_%s(buf io.Writer, m *%s) int {", node.name, typeName4Go(node))
+	interp.addLine("func encode_%s(buf io.Writer, m *%s) error {", node.name, typeName4Go(node))
 	interp.pushStackFrame()
+	interp.addLine("w := newCountWriter(buf)")
+	interp.deriveLimits_Go(node, "w.n", "")
+	if p := node.presence; p != nil {
+		if isVarInt(p.type_) {
+			interp.addLine("if err := w.writeUvarint(\"%s\", \"%s\", m.%s); err != nil { return err }", node.name, p.name, p.name)
+		} else {
+			interp.addLine(writeField_Go(node, p.name, "m."+p.name))
+		}
+	}
+	for _, f := range node.fields {
+		if f.sized != nil {
+			interp.preEncodeSized_Go(node, f)
+		}
+	}
 
 	var notes []*AstSrcComment
 	if len(node.notes) > 0 {
 		notes = node.notes[:]
 	}
 
-	hasTmp := false
+	words := bitWords_Go(node)
+	hasTmp := map[int]bool{}
 	bitAggr := false
 	bits := 0
+	word := 0
+	bitField := ""
 	var xorVar *AstVarNameRef
 	for _, f := range node.fields {
 		for len(notes) > 0 && f.line > notes[0].line {
@@ -154,119 +1209,140 @@ func (interp *interpreter) visitMsgEncode_Go(node *AstStructType) {
 			notes = notes[1:]
 		}
 
+		if f.sized != nil {
+			interp.writeSized_Go(node, f)
+			continue
+		}
+
+		if isString(f.type_) {
+			interp.wrapExist_Go(node, f, func() {
+				interp.addLine(writeField_Go(node, f.name, encodeString_Go(f, "nil")))
+			})
+			continue
+		}
+
+		if f.untilEnd {
+			if st, ok := realType(f.type_.(*AstArrayType).elemType).(*AstStructType); ok {
+				interp.addLine("for i := range m.%s {", f.name)
+				interp.pushStackFrame()
+				interp.addLine("if err := encode_%s(w, &m.%s[i]); err != nil { return err }", st.name, f.name)
+				interp.popStackFrame()
+				interp.addLine("}")
+			} else {
+				interp.addLine(writeField_Go(node, f.name, "m."+f.name))
+			}
+			continue
+		}
+
 		switch ft := f.type_.(type) {
 		case *AstPrimType:
 			ok, bn := isIntType(ft)
-			mask := 1<<bn - 1
 			if bitAggr {
 				if !ok {
 					doPanic("msg encode in bit assemble mode error, hasTmp: %v, bitAggr: %v, bits: %d, bn: %d",
 						hasTmp, bitAggr, bits, bn)
 				}
 
-				//go on assemble to byte
+				//go on assemble to word
 				bits += bn
-				if bits <= 8 {
-					shift := 8 - bits
-					if shift == 0 {
-						interp.addLine("tmp |= m.%s & 0x%x", f.name, mask)
-					} else {
-						interp.addLine("tmp |= (m.%s & 0x%x) << %d", f.name, mask, shift)
-					}
-
-					if bits == 8 {
+				if bits <= word {
+					interp.addLine(putBits_Go(f, word, word-bits))
+					if bits == word {
 						if xorVar != nil {
-							tpAst := &AstPrimType{name: symTypeU8}
-							interp.addLine("tmp ^= %s(%s)", typeName4Go(tpAst), xorVar.name)
+							interp.addLine("%s ^= %s(%s)", bitWord_Go(word), wordType_Go(word), xorVar.name)
 						}
 
-						interp.addLine("if binary.Write(buf, binary.BigEndian, tmp) != nil { return -1 }")
+						interp.addLine(writeField_Go(node, bitField, bitWord_Go(word)))
 						interp.addNewLine()
 						bitAggr = false
 						xorVar = nil
 					}
 				} else {
-					doPanic("msg encode in bit assemble mode error, bits aggregate num: %d", bits)
+					doPanic("msg encode in bit assemble mode error, bits aggregate num: %d, word: %d", bits, word)
 				}
 			} else if ok, bn := isIntType(ft); ok {
 				if in := bn / 8; bn%8 == 0 {
 					switch in {
 					case 1, 2, 4, 8:
-						interp.wrapExist_Go(f, func() {
-							if isVarInt(ft) {
-								doPanic("var int encode is not supported in golang default style")
-								return
-							}
-
+						interp.wrapExist_Go(node, f, func() {
 							if f.max != nil {
 								interp.addNewLine()
 								interp.addLine("if m.%s > %s { m.%s = %s} ", f.name, f.max.name, f.name, f.max.name)
 							}
+							if f.min != nil {
+								interp.addLine("if m.%s < %s { m.%s = %s} ", f.name, f.min.name, f.name, f.min.name)
+							}
 							//interp.addLine("byte_buf_put_u%d(buf,  m->%s);", in*8, f.name)
-							if f.xor == nil {
-								interp.addLine("if binary.Write(buf, binary.BigEndian, m.%s) != nil { return -1 }", f.name)
+							if isVarInt(ft) {
+								interp.addLine("if err := w.write%s(\"%s\", \"%s\", %s(m.%s)); err != nil { return err }", varint_Go(ft), node.name, f.name, varintCast_Go(ft), f.name)
+							} else if f.xor == nil {
+								interp.addLine(writeField_Go(node, f.name, fieldVal_Go(f)))
 							} else {
-								interp.addLine("if binary.Write(buf, binary.BigEndian, m.%s^%s(%s)) != nil { return -1 }", f.name, typeName4Go(ft), f.xor.name)
+								interp.addLine(writeField_Go(node, f.name, fmt.Sprintf("%s^%s(%s)", fieldVal_Go(f), typeName4Go(ft), f.xor.name)))
 							}
 						})
 					default:
 						doPanic("msg encode not support int, bytes: %d", in)
 					}
 				} else {
-					if !hasTmp {
-						hasTmp = true
-						interp.addLine("tmp := uint8(0)")
+					word = words[f]
+					if !hasTmp[word] {
+						hasTmp[word] = true
+						interp.addLine("%s := %s(0)", bitWord_Go(word), wordType_Go(word))
 					} else {
-						interp.addLine("tmp = 0")
+						interp.addLine("%s = 0", bitWord_Go(word))
 					}
 
 					xorVar = f.xor
+					bitField = f.name
 					bits = bn
-					interp.addLine("tmp |= (m.%s & 0x%x) << %d", f.name, mask, 8-bits)
+					interp.addLine(putBits_Go(f, word, word-bits))
 					bitAggr = true
 				}
 
+			} else if float, _ := isFloatType(ft); float {
+				interp.wrapExist_Go(node, f, func() {
+					if f.max != nil {
+						interp.addNewLine()
+						interp.addLine("if m.%s > %s { m.%s = %s} ", f.name, f.max.name, f.name, f.max.name)
+					}
+					if f.min != nil {
+						interp.addLine("if m.%s < %s { m.%s = %s} ", f.name, f.min.name, f.name, f.min.name)
+					}
+					interp.addLine(writeField_Go(node, f.name, "m."+f.name))
+				})
 			} else {
 				doPanic("msg encode not support non int types")
 			}
 
 		case *AstStructType:
-			interp.wrapExist_Go(f, func() {
-				interp.addLine("if encode_%s(buf, &m.%s) < 0 { return -1 }", ft.name, f.name)
+			interp.wrapExist_Go(node, f, func() {
+				interp.addLine("if err := encode_%s(w, &m.%s); err != nil { return err }", ft.name, f.name)
 			})
 
 		case *AstArrayType:
-			interp.wrapExist_Go(f, func() {
+			interp.wrapExist_Go(node, f, func() {
 				if ut, ok := ft.elemType.(*AstPrimType); ok {
 					if ok, bn := isIntType(ut); ok && bn == 8 {
 						interp.addNewLine()
-						if getLimitFieldMax(node, f.limit.name) != nil {
-							interp.addLine("if binary.Write(buf, binary.BigEndian, m.%s[0:m.%s]) != nil { return -1 }", f.name, f.limit.name)
-						} else {
-							interp.addLine("if binary.Write(buf, binary.BigEndian, m.%s[0:%s]) != nil { return -1 }", f.name, f.limit.name)
-						}
+						interp.addLine(writeField_Go(node, f.name, fmt.Sprintf("m.%s[0:%s]", f.name, arrayLimitRef(node, f, "m."))))
 						return
 					}
 				}
 
 				//gen for loop
-				if getLimitFieldMax(node, f.limit.name) != nil {
-					interp.addLine("for i := 0; i < int(m.%s); i++ {", f.limit.name)
-				} else {
-					interp.addLine("for i := 0; i < int(%s); i++ {", f.limit.name)
-				}
+				interp.addLine("for i := 0; i < int(%s); i++ {", arrayLimitRef(node, f, "m."))
 				interp.pushStackFrame()
 				switch et := ft.elemType.(type) {
 				case *AstPrimType:
-					ok, bn := isIntType(et)
-					if !ok || bn%8 != 0 {
+					if bn := primBits(et); bn == 0 || bn%8 != 0 {
 						doPanic("msg encode not support non int type or type int of bits not div by 8")
 					} else {
-						interp.addLine("if binary.Write(buf, binary.BigEndian, m.%s[i]) != nil { return -1 }", f.name)
+						interp.addLine(writeField_Go(node, f.name, fmt.Sprintf("m.%s[i]", f.name)))
 					}
 
 				case *AstStructType:
-					interp.addLine("if encode_%s(buf, &m.%s[i]) < 0 { return -1 }", et.name, f.name)
+					interp.addLine("if err := encode_%s(w, &m.%s[i]); err != nil { return err }", et.name, f.name)
 
 				default:
 					doPanic("unsupported array elem type encode: %s %s", f.name, ft)
@@ -277,8 +1353,25 @@ func (interp *interpreter) visitMsgEncode_Go(node *AstStructType) {
 			})
 
 		case *AstUndefType:
-			interp.wrapExist_Go(f, func() {
-				interp.addLine("if encode_%s(buf, &m.%s) < 0 { return -1 }", ft.name, f.name)
+			interp.wrapExist_Go(node, f, func() {
+				interp.addLine("if err := encode_%s(w, &m.%s); err != nil { return err }", ft.name, f.name)
+			})
+
+		case *AstUnionType:
+			interp.wrapExist_Go(node, f, func() {
+				interp.unionSwitch_Go(f, func(tp AstType) {
+					if tp == nil {
+						interp.addLine("return %s", unionTagError_Go(node, f, "Encode", "w.n"))
+						return
+					}
+
+					interp.unionAssert_Go(node, f, tp, "w.n", "")
+					if _, ok := tp.(*AstArrayType); ok {
+						interp.addLine(writeField_Go(node, f.name, "[]byte(v)"))
+					} else {
+						interp.addLine("if err := encode_%s(w, v); err != nil { return err }", typeName4Go(tp))
+					}
+				})
 			})
 
 		default:
@@ -286,69 +1379,114 @@ func (interp *interpreter) visitMsgEncode_Go(node *AstStructType) {
 		}
 	}
 
-	interp.addLine("return 0")
+	interp.addLine("return nil")
 	interp.popStackFrame()
 	interp.addLine("}")
 }
 
 func (interp *interpreter) visitMsgDecode_Go(node *AstStructType) {
-	interp.addLine("func decode_%s(buf io.Reader, m *%s) int {", node.name, typeName4Go(node))
+	interp.addLine("func decode_%s(buf io.Reader, m *%s) error {", node.name, typeName4Go(node))
 	interp.pushStackFrame()
+	interp.addLine("r := newCountReader(buf)")
+	if p := node.presence; p != nil {
+		if isVarInt(p.type_) {
+			interp.addLine("if err := r.readUvarint64(\"%s\", \"%s\", &m.%s); err != nil { return err }", node.name, p.name, p.name)
+		} else {
+			interp.addLine(readField_Go(node, p.name, "&m."+p.name))
+		}
+		if cond := presenceCheck_Go(node); cond != "" {
+			interp.addLine(decodeCheck_Go(node, p, cond, "optional"))
+		}
+	}
 
-	hasTmp := false
+	words := bitWords_Go(node)
+	hasTmp := map[int]bool{}
 	bitAggr := false
 	bits := 0
+	word := 0
 	for _, f := range node.fields {
+		if f.sized != nil {
+			interp.addLine("sized%s := r.sized(uint64(m.%s))", f.name, f.sized.name)
+			interp.addLine("if err := decode_%s(sized%s, &m.%s); err != nil { return err }", typeName4Go(f.type_), f.name, f.name)
+			interp.addLine("if err := sized%s.skipRest(\"%s\", \"%s\"); err != nil { return err }", f.name, node.name, f.name)
+			continue
+		}
+
+		if f.untilEnd {
+			interp.decodeUntilEnd_Go(node, f)
+			continue
+		}
+
+		if isString(f.type_) {
+			interp.wrapExist_Go(node, f, func() {
+				interp.decodeString_Go(node, f)
+			})
+			continue
+		}
+
 		switch ft := f.type_.(type) {
 		case *AstPrimType:
 			ok, bn := isIntType(ft)
 			if bitAggr {
-				mask := 1<<bn - 1
 				if !ok {
 					doPanic("msg decode in bit assemble mode error, hasTmp: %v, bitAggr: %v, bits: %d, bn: %d",
 						hasTmp, bitAggr, bits, bn)
 				}
 
-				//go on assemble to byte
+				//go on split from word
 				bits += bn
-				if bits <= 8 {
-					shift := 8 - bits
-					if shift > 0 {
-						interp.addLine("m.%s = (tmp >> %d) & 0x%x;", f.name, 8-bits, mask)
-					} else {
-						interp.addLine("m.%s = tmp & 0x%x;", f.name, mask)
+				if bits <= word {
+					interp.addLine(getBits_Go(f, word, word-bits))
+					if f.equ != nil {
+						interp.addLine(decodeCheck_Go(node, f, fmt.Sprintf("m.%s != %s", f.name, f.equ.name), "equal"))
 					}
 
-					if f.equ != nil {
-						interp.addLine("if m.%s != %s return -1; ", f.name, f.equ.name)
+					if f.enumGroup != nil {
+						interp.addLine(enumCheck_Go(node, f))
 					}
 
-					if bits == 8 {
+					if f.strict {
+						interp.addLine(decodeCheck_Go(node, f, strictCond_Go(f), "flags"))
+					}
+
+					if bits == word {
 						bitAggr = false
 						bits = 0
 					}
 				} else {
-					doPanic("msg decode in bit assemble mode error, bits aggregate num: %d", bits)
+					doPanic("msg decode in bit assemble mode error, bits aggregate num: %d, word: %d", bits, word)
 				}
 			} else if ok, bn := isIntType(ft); ok {
 				if in := bn / 8; bn%8 == 0 {
 					switch in {
 					case 1, 2, 4, 8:
-						interp.wrapExist_Go(f, func() {
+						interp.wrapExist_Go(node, f, func() {
 							if isVarInt(ft) {
-								doPanic("var int encode is not supported in golang default style")
-								return
+								interp.addLine("if err := r.read%s%d(\"%s\", \"%s\", %s); err != nil { return err }", varint_Go(ft), bn, node.name, f.name, fieldRef_Go(f))
+							} else {
+								interp.addLine(readField_Go(node, f.name, fieldRef_Go(f)))
 							}
 
-							interp.addLine("if binary.Read(buf, binary.BigEndian, &m.%s) != nil { return -1 }", f.name)
 							if f.xor != nil {
-								interp.addLine("m.%s ^= %s(%s)", f.name, typeName4Go(f.type_), f.xor.name)
+								interp.addLine("m.%s ^= %s(%s)", f.name, fieldType_Go(f), f.xor.name)
 							}
 
 							if f.max != nil {
-								interp.addLine("if m.%s > %s { return -1 }", f.name, f.max.name)
+								interp.addLine(decodeCheck_Go(node, f, fmt.Sprintf("m.%s > %s", f.name, f.max.name), "max"))
 							} else if f.equ != nil {
-								interp.addLine("if m.%s != %s { return -1 }", f.name, f.equ.name)
+								interp.addLine(decodeCheck_Go(node, f, fmt.Sprintf("m.%s != %s", f.name, f.equ.name), "equal"))
+							}
+
+							if f.min != nil {
+								interp.addLine(decodeCheck_Go(node, f, fmt.Sprintf("m.%s < %s", f.name, f.min.name), "min"))
+							}
+
+							if f.enumGroup != nil {
+								interp.addLine(enumCheck_Go(node, f))
+							}
+
+							if f.strict {
+								interp.addLine(decodeCheck_Go(node, f, strictCond_Go(f), "flags"))
 							}
 						})
 
@@ -356,70 +1494,86 @@ func (interp *interpreter) visitMsgDecode_Go(node *AstStructType) {
 						doPanic("msg decode not support int, bytes: %d", in)
 					}
 				} else {
-					if !hasTmp {
-						hasTmp = true
-						interp.addLine("tmp := uint8(0)")
+					word = words[f]
+					if !hasTmp[word] {
+						hasTmp[word] = true
+						interp.addLine("%s := %s(0)", bitWord_Go(word), wordType_Go(word))
 					} else {
 						interp.addNewLine()
-						interp.addLine("tmp = 0")
+						interp.addLine("%s = 0", bitWord_Go(word))
 					}
 
 					bits = bn
-					mask := (1 << bn) - 1
-					interp.addLine("if binary.Read(buf, binary.BigEndian, &tmp) != nil { return -1 }")
+					interp.addLine(readField_Go(node, f.name, "&"+bitWord_Go(word)))
 					if f.xor != nil {
-						tpAst := &AstPrimType{name: symTypeU8}
-						interp.addLine("tmp ^= %s(%s)", typeName4Go(tpAst), f.xor.name)
+						interp.addLine("%s ^= %s(%s)", bitWord_Go(word), wordType_Go(word), f.xor.name)
 					}
 
-					interp.addLine("m.%s = (tmp >> %d) & 0x%x", f.name, 8-bits, mask)
+					interp.addLine(getBits_Go(f, word, word-bits))
 					if f.equ != nil {
-						interp.addLine("if m.%s != %s { return -1 }", f.name, f.equ.name)
+						interp.addLine(decodeCheck_Go(node, f, fmt.Sprintf("m.%s != %s", f.name, f.equ.name), "equal"))
+					}
+
+					if f.enumGroup != nil {
+						interp.addLine(enumCheck_Go(node, f))
+					}
+
+					if f.strict {
+						interp.addLine(decodeCheck_Go(node, f, strictCond_Go(f), "flags"))
 					}
 					bitAggr = true
 				}
 
+			} else if float, _ := isFloatType(ft); float {
+				interp.wrapExist_Go(node, f, func() {
+					interp.addLine(readField_Go(node, f.name, "&m."+f.name))
+					if f.max != nil {
+						interp.addLine(decodeCheck_Go(node, f, fmt.Sprintf("m.%s > %s", f.name, f.max.name), "max"))
+					} else if f.equ != nil {
+						interp.addLine(decodeCheck_Go(node, f, fmt.Sprintf("m.%s != %s", f.name, f.equ.name), "equal"))
+					}
+
+					if f.min != nil {
+						interp.addLine(decodeCheck_Go(node, f, fmt.Sprintf("m.%s < %s", f.name, f.min.name), "min"))
+					}
+				})
 			} else {
 				doPanic("msg decode not support non int types")
 			}
 
 		case *AstStructType:
-			interp.wrapExist_Go(f, func() {
-				interp.addLine("if decode_%s(buf, &m.%s) < 0 { return -1 }", ft.name, f.name)
+			interp.wrapExist_Go(node, f, func() {
+				interp.addLine("if err := decode_%s(r, &m.%s); err != nil { return err }", ft.name, f.name)
 			})
 
 		case *AstArrayType:
-			interp.wrapExist_Go(f, func() {
+			interp.wrapExist_Go(node, f, func() {
+				interp.makeSlice_Go(node, f)
 				if ut, ok := ft.elemType.(*AstPrimType); ok {
 					if ok, bn := isIntType(ut); ok && bn == 8 {
-						if getLimitFieldMax(node, f.limit.name) != nil {
-							interp.addLine("if binary.Read(buf, binary.BigEndian, m.%s[:m.%s]) != nil { return -1 }", f.name, f.limit.name)
+						if getMsgField(node, f.limit.name) != nil {
+							interp.addLine(readField_Go(node, f.name, fmt.Sprintf("m.%s[:m.%s]", f.name, f.limit.name)))
 						} else {
-							interp.addLine("if binary.Read(buf, binary.BigEndian, m.%s[:]) != nil { return -1 }", f.name)
+							interp.addLine(readField_Go(node, f.name, fmt.Sprintf("m.%s[:]", f.name)))
 						}
 						return
 					}
 				}
 
 				//gen for loop
-				if getLimitFieldMax(node, f.limit.name) != nil {
-					interp.addLine("for i := 0; i < int(m.%s); i++ {", f.limit.name)
-				} else {
-					interp.addLine("for i := 0; i < int(%s); i++ {", f.limit.name)
-				}
+				interp.addLine("for i := 0; i < int(%s); i++ {", arrayLimitRef(node, f, "m."))
 
 				interp.pushStackFrame()
 				switch et := ft.elemType.(type) {
 				case *AstPrimType:
-					ok, bn := isIntType(et)
-					if !ok || bn%8 != 0 {
+					if bn := primBits(et); bn == 0 || bn%8 != 0 {
 						doPanic("msg decode not support non int type or type int of bits not div by 8")
 					} else {
-						interp.addLine("if binary.Read(buf, binary.BigEndian, &m.%s[i]) != nil { return -1 }", f.name)
+						interp.addLine(readField_Go(node, f.name, fmt.Sprintf("&m.%s[i]", f.name)))
 					}
 
 				case *AstStructType:
-					interp.addLine("if decode_%s(buf, &m.%s[i]) < 0 { return -1 }", et.name, f.name)
+					interp.addLine("if err := decode_%s(r, &m.%s[i]); err != nil { return err }", et.name, f.name)
 
 				default:
 					doPanic("unsupported array elem type decode: %s %s", f.name, ft)
@@ -430,8 +1584,29 @@ func (interp *interpreter) visitMsgDecode_Go(node *AstStructType) {
 			})
 
 		case *AstUndefType:
-			interp.wrapExist_Go(f, func() {
-				interp.addLine("if decode_%s(buf, &m.%s) < 0 { return -1 }", ft.name, f.name)
+			interp.wrapExist_Go(node, f, func() {
+				interp.addLine("if err := decode_%s(r, &m.%s); err != nil { return err }", ft.name, f.name)
+			})
+
+		case *AstUnionType:
+			interp.wrapExist_Go(node, f, func() {
+				interp.unionSwitch_Go(f, func(tp AstType) {
+					if tp == nil {
+						interp.addLine("return %s", unionTagError_Go(node, f, "Decode", "r.n"))
+						return
+					}
+
+					if _, ok := tp.(*AstArrayType); ok {
+						interp.addLine("v, err := r.readRest(\"%s\", \"%s\")", node.name, f.name)
+						interp.addLine("if err != nil { return err }")
+						interp.addLine("m.%s = %s(v)", f.name, unionCaseType_Go(node, f, tp))
+						return
+					}
+
+					interp.addLine("v := &%s{}", typeName4Go(tp))
+					interp.addLine("if err := decode_%s(r, v); err != nil { return err }", typeName4Go(tp))
+					interp.addLine("m.%s = v", f.name)
+				})
 			})
 
 		default:
@@ -439,18 +1614,37 @@ func (interp *interpreter) visitMsgDecode_Go(node *AstStructType) {
 		}
 	}
 
-	interp.addLine("return 0")
+	if node.mend {
+		interp.addLine("return r.readEnd(\"%s\")", node.name)
+		interp.popStackFrame()
+		interp.addLine("}")
+		return
+	}
+
+	interp.addLine("return nil")
 	interp.popStackFrame()
 	interp.addLine("}")
 }
 
 func (interp *interpreter) visitMsgCodec_Go(node *AstStructType) {
+	if interp.GoAppend {
+		interp.visitMsgEncode_GoAppend(node)
+		interp.addLine("")
+		interp.visitMsgDecode_GoAppend(node)
+		return
+	}
+
 	interp.visitMsgEncode_Go(node)
 	interp.addLine("")
 	interp.visitMsgDecode_Go(node)
 }
 
 func (interp *interpreter) visitMsgDefine_Go(node *AstStructType) {
+	for _, f := range node.fields {
+		if ut, ok := f.type_.(*AstUnionType); ok {
+			interp.visitUnionType_Go(node, f, ut)
+		}
+	}
 
 	interp.addLine("")
 	interp.addLine("type %s struct {", node.name)
@@ -459,9 +1653,9 @@ func (interp *interpreter) visitMsgDefine_Go(node *AstStructType) {
 		switch ft := f.type_.(type) {
 		case *AstPrimType:
 			if f.comment != nil {
-				interp.addLine("%s %s //%s %s", f.name, typeName4Go(ft), ft.name, f.comment.value)
+				interp.addLine("%s %s //%s %s", f.name, fieldType_Go(f), ft.name, f.comment.value)
 			} else {
-				interp.addLine("%s %s //%s", f.name, typeName4Go(ft), ft.name)
+				interp.addLine("%s %s //%s", f.name, fieldType_Go(f), ft.name)
 			}
 		case *AstStructType, *AstUndefType:
 			if f.comment != nil {
@@ -470,25 +1664,237 @@ func (interp *interpreter) visitMsgDefine_Go(node *AstStructType) {
 				interp.addLine("%s %s", f.name, typeName4Go(ft))
 			}
 
+		case *AstUnionType:
+			interp.addLine("%s %s //switch %s", f.name, unionName_Go(node, f), ft.tag.name)
+
 		case *AstArrayType:
-			lm := getLimitFieldMax(node, f.limit.name)
-			if lm != nil {
-				interp.addLine("%s [%s]%s", f.name, lm.name, typeName4Go(ft.elemType))
-			} else {
-				interp.addLine("%s [%s]%s", f.name, f.limit.name, typeName4Go(ft.elemType))
-			}
+			interp.addLine("%s %s", f.name, interp.arrayType_Go(node, f))
 
 		default:
 			doPanic("unsupported type: %s %s", f.name, ft)
 		}
 	}
+	if p := node.presence; p != nil {
+		interp.addLine("%s %s //presence bits of the optional fields", p.name, typeName4Go(p.type_))
+	}
 	interp.popStackFrame()
 	interp.addLine("}")
 	interp.addLine("")
 
+	interp.visitOptionals_Go(node)
 	interp.visitMsgCodec_Go(node)
 }
 
+//arrayType_Go return the go type of an array field, a slice or an array of the limit size
+func (interp *interpreter) arrayType_Go(node *AstStructType, f *AstVarDecl) string {
+	ft := f.type_.(*AstArrayType)
+	if isSlice_Go(interp, node, f) {
+		return "[]" + typeName4Go(ft.elemType)
+	} else if lm := getLimitFieldMax(node, f.limit.name); lm != nil {
+		return fmt.Sprintf("[%s]%s", lm.name, typeName4Go(ft.elemType))
+	}
+
+	return fmt.Sprintf("[%s]%s", f.limit.name, typeName4Go(ft.elemType))
+}
+
+//visitOptionals_Go add the accessors of the optional fields, only the fields set present are encoded
+func (interp *interpreter) visitOptionals_Go(node *AstStructType) {
+	for i, f := range node.optionals {
+		tp := ""
+		switch ft := f.type_.(type) {
+		case *AstPrimType:
+			tp = fieldType_Go(f)
+		case *AstUnionType:
+			tp = unionName_Go(node, f)
+		case *AstArrayType:
+			tp = interp.arrayType_Go(node, f)
+		default:
+			tp = typeName4Go(ft)
+		}
+
+		bit := fmt.Sprintf("1<<%d", i)
+		p := node.presence.name
+		interp.addLine("func (m *%s) Has%s() bool { return m.%s&(%s) != 0 }", node.name, f.name, p, bit)
+		interp.addNewLine()
+		interp.addLine("func (m *%s) Set%s(v %s) { m.%s = v; m.%s |= %s }", node.name, f.name, tp, f.name, p, bit)
+		interp.addNewLine()
+		interp.addLine("func (m *%s) Clear%s() { m.%s &^= %s }", node.name, f.name, p, bit)
+		interp.addNewLine()
+	}
+}
+
+//presenceCheck_Go return the condition of a presence bitmap holding bits of no optional field, empty if all bits are used
+func presenceCheck_Go(node *AstStructType) string {
+	n := len(node.optionals)
+	if n == primBits(node.presence.type_) || n == 64 {
+		return ""
+	}
+
+	return fmt.Sprintf("m.%s&^0x%x != 0", node.presence.name, uint64(1)<<uint(n)-1)
+}
+
+//decodeUntilEnd_Go read the elements of an until end array from the rest of the input
+func (interp *interpreter) decodeUntilEnd_Go(node *AstStructType, f *AstVarDecl) {
+	et := f.type_.(*AstArrayType).elemType
+	interp.addLine("rest, err := r.readRest(\"%s\", \"%s\")", node.name, f.name)
+	interp.addLine("if err != nil { return err }")
+	if isByteArray(f.type_.(*AstArrayType)) {
+		interp.addLine("m.%s = rest", f.name)
+		return
+	}
+
+	interp.addLine("elems := &countReader{r: bytes.NewReader(rest), n: r.last}")
+	interp.addLine("m.%s = nil", f.name)
+	interp.addLine("for elems.n < r.n {")
+	interp.pushStackFrame()
+	interp.addLine("var v %s", typeName4Go(et))
+	if st, ok := realType(et).(*AstStructType); ok {
+		interp.addLine("if err := decode_%s(elems, &v); err != nil { return err }", st.name)
+	} else {
+		interp.addLine("if err := elems.read%s(\"%s\", \"%s\", &v); err != nil { return err }", orderSuffix_Go(node, f.name), node.name, f.name)
+	}
+	interp.addLine("m.%s = append(m.%s, v)", f.name, f.name)
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+//sizedField_Go return the message field sized by f, nil if f is not a size field
+func sizedField_Go(node *AstStructType, f *AstVarDecl) *AstVarDecl {
+	for _, sf := range node.fields {
+		if sf.sized != nil && sf.sized.name == f.name {
+			return sf
+		}
+	}
+
+	return nil
+}
+
+//sizeCheck_Go return the condition of a sized message of n bytes not fit in its size field, empty for u64
+func sizeCheck_Go(node *AstStructType, f *AstVarDecl, n string) string {
+	_, bn := isIntType(getMsgField(node, f.sized.name).type_)
+	if bn == 64 {
+		return ""
+	}
+
+	return fmt.Sprintf("uint64(%s) > 0x%x", n, uint64(1)<<uint(bn)-1)
+}
+
+//sizeError_Go return the error of a sized message of n bytes too long for its size field
+func sizeError_Go(node *AstStructType, f *AstVarDecl, off string, n string) string {
+	return fmt.Sprintf("&EncodeError{Msg: \"%s\", Field: \"%s\", Offset: %s, Reason: \"size\", Err: fmt.Errorf(\"%%d bytes over %s\", %s)}",
+		node.name, f.name, off, f.sized.name, n)
+}
+
+//preEncodeSized_Go encode a sized message into a buffer ahead, so its size field can be set before written,
+//the error is kept to the sized field to fail at the same place as the append style
+func (interp *interpreter) preEncodeSized_Go(node *AstStructType, f *AstVarDecl) {
+	sf := getMsgField(node, f.sized.name)
+	buf := "sized" + f.name
+	interp.addLine("%s := &bytes.Buffer{}", buf)
+	interp.addLine("err%s := encode_%s(%s, &m.%s)", f.name, typeName4Go(f.type_), buf, f.name)
+	interp.addLine("m.%s = %s(%s.Len())", sf.name, typeName4Go(sf.type_), buf)
+}
+
+//writeSized_Go write a sized message encoded ahead, its error offsets are shifted from the buffer to the writer
+func (interp *interpreter) writeSized_Go(node *AstStructType, f *AstVarDecl) {
+	buf := "sized" + f.name
+	interp.addLine("if err%s != nil { return nestedError(err%s, w.n) }", f.name, f.name)
+	if cond := sizeCheck_Go(node, f, buf+".Len()"); cond != "" {
+		interp.addLine("if %s { return %s }", cond, sizeError_Go(node, f, "w.n", buf+".Len()"))
+	}
+	interp.addLine(writeField_Go(node, f.name, buf+".Bytes()"))
+}
+
+//visitUnionType_Go add the interface of a union field, the case types implement it by a marker method
+func (interp *interpreter) visitUnionType_Go(node *AstStructType, f *AstVarDecl, ut *AstUnionType) {
+	name := unionName_Go(node, f)
+	interp.addNewLine()
+	interp.addLine("//%s is the %s of %s chosen by %s", name, f.name, node.name, ut.tag.name)
+	interp.addLine("type %s interface {", name)
+	interp.pushStackFrame()
+	interp.addLine("is%s()", name)
+	interp.popStackFrame()
+	interp.addLine("}")
+
+	types := []AstType{}
+	for _, c := range ut.cases {
+		types = append(types, c.type_)
+	}
+	if ut.def != nil {
+		types = append(types, ut.def)
+	}
+
+	added := map[string]bool{}
+	for _, tp := range types {
+		ct := unionCaseType_Go(node, f, tp)
+		if added[ct] {
+			continue
+		}
+
+		added[ct] = true
+		interp.addNewLine()
+		if _, ok := tp.(*AstArrayType); ok {
+			interp.addLine("//%s is the bytes of a %s case, it takes the rest of the input", ct, f.name)
+			interp.addLine("type %s []byte", ct)
+			interp.addNewLine()
+		}
+		interp.addLine("func (%s) is%s() {}", ct, name)
+	}
+}
+
+//unionName_Go return the interface type of a union field, LweMsg_Frame.Body -> LweMsg_Frame_Body
+func unionName_Go(node *AstStructType, f *AstVarDecl) string {
+	return node.name + "_" + f.name
+}
+
+//unionCaseType_Go return the go type of a union case, message cases are pointers
+func unionCaseType_Go(node *AstStructType, f *AstVarDecl, tp AstType) string {
+	if _, ok := tp.(*AstArrayType); ok {
+		return unionName_Go(node, f) + "Raw"
+	}
+
+	return "*" + typeName4Go(tp)
+}
+
+//unionSwitch_Go add the switch on the tag of a union field, body adds the code of a case type, nil for the tags without case
+func (interp *interpreter) unionSwitch_Go(f *AstVarDecl, body func(tp AstType)) {
+	ut := f.type_.(*AstUnionType)
+	interp.addLine("switch m.%s {", ut.tag.name)
+	for _, c := range ut.cases {
+		label := fmt.Sprint(c.value)
+		if ref, ok := c.label.(*AstVarNameRef); ok {
+			label = ref.name
+		}
+
+		interp.addLine("case %s:", label)
+		interp.pushStackFrame()
+		body(c.type_)
+		interp.popStackFrame()
+	}
+
+	interp.addLine("default:")
+	interp.pushStackFrame()
+	body(ut.def)
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+//unionAssert_Go add the assertion of a union field value to the case type, ret is the values returned before the error on mismatch
+func (interp *interpreter) unionAssert_Go(node *AstStructType, f *AstVarDecl, tp AstType, off string, ret string) {
+	tag := f.type_.(*AstUnionType).tag.name
+	err := fmt.Sprintf("&EncodeError{Msg: \"%s\", Field: \"%s\", Offset: %s, Reason: \"union\", Err: fmt.Errorf(\"%%T for %s %%v\", m.%s, m.%s)}",
+		node.name, f.name, off, tag, f.name, tag)
+	interp.addLine("v, ok := m.%s.(%s)", f.name, unionCaseType_Go(node, f, tp))
+	interp.addLine("if !ok { return %s%s }", ret, err)
+}
+
+//unionTagError_Go return the error of a tag without union case
+func unionTagError_Go(node *AstStructType, f *AstVarDecl, kind string, off string) string {
+	tag := f.type_.(*AstUnionType).tag.name
+	return fmt.Sprintf("&%sError{Msg: \"%s\", Field: \"%s\", Offset: %s, Reason: \"tag\", Err: fmt.Errorf(\"%s %%v\", m.%s)}",
+		kind, node.name, f.name, off, tag, tag)
+}
+
 func (interp *interpreter) visitTypeDef_Go(node *AstTypeDef) {
 	interp.addLine("type %s %s;", node.name, typeName4Go(node.impl))
 
@@ -497,7 +1903,7 @@ func (interp *interpreter) visitTypeDef_Go(node *AstTypeDef) {
 		oname := impl.name
 		impl.name = node.name
 		interp.visitMsgCodec_Go(impl)
-		node.name = oname
+		impl.name = oname
 	}
 }
 
@@ -548,7 +1954,7 @@ func visitBinOP_Go(op *AstBinOP) string {
 func (interp *interpreter) visitBindEncode_Go(binds []*AstBindDef) {
 	interp.addNewLine()
 	mspace := interp.program.mspace
-	interp.addLine(fmt.Sprint("func encode", strings.ToUpper(mspace[:1]), mspace[1:], "MsgById(buf io.Writer, mid uint16, msg interface{}) int {"))
+	interp.addLine(fmt.Sprint("func encode", strings.ToUpper(mspace[:1]), mspace[1:], "MsgById(buf io.Writer, mid uint16, msg interface{}) error {"))
 	interp.pushStackFrame()
 
 	interp.addLine("switch mid {")
@@ -561,14 +1967,14 @@ func (interp *interpreter) visitBindEncode_Go(binds []*AstBindDef) {
 		if len(bind.msgName) != 0 {
 			interp.addLine("return encode_%s(buf, msg.(*%s))", bind.msgName, bind.msgName)
 		} else {
-			interp.addLine("return 0")
+			interp.addLine("return nil")
 		}
 		interp.popStackFrame()
 	}
 	interp.addLine("}")
 
 	interp.addNewLine()
-	interp.addLine("return -1")
+	interp.addLine("return &EncodeError{Msg: fmt.Sprintf(\"msgid %%d\", mid), Reason: \"unknown id\"}")
 	interp.popStackFrame()
 	interp.addLine("}")
 	interp.addNewLine()
@@ -577,7 +1983,7 @@ func (interp *interpreter) visitBindEncode_Go(binds []*AstBindDef) {
 func (interp *interpreter) visitBindDecode_Go(binds []*AstBindDef) {
 	interp.addNewLine()
 	mspace := interp.program.mspace
-	interp.addLine(fmt.Sprint("func decode", strings.ToUpper(mspace[:1]), mspace[1:], "MsgById(buf io.Reader, mid uint16, msg interface{}) int {"))
+	interp.addLine(fmt.Sprint("func decode", strings.ToUpper(mspace[:1]), mspace[1:], "MsgById(buf io.Reader, mid uint16, msg interface{}) error {"))
 	interp.pushStackFrame()
 
 	interp.addLine("switch mid {")
@@ -590,20 +1996,25 @@ func (interp *interpreter) visitBindDecode_Go(binds []*AstBindDef) {
 		if len(bind.msgName) != 0 {
 			interp.addLine("return decode_%s(buf, msg.(*%s))", bind.msgName, bind.msgName)
 		} else {
-			interp.addLine("return 0")
+			interp.addLine("return nil")
 		}
 		interp.popStackFrame()
 	}
 	interp.addLine("}")
 
 	interp.addNewLine()
-	interp.addLine("return -1")
+	interp.addLine("return &DecodeError{Msg: fmt.Sprintf(\"msgid %%d\", mid), Reason: \"unknown id\"}")
 	interp.popStackFrame()
 	interp.addLine("}")
 	interp.addNewLine()
 }
 
 func (interp *interpreter) visitBinds_Go(binds []*AstBindDef) {
+	if interp.GoAppend {
+		interp.visitBinds_GoAppend(binds)
+		return
+	}
+
 	interp.visitBindEncode_Go(binds)
 	interp.visitBindDecode_Go(binds)
 }
@@ -0,0 +1,731 @@
+package protoc
+
+import (
+	"fmt"
+	"strings"
+)
+
+//append style of go generator: AppendX(dst []byte, m *X) []byte and UnmarshalX(b []byte, m *X) (n int, err error),
+//fields are put by byte shifts and read by binary.BigEndian/LittleEndian without reflection, the wire bytes are the same
+//as the default io.Writer/io.Reader style
+
+//appendInt_GoAppend return the statement appending an int or float value of type tp to dst, lowest byte first if le
+func appendInt_GoAppend(tp AstType, le bool, val string) string {
+	_, bn := isIntType(tp)
+	if float, fbn := isFloatType(tp); float {
+		bn = fbn
+		val = fmt.Sprintf("math.Float%dbits(%s)", bn, val)
+	}
+
+	if bn == 8 {
+		if isSigned(tp) {
+			return fmt.Sprintf("dst = append(dst, byte(%s))", val)
+		}
+		return fmt.Sprintf("dst = append(dst, %s)", val)
+	}
+
+	if strings.ContainsAny(val, "^|&") {
+		val = "(" + val + ")"
+	}
+
+	bytes := make([]string, 0, bn/8)
+	for shift := bn - 8; shift > 0; shift -= 8 {
+		bytes = append(bytes, fmt.Sprintf("byte(%s>>%d)", val, shift))
+	}
+	bytes = append(bytes, fmt.Sprintf("byte(%s)", val))
+	if le {
+		for i, j := 0, len(bytes)-1; i < j; i, j = i+1, j-1 {
+			bytes[i], bytes[j] = bytes[j], bytes[i]
+		}
+	}
+	return fmt.Sprintf("dst = append(dst, %s)", strings.Join(bytes, ", "))
+}
+
+//wordType_GoAppend return the unsigned int type of a bit fields word
+func wordType_GoAppend(bits int) AstType {
+	return &AstPrimType{name: fmt.Sprintf("u%d", bits)}
+}
+
+//readInt_GoAppend return the expression reading an int or float value of type tp at b[n:]
+func readInt_GoAppend(tp AstType, le bool) string {
+	bn := primBits(tp)
+	val := "b[n]"
+	if bn > 8 && le {
+		val = fmt.Sprintf("binary.LittleEndian.Uint%d(b[n:])", bn)
+	} else if bn > 8 {
+		val = fmt.Sprintf("binary.BigEndian.Uint%d(b[n:])", bn)
+	}
+
+	if isSigned(tp) {
+		return fmt.Sprintf("%s(%s)", typeName4Go(tp), val)
+	} else if float, _ := isFloatType(tp); float {
+		return fmt.Sprintf("math.Float%dfrombits(%s)", bn, val)
+	}
+	return val
+}
+
+func (interp *interpreter) needBytes_GoAppend(node *AstStructType, f *AstVarDecl, size string) {
+	interp.addLine("if len(b)-n < %s { return n, &DecodeError{Msg: \"%s\", Field: \"%s\", Offset: n, Reason: \"short\", Err: io.ErrUnexpectedEOF} }",
+		size, node.name, f.name)
+}
+
+//needElems_GoAppend check the bytes of count elements of size, the error is at the first element cut
+func (interp *interpreter) needElems_GoAppend(node *AstStructType, f *AstVarDecl, count string, size int) {
+	interp.addLine("if len(b)-n < %s*%d { return n, &DecodeError{Msg: \"%s\", Field: \"%s\", Offset: n + (len(b)-n)/%d*%d, Reason: \"short\", Err: io.ErrUnexpectedEOF} }",
+		count, size, node.name, f.name, size, size)
+}
+
+//checkFailed_GoAppend add the constraint check of a field which is just read in size bytes
+func (interp *interpreter) checkFailed_GoAppend(node *AstStructType, f *AstVarDecl, cond string, size int, reason string) {
+	offset := "n"
+	if size > 0 {
+		offset = fmt.Sprintf("n - %d", size)
+	}
+
+	interp.addLine("if %s { return n, &DecodeError{Msg: \"%s\", Field: \"%s\", Offset: %s, Reason: \"%s\"} }",
+		cond, node.name, f.name, offset, reason)
+}
+
+//arrayLimit_GoAppend return the element count expression of an array field
+func arrayLimit_GoAppend(node *AstStructType, f *AstVarDecl) string {
+	return fmt.Sprintf("int(%s)", arrayLimitRef(node, f, "m."))
+}
+
+//nestedFails_GoAppend check if a field appends a nested message which can fail
+func (interp *interpreter) nestedFails_GoAppend(f *AstVarDecl, seen map[*AstStructType]bool) bool {
+	tp := f.type_
+	if at, ok := tp.(*AstArrayType); ok {
+		tp = at.elemType
+	}
+
+	if ut, ok := tp.(*AstUnionType); ok {
+		for _, c := range ut.cases {
+			if st, ok := realType(c.type_).(*AstStructType); ok && interp.encodeFails_GoAppend(st, seen) {
+				return true
+			}
+		}
+		tp = ut.def
+	}
+
+	st, ok := realType(tp).(*AstStructType)
+	return ok && interp.encodeFails_GoAppend(st, seen)
+}
+
+//encodeFails_GoAppend check if a message can fail to append, by a union value not matching its tag, a sized message over its size field
+//or slices sharing a limit field of different lengths, seen breaks the recursion of messages nesting each other
+func (interp *interpreter) encodeFails_GoAppend(node *AstStructType, seen map[*AstStructType]bool) bool {
+	if fails, ok := seen[node]; ok {
+		return fails
+	}
+
+	seen[node] = len(interp.sharedSlices_Go(node)) > 0
+	for _, f := range node.fields {
+		if seen[node] {
+			break
+		}
+
+		if _, ok := f.type_.(*AstUnionType); ok {
+			seen[node] = true
+		} else if f.sized != nil && sizeCheck_Go(node, f, "0") != "" {
+			seen[node] = true
+		} else if interp.nestedFails_GoAppend(f, seen) {
+			seen[node] = true
+		}
+	}
+
+	return seen[node]
+}
+
+//appendMsg_GoAppend add the append of a nested message, passing up its error if it can fail
+func (interp *interpreter) appendMsg_GoAppend(tp AstType, val string) {
+	if st, ok := realType(tp).(*AstStructType); ok && interp.encodeFails_GoAppend(st, map[*AstStructType]bool{}) {
+		interp.addLine("if dst, err = Append%s(dst, %s); err != nil { return dst, err }", typeName4Go(tp), val)
+	} else {
+		interp.addLine("dst = Append%s(dst, %s)", typeName4Go(tp), val)
+	}
+}
+
+func (interp *interpreter) visitMsgEncode_GoAppend(node *AstStructType) {
+	fails := interp.encodeFails_GoAppend(node, map[*AstStructType]bool{})
+	if fails {
+		interp.addLine("func Append%s(dst []byte, m *%s) ([]byte, error) {", node.name, typeName4Go(node))
+	} else {
+		interp.addLine("func Append%s(dst []byte, m *%s) []byte {", node.name, typeName4Go(node))
+	}
+	interp.pushStackFrame()
+	for _, f := range node.fields {
+		if interp.nestedFails_GoAppend(f, map[*AstStructType]bool{}) {
+			interp.addLine("var err error")
+			break
+		}
+	}
+	interp.deriveLimits_Go(node, "len(dst)", "dst, ")
+	if p := node.presence; p != nil {
+		if isVarInt(p.type_) {
+			interp.addLine("dst = appendUvarint(dst, m.%s)", p.name)
+		} else {
+			interp.addLine(appendInt_GoAppend(p.type_, p.le, "m."+p.name))
+		}
+	}
+
+	var notes []*AstSrcComment
+	if len(node.notes) > 0 {
+		notes = node.notes[:]
+	}
+
+	hasTmp := map[int]bool{}
+	for _, u := range msgFieldUnits(node) {
+		for len(notes) > 0 && u.fields[0].line > notes[0].line {
+			interp.addLine("//" + notes[0].value)
+			notes = notes[1:]
+		}
+
+		if u.bits > 0 {
+			tmp := bitWord_Go(u.bits)
+			if !hasTmp[u.bits] {
+				hasTmp[u.bits] = true
+				interp.addLine("%s := %s(0)", tmp, wordType_Go(u.bits))
+			} else {
+				interp.addLine("%s = 0", tmp)
+			}
+
+			for idx, f := range u.fields {
+				interp.addLine(putBits_Go(f, u.bits, u.bitShift(idx)))
+			}
+
+			if xor := u.fields[0].xor; xor != nil {
+				interp.addLine("%s ^= %s(%s)", tmp, wordType_Go(u.bits), xor.name)
+			}
+			interp.addLine(appendInt_GoAppend(wordType_GoAppend(u.bits), u.fields[0].le, tmp))
+			interp.addNewLine()
+			continue
+		}
+
+		f := u.fields[0]
+		if sizedField_Go(node, f) != nil {
+			interp.addLine("at%s := len(dst)", f.name)
+		}
+
+		if f.sized != nil {
+			interp.appendSized_GoAppend(node, f)
+			continue
+		}
+
+		if f.untilEnd {
+			interp.appendUntilEnd_GoAppend(node, f)
+			continue
+		}
+
+		if isString(f.type_) {
+			interp.wrapExist_Go(node, f, func() {
+				interp.addLine("dst = %s", encodeString_Go(f, "dst"))
+			})
+			continue
+		}
+
+		switch ft := f.type_.(type) {
+		case *AstPrimType:
+			interp.wrapExist_Go(node, f, func() {
+				if f.max != nil {
+					interp.addNewLine()
+					interp.addLine("if m.%s > %s { m.%s = %s }", f.name, f.max.name, f.name, f.max.name)
+				}
+				if f.min != nil {
+					interp.addLine("if m.%s < %s { m.%s = %s }", f.name, f.min.name, f.name, f.min.name)
+				}
+
+				if isVarInt(ft) {
+					interp.addLine("dst = append%s(dst, %s(m.%s))", varint_Go(ft), varintCast_Go(ft), f.name)
+				} else if f.xor == nil {
+					interp.addLine(appendInt_GoAppend(ft, f.le, fieldVal_Go(f)))
+				} else {
+					interp.addLine(appendInt_GoAppend(ft, f.le, fmt.Sprintf("%s^%s(%s)", fieldVal_Go(f), typeName4Go(ft), f.xor.name)))
+				}
+			})
+
+		case *AstStructType, *AstUndefType:
+			interp.wrapExist_Go(node, f, func() {
+				interp.appendMsg_GoAppend(ft, "&m."+f.name)
+			})
+
+		case *AstUnionType:
+			interp.wrapExist_Go(node, f, func() {
+				interp.unionSwitch_Go(f, func(tp AstType) {
+					if tp == nil {
+						interp.addLine("return dst, %s", unionTagError_Go(node, f, "Encode", "len(dst)"))
+						return
+					}
+
+					interp.unionAssert_Go(node, f, tp, "len(dst)", "dst, ")
+					if _, ok := tp.(*AstArrayType); ok {
+						interp.addLine("dst = append(dst, v...)")
+					} else {
+						interp.appendMsg_GoAppend(tp, "v")
+					}
+				})
+			})
+
+		case *AstArrayType:
+			interp.wrapExist_Go(node, f, func() {
+				limit := arrayLimit_GoAppend(node, f)
+				if isByteArray(ft) {
+					interp.addNewLine()
+					interp.addLine("dst = append(dst, m.%s[:%s]...)", f.name, limit)
+					return
+				}
+
+				interp.addLine("for i := 0; i < %s; i++ {", limit)
+				interp.pushStackFrame()
+				switch et := ft.elemType.(type) {
+				case *AstPrimType:
+					interp.addLine(appendInt_GoAppend(et, f.le, fmt.Sprintf("m.%s[i]", f.name)))
+
+				case *AstStructType, *AstUndefType:
+					interp.appendMsg_GoAppend(et, fmt.Sprintf("&m.%s[i]", f.name))
+
+				default:
+					doPanic("unsupported array elem type encode: %s %s", f.name, ft)
+				}
+				interp.popStackFrame()
+				interp.addLine("}")
+				interp.addNewLine()
+			})
+
+		default:
+			doPanic("encode unsupported type: %s %s", f.name, ft)
+		}
+	}
+
+	if fails {
+		interp.addLine("return dst, nil")
+	} else {
+		interp.addLine("return dst")
+	}
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+//appendSized_GoAppend append a sized message and back-fill its byte length to the size field appended before
+func (interp *interpreter) appendSized_GoAppend(node *AstStructType, f *AstVarDecl) {
+	sf := getMsgField(node, f.sized.name)
+	start := "start" + f.name
+	interp.addLine("%s := len(dst)", start)
+	interp.appendMsg_GoAppend(f.type_, "&m."+f.name)
+	if cond := sizeCheck_Go(node, f, "len(dst)-"+start); cond != "" {
+		interp.addLine("if %s { return dst, %s }", cond, sizeError_Go(node, f, start, "len(dst)-"+start))
+	}
+
+	interp.addLine("m.%s = %s(len(dst) - %s)", sf.name, typeName4Go(sf.type_), start)
+	if bn := primBits(sf.type_); bn == 8 {
+		interp.addLine("dst[at%s] = m.%s", sf.name, sf.name)
+	} else if sf.le {
+		interp.addLine("binary.LittleEndian.PutUint%d(dst[at%s:], m.%s)", bn, sf.name, sf.name)
+	} else {
+		interp.addLine("binary.BigEndian.PutUint%d(dst[at%s:], m.%s)", bn, sf.name, sf.name)
+	}
+}
+
+//unmarshalSized_GoAppend read a sized message within its size, the input cut before the size fails after the message as the io style does
+func (interp *interpreter) unmarshalSized_GoAppend(node *AstStructType, f *AstVarDecl) {
+	sized := "sized" + f.name
+	size := fmt.Sprintf("uint64(m.%s)", f.sized.name)
+	interp.addLine("%s := b[n:]", sized)
+	interp.addLine("if uint64(len(%s)) > %s { %s = %s[:%s] }", sized, size, sized, sized, size)
+	interp.addLine("if k, err = Unmarshal%s(%s, &m.%s); err != nil { return n + k, nestedError(err, n) }", typeName4Go(f.type_), sized, f.name)
+	interp.addLine("if uint64(len(%s)) < %s { return len(b), &DecodeError{Msg: \"%s\", Field: \"%s\", Offset: len(b), Reason: \"short\", Err: io.ErrUnexpectedEOF} }",
+		sized, size, node.name, f.name)
+	interp.addLine("n += len(%s)", sized)
+}
+
+//appendUntilEnd_GoAppend append all the elements of an until end array
+func (interp *interpreter) appendUntilEnd_GoAppend(node *AstStructType, f *AstVarDecl) {
+	ft := f.type_.(*AstArrayType)
+	if isByteArray(ft) {
+		interp.addLine("dst = append(dst, m.%s...)", f.name)
+		return
+	}
+
+	if st, ok := realType(ft.elemType).(*AstStructType); ok {
+		interp.addLine("for i := range m.%s {", f.name)
+		interp.pushStackFrame()
+		interp.appendMsg_GoAppend(st, fmt.Sprintf("&m.%s[i]", f.name))
+	} else {
+		interp.addLine("for _, v := range m.%s {", f.name)
+		interp.pushStackFrame()
+		interp.addLine(appendInt_GoAppend(ft.elemType, f.le, "v"))
+	}
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+//unmarshalUntilEnd_GoAppend read the elements of an until end array up to the end of b
+func (interp *interpreter) unmarshalUntilEnd_GoAppend(node *AstStructType, f *AstVarDecl) {
+	ft := f.type_.(*AstArrayType)
+	if isByteArray(ft) {
+		interp.addLine("m.%s = append([]byte(nil), b[n:]...)", f.name)
+		interp.addLine("n = len(b)")
+		return
+	}
+
+	interp.addLine("m.%s = nil", f.name)
+	interp.addLine("for n < len(b) {")
+	interp.pushStackFrame()
+	if st, ok := realType(ft.elemType).(*AstStructType); ok {
+		interp.addLine("var v %s", st.name)
+		interp.addLine("if k, err = Unmarshal%s(b[n:], &v); err != nil { return n + k, nestedError(err, n) }", st.name)
+		interp.addLine("n += k")
+	} else {
+		size := primBits(ft.elemType) / 8
+		interp.needBytes_GoAppend(node, f, fmt.Sprint(size))
+		interp.addLine("v := %s", readInt_GoAppend(ft.elemType, f.le))
+		if size == 1 {
+			interp.addLine("n++")
+		} else {
+			interp.addLine("n += %d", size)
+		}
+	}
+	interp.addLine("m.%s = append(m.%s, v)", f.name, f.name)
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+//unmarshalString_GoAppend read a string field by its limit field, up to a NUL or of the fixed size, then check UTF-8 if required
+func (interp *interpreter) unmarshalString_GoAppend(node *AstStructType, f *AstVarDecl) {
+	size := "k"
+	if f.cstring {
+		interp.addLine("if k, err = cstring(b[n:], \"%s\", \"%s\", %s, &m.%s); err != nil { return n, nestedError(err, n) }",
+			node.name, f.name, f.max.name, f.name)
+	} else if f.fixed != nil {
+		size = f.fixed.name
+		interp.needBytes_GoAppend(node, f, size)
+		interp.addLine("m.%s = trimString(b[n:n+%s], %s)", f.name, size, stringPad_Go(f))
+	} else {
+		size = fmt.Sprintf("int(m.%s)", f.limit.name)
+		interp.needBytes_GoAppend(node, f, size)
+		interp.addLine("m.%s = string(b[n:n+%s])", f.name, size)
+	}
+
+	if f.utf8 {
+		interp.checkFailed_GoAppend(node, f, fmt.Sprintf("!utf8.ValidString(m.%s)", f.name), 0, "utf8")
+	}
+	interp.addLine("n += %s", size)
+}
+
+//hasNested_GoAppend check if a message has nested message, varint or cstring fields, which need a local to count the bytes read
+func hasNested_GoAppend(node *AstStructType) bool {
+	if node.presence != nil && isVarInt(node.presence.type_) {
+		return true
+	}
+
+	for _, f := range node.fields {
+		if isVarInt(f.type_) || f.cstring {
+			return true
+		}
+
+		tp := f.type_
+		if at, ok := tp.(*AstArrayType); ok {
+			tp = at.elemType
+		}
+
+		switch tp.(type) {
+		case *AstStructType, *AstUndefType, *AstUnionType:
+			return true
+		}
+	}
+
+	return false
+}
+
+func (interp *interpreter) visitMsgDecode_GoAppend(node *AstStructType) {
+	interp.addLine("func Unmarshal%s(b []byte, m *%s) (n int, err error) {", node.name, typeName4Go(node))
+	interp.pushStackFrame()
+
+	if hasNested_GoAppend(node) {
+		interp.addLine("k := 0")
+	}
+
+	if p := node.presence; p != nil {
+		size := 0
+		if isVarInt(p.type_) {
+			interp.addLine("if k, err = uvarint64(b[n:], \"%s\", \"%s\", &m.%s); err != nil { return n, nestedError(err, n) }", node.name, p.name, p.name)
+		} else {
+			size = primBits(p.type_) / 8
+			interp.needBytes_GoAppend(node, p, fmt.Sprint(size))
+			interp.addLine("m.%s = %s", p.name, readInt_GoAppend(p.type_, p.le))
+			if size == 1 {
+				interp.addLine("n++")
+			} else {
+				interp.addLine("n += %d", size)
+			}
+		}
+		if cond := presenceCheck_Go(node); cond != "" {
+			interp.checkFailed_GoAppend(node, p, cond, size, "optional")
+		}
+		if size == 0 {
+			interp.addLine("n += k")
+		}
+	}
+
+	hasTmp := map[int]bool{}
+	for _, u := range msgFieldUnits(node) {
+		if u.bits > 0 {
+			size := u.bits / 8
+			tmp := bitWord_Go(u.bits)
+			interp.needBytes_GoAppend(node, u.fields[0], fmt.Sprintf("%d", size))
+			op := ":="
+			if hasTmp[u.bits] {
+				op = "="
+			}
+			hasTmp[u.bits] = true
+
+			word := readInt_GoAppend(wordType_GoAppend(u.bits), u.fields[0].le)
+			if xor := u.fields[0].xor; xor != nil {
+				interp.addLine("%s %s %s ^ %s(%s)", tmp, op, word, wordType_Go(u.bits), xor.name)
+			} else {
+				interp.addLine("%s %s %s", tmp, op, word)
+			}
+
+			if size == 1 {
+				interp.addLine("n++")
+			} else {
+				interp.addLine("n += %d", size)
+			}
+
+			for idx, f := range u.fields {
+				interp.addLine(getBits_Go(f, u.bits, u.bitShift(idx)))
+				if f.equ != nil {
+					interp.checkFailed_GoAppend(node, f, fmt.Sprintf("m.%s != %s", f.name, f.equ.name), size, "equal")
+				}
+
+				if f.enumGroup != nil {
+					interp.checkFailed_GoAppend(node, f, fmt.Sprintf("!m.%s.Valid()", f.name), size, "enum")
+				}
+				if f.strict {
+					interp.checkFailed_GoAppend(node, f, strictCond_Go(f), size, "flags")
+				}
+			}
+			interp.addNewLine()
+			continue
+		}
+
+		f := u.fields[0]
+		if f.sized != nil {
+			interp.unmarshalSized_GoAppend(node, f)
+			continue
+		}
+
+		if f.untilEnd {
+			interp.unmarshalUntilEnd_GoAppend(node, f)
+			continue
+		}
+
+		if isString(f.type_) {
+			interp.wrapExist_Go(node, f, func() {
+				interp.unmarshalString_GoAppend(node, f)
+			})
+			continue
+		}
+
+		switch ft := f.type_.(type) {
+		case *AstPrimType:
+			interp.wrapExist_Go(node, f, func() {
+				bn := primBits(ft)
+				if isVarInt(ft) {
+					interp.addLine("if k, err = %s%d(b[n:], \"%s\", \"%s\", %s); err != nil { return n, nestedError(err, n) }",
+						strings.ToLower(varint_Go(ft)), bn, node.name, f.name, fieldRef_Go(f))
+					if f.max != nil {
+						interp.checkFailed_GoAppend(node, f, fmt.Sprintf("m.%s > %s", f.name, f.max.name), 0, "max")
+					} else if f.equ != nil {
+						interp.checkFailed_GoAppend(node, f, fmt.Sprintf("m.%s != %s", f.name, f.equ.name), 0, "equal")
+					}
+					if f.min != nil {
+						interp.checkFailed_GoAppend(node, f, fmt.Sprintf("m.%s < %s", f.name, f.min.name), 0, "min")
+					}
+					if f.enumGroup != nil {
+						interp.checkFailed_GoAppend(node, f, fmt.Sprintf("!m.%s.Valid()", f.name), 0, "enum")
+					}
+					if f.strict {
+						interp.checkFailed_GoAppend(node, f, strictCond_Go(f), 0, "flags")
+					}
+					interp.addLine("n += k")
+					return
+				}
+
+				interp.needBytes_GoAppend(node, f, fmt.Sprint(bn/8))
+				val := readInt_GoAppend(ft, f.le)
+				if f.xor != nil {
+					val = fmt.Sprintf("%s ^ %s(%s)", val, typeName4Go(ft), f.xor.name)
+				}
+
+				if namedType_Go(f) != "" {
+					val = fmt.Sprintf("%s(%s)", fieldType_Go(f), val)
+				}
+				interp.addLine("m.%s = %s", f.name, val)
+
+				if bn == 8 {
+					interp.addLine("n++")
+				} else {
+					interp.addLine("n += %d", bn/8)
+				}
+
+				if f.max != nil {
+					interp.checkFailed_GoAppend(node, f, fmt.Sprintf("m.%s > %s", f.name, f.max.name), bn/8, "max")
+				} else if f.equ != nil {
+					interp.checkFailed_GoAppend(node, f, fmt.Sprintf("m.%s != %s", f.name, f.equ.name), bn/8, "equal")
+				}
+				if f.min != nil {
+					interp.checkFailed_GoAppend(node, f, fmt.Sprintf("m.%s < %s", f.name, f.min.name), bn/8, "min")
+				}
+				if f.enumGroup != nil {
+					interp.checkFailed_GoAppend(node, f, fmt.Sprintf("!m.%s.Valid()", f.name), bn/8, "enum")
+				}
+				if f.strict {
+					interp.checkFailed_GoAppend(node, f, strictCond_Go(f), bn/8, "flags")
+				}
+			})
+
+		case *AstStructType, *AstUndefType:
+			interp.wrapExist_Go(node, f, func() {
+				interp.addLine("if k, err = Unmarshal%s(b[n:], &m.%s); err != nil { return n + k, nestedError(err, n) }", typeName4Go(ft), f.name)
+				interp.addLine("n += k")
+			})
+
+		case *AstUnionType:
+			interp.wrapExist_Go(node, f, func() {
+				interp.unionSwitch_Go(f, func(tp AstType) {
+					if tp == nil {
+						interp.addLine("return n, %s", unionTagError_Go(node, f, "Decode", "n"))
+						return
+					}
+
+					if _, ok := tp.(*AstArrayType); ok {
+						interp.addLine("m.%s = %s(append([]byte(nil), b[n:]...))", f.name, unionCaseType_Go(node, f, tp))
+						interp.addLine("n = len(b)")
+						return
+					}
+
+					interp.addLine("v := &%s{}", typeName4Go(tp))
+					interp.addLine("if k, err = Unmarshal%s(b[n:], v); err != nil { return n + k, nestedError(err, n) }", typeName4Go(tp))
+					interp.addLine("n += k")
+					interp.addLine("m.%s = v", f.name)
+				})
+			})
+
+		case *AstArrayType:
+			interp.wrapExist_Go(node, f, func() {
+				limit := arrayLimit_GoAppend(node, f)
+				if isByteArray(ft) {
+					interp.needBytes_GoAppend(node, f, limit)
+					interp.makeSlice_Go(node, f)
+					interp.addLine("n += copy(m.%s[:%s], b[n:])", f.name, limit)
+					return
+				}
+
+				//the io style reads 8 bits elements at once, the others one by one
+				if et, ok := ft.elemType.(*AstPrimType); ok && primBits(et) == 8 {
+					interp.needBytes_GoAppend(node, f, limit)
+				} else if ok {
+					interp.needElems_GoAppend(node, f, limit, primBits(et)/8)
+				}
+				interp.makeSlice_Go(node, f)
+
+				interp.addLine("for i := 0; i < %s; i++ {", limit)
+				interp.pushStackFrame()
+				switch et := ft.elemType.(type) {
+				case *AstPrimType:
+					bn := primBits(et)
+					interp.addLine("m.%s[i] = %s", f.name, readInt_GoAppend(et, f.le))
+					interp.addLine("n += %d", bn/8)
+
+				case *AstStructType, *AstUndefType:
+					interp.addLine("if k, err = Unmarshal%s(b[n:], &m.%s[i]); err != nil { return n + k, nestedError(err, n) }", typeName4Go(et), f.name)
+					interp.addLine("n += k")
+
+				default:
+					doPanic("unsupported array elem type decode: %s %s", f.name, ft)
+				}
+				interp.popStackFrame()
+				interp.addLine("}")
+				interp.addNewLine()
+			})
+
+		default:
+			doPanic("decode unsupported type: %s %s", f.name, ft)
+		}
+	}
+
+	if node.mend {
+		interp.addLine("if n < len(b) {")
+		interp.pushStackFrame()
+		interp.addLine("return n, &DecodeError{Msg: \"%s\", Offset: n, Reason: \"mend\", Err: fmt.Errorf(\"%%d extra bytes\", len(b)-n)}", node.name)
+		interp.popStackFrame()
+		interp.addLine("}")
+	}
+	interp.addLine("return n, nil")
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+func (interp *interpreter) visitBinds_GoAppend(binds []*AstBindDef) {
+	mspace := interp.program.mspace
+	space := fmt.Sprint(strings.ToUpper(mspace[:1]), mspace[1:])
+
+	seen := map[*AstStructType]bool{}
+	fails := map[string]bool{}
+	for _, decl := range interp.program.decl_list {
+		if st, ok := decl.(*AstStructType); ok {
+			fails[st.name] = interp.encodeFails_GoAppend(st, seen)
+		}
+	}
+
+	interp.addNewLine()
+	interp.addLine("func Append%sMsgById(dst []byte, mid uint16, msg interface{}) ([]byte, error) {", space)
+	interp.pushStackFrame()
+	interp.addLine("switch mid {")
+	for idx, bind := range binds {
+		if idx != 0 {
+			interp.addNewLine()
+		}
+		interp.addLine("case %s:", bind.msgId)
+		interp.pushStackFrame()
+		if len(bind.msgName) != 0 {
+			if fails[bind.msgName] {
+				interp.addLine("return Append%s(dst, msg.(*%s))", bind.msgName, bind.msgName)
+			} else {
+				interp.addLine("return Append%s(dst, msg.(*%s)), nil", bind.msgName, bind.msgName)
+			}
+		} else {
+			interp.addLine("return dst, nil")
+		}
+		interp.popStackFrame()
+	}
+	interp.addLine("}")
+	interp.addNewLine()
+	interp.addLine("return dst, &EncodeError{Msg: fmt.Sprintf(\"msgid %%d\", mid), Reason: \"unknown id\"}")
+	interp.popStackFrame()
+	interp.addLine("}")
+
+	interp.addNewLine()
+	interp.addLine("func Unmarshal%sMsgById(b []byte, mid uint16, msg interface{}) (int, error) {", space)
+	interp.pushStackFrame()
+	interp.addLine("switch mid {")
+	for idx, bind := range binds {
+		if idx != 0 {
+			interp.addNewLine()
+		}
+		interp.addLine("case %s:", bind.msgId)
+		interp.pushStackFrame()
+		if len(bind.msgName) != 0 {
+			interp.addLine("return Unmarshal%s(b, msg.(*%s))", bind.msgName, bind.msgName)
+		} else {
+			interp.addLine("return 0, nil")
+		}
+		interp.popStackFrame()
+	}
+	interp.addLine("}")
+	interp.addNewLine()
+	interp.addLine("return 0, &DecodeError{Msg: fmt.Sprintf(\"msgid %%d\", mid), Reason: \"unknown id\"}")
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.addNewLine()
+}
@@ -0,0 +1,880 @@
+package protoc
+
+import (
+	"fmt"
+	"strings"
+)
+
+//className_Java return the outer class name of the generated file, the file should be saved as <name>.java
+func className_Java(mspace string) string {
+	return fmt.Sprint(strings.ToUpper(mspace[:1]), mspace[1:])
+}
+
+func (interp *interpreter) visitPrelude_Java(program *AstProgram) {
+	name := className_Java(program.mspace)
+	interp.addLine("import java.nio.ByteBuffer;")
+	interp.addNewLine()
+	interp.addLine("//unsigned fields are widened: u1~u16 -> int, u32 -> long, u64 -> long(raw bits), signed fields are byte/short/int/long, f32/f64 are float/double")
+	interp.addLine("//buffers must be big endian, short buffers raise java.nio.BufferUnderflowException/BufferOverflowException")
+	interp.addLine("public final class %s {", name)
+	interp.pushStackFrame()
+	interp.addLine("private %s() {}", name)
+	interp.addNewLine()
+	interp.addLine("public static class %sException extends Exception {", name)
+	interp.pushStackFrame()
+	interp.addLine("public %sException(String msg) {", name)
+	interp.pushStackFrame()
+	interp.addLine("super(msg);")
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.addNewLine()
+
+	if hasField(program, func(f *AstVarDecl) bool { return isString(f.type_) }) {
+		for _, line := range stringCode_Java(name + "Exception") {
+			interp.addLine("%s", line)
+		}
+		interp.addNewLine()
+	}
+}
+
+//stringCode_Java return the string helpers, only emitted for messages with string fields, which are UTF-8 text on the wire
+func stringCode_Java(errName string) []string {
+	return []string{
+		"//cutString return the UTF-8 bytes of s, at most max of them, never cut in the middle of a sequence",
+		"private static byte[] cutString(String s, long max) {",
+		"    byte[] b = s.getBytes(java.nio.charset.StandardCharsets.UTF_8);",
+		"    if (b.length <= max) return b;",
+		"    int n = (int) max;",
+		"    while (n > 0 && (b[n] & 0xc0) == 0x80) n--;",
+		"    return java.util.Arrays.copyOf(b, n);",
+		"}",
+		"",
+		"private static void putCString(ByteBuffer buf, String s, int max) {",
+		"    int nul = s.indexOf('\\0');",
+		"    buf.put(cutString(nul < 0 ? s : s.substring(0, nul), max));",
+		"    buf.put((byte) 0);",
+		"}",
+		"",
+		"//putFixedString put s cut or padded to n bytes",
+		"private static void putFixedString(ByteBuffer buf, String s, int n, byte pad) {",
+		"    byte[] b = cutString(s, n);",
+		"    buf.put(b);",
+		"    for (int i = b.length; i < n; i++) buf.put(pad);",
+		"}",
+		"",
+		"private static byte[] getBytes(ByteBuffer buf, int n) {",
+		"    byte[] b = new byte[n];",
+		"    buf.get(b);",
+		"    return b;",
+		"}",
+		"",
+		"//getCString get the bytes of a string ended by a NUL, which must be within max bytes",
+		"private static byte[] getCString(ByteBuffer buf, int max, String what) throws " + errName + " {",
+		"    for (int n = 0; ; n++) {",
+		"        if (n == buf.remaining()) throw new java.nio.BufferUnderflowException();",
+		"        if (buf.get(buf.position() + n) == 0) {",
+		"            byte[] b = getBytes(buf, n);",
+		"            buf.get();",
+		"            return b;",
+		"        }",
+		"        if (n == max) throw new " + errName + "(what + \": max check failed\");",
+		"    }",
+		"}",
+		"",
+		"//getFixedString get the bytes of a fixed size string up to the first NUL and without the trailing padding",
+		"private static byte[] getFixedString(ByteBuffer buf, int n, byte pad) {",
+		"    byte[] b = getBytes(buf, n);",
+		"    int end = 0;",
+		"    while (end < n && b[end] != 0) end++;",
+		"    while (end > 0 && b[end - 1] == pad) end--;",
+		"    return java.util.Arrays.copyOf(b, end);",
+		"}",
+		"",
+		"//text return the text of UTF-8 bytes, invalid sequences are replaced by U+FFFD unless checked, which throws for them",
+		"private static String text(byte[] b, String check) throws " + errName + " {",
+		"    if (check == null) return new String(b, java.nio.charset.StandardCharsets.UTF_8);",
+		"    try {",
+		"        return java.nio.charset.StandardCharsets.UTF_8.newDecoder().decode(ByteBuffer.wrap(b)).toString();",
+		"    } catch (java.nio.charset.CharacterCodingException e) {",
+		"        throw new " + errName + "(check + \": utf8 check failed\");",
+		"    }",
+		"}",
+	}
+}
+
+func (interp *interpreter) visitEpilogue_Java(program *AstProgram) {
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+func (interp *interpreter) visitIdGroupDefine_Java(node *AstIdGroupDef) {
+	var notes []*AstSrcComment
+	if len(node.notes) > 0 {
+		notes = node.notes[:]
+	}
+
+	for idx, id := range node.items {
+		if id.base && idx > 0 {
+			interp.addNewLine()
+		}
+
+		for len(notes) > 0 && id.line > notes[0].line {
+			interp.addLine("//" + notes[0].value)
+			notes = notes[1:]
+		}
+
+		interp.addLine("public static final int %s = %d; //hex: 0x%x", id.name, id.idVal, id.idVal)
+	}
+
+	interp.addNewLine()
+	interp.addLine("public static String %s_name(int id) {", node.name)
+	interp.pushStackFrame()
+	interp.addLine("switch (id) {")
+	for _, id := range node.items {
+		interp.addLine("case %s: return \"%s\";", id.name, id.name)
+	}
+	interp.addLine("default: return null;")
+	interp.addLine("}")
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+//visitFlagsDefine_Java add the flag masks typed as the java type of the flags fields, has/set/clear helpers and the string of the set flags
+func (interp *interpreter) visitFlagsDefine_Java(node *AstFlagsDef) {
+	tn, box, suffix := typeName4Java(node.base), "Integer", ""
+	if tn == "long" {
+		box, suffix = "Long", "L"
+	}
+
+	interp.addNewLine()
+	var notes []*AstSrcComment
+	if len(node.notes) > 0 {
+		notes = node.notes[:]
+	}
+
+	for _, id := range node.items {
+		for len(notes) > 0 && id.line > notes[0].line {
+			interp.addLine("//%s", notes[0].value)
+			notes = notes[1:]
+		}
+
+		interp.addLine("public static final %s %s = 0x%x%s;", tn, id.name, uint64(1)<<uint(id.idVal), suffix)
+	}
+	interp.addLine("public static final %s %s_mask = 0x%x%s; //all defined flags", tn, node.name, flagsMask(node), suffix)
+
+	interp.addNewLine()
+	interp.addLine("//%s_has check if all flags of f are set", node.name)
+	interp.addLine("public static boolean %s_has(%s v, %s f) {", node.name, tn, tn)
+	interp.pushStackFrame()
+	interp.addLine("return (v & f) == f;")
+	interp.popStackFrame()
+	interp.addLine("}")
+
+	interp.addNewLine()
+	interp.addLine("public static %s %s_set(%s v, %s f) {", tn, node.name, tn, tn)
+	interp.pushStackFrame()
+	interp.addLine("return v | f;")
+	interp.popStackFrame()
+	interp.addLine("}")
+
+	interp.addNewLine()
+	interp.addLine("public static %s %s_clear(%s v, %s f) {", tn, node.name, tn, tn)
+	interp.pushStackFrame()
+	interp.addLine("return v & ~f;")
+	interp.popStackFrame()
+	interp.addLine("}")
+
+	interp.addNewLine()
+	interp.addLine("//%s_string list the set flags joined by '|', undefined bits are in hex", node.name)
+	interp.addLine("public static String %s_string(%s v) {", node.name, tn)
+	interp.pushStackFrame()
+	interp.addLine("StringBuilder s = new StringBuilder();")
+	for _, id := range node.items {
+		interp.addLine("if ((v & %s) != 0) s.append(\"|%s\");", id.name, id.name)
+	}
+	interp.addLine("%s rest = v & ~%s_mask;", tn, node.name)
+	interp.addLine("if (rest != 0) s.append(\"|0x\").append(%s.toHexString(rest));", box)
+	interp.addLine("return s.length() == 0 ? \"0\" : s.substring(1);")
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+func (interp *interpreter) visitConstDef_Java(node *AstConstDef) {
+	tp := interp.visitAst(node.val)
+	switch val := tp.(type) {
+	case int:
+		if val >= -1<<31 && val < 1<<31 {
+			interp.addLine("public static final int %s = %d; //%s", node.name, val,
+				interp.intConstComment_go(val, node.val))
+		} else {
+			interp.addLine("public static final long %s = %dL; //%s", node.name, val,
+				interp.intConstComment_go(val, node.val))
+		}
+
+	case float64:
+		interp.addLine("public static final double %s = %s;", node.name, floatLiteral(val))
+
+	case string:
+		interp.addLine("public static final String %s = \"%s\";", node.name, val)
+
+	default:
+		doPanic("unknown val type: %s:%T", val, val)
+	}
+}
+
+//intInfo_Java return the java type, the mask of the unsigned value and the ByteBuffer accessor suffix of an int or float type,
+//signed ints and floats need no mask
+func intInfo_Java(tp AstType) (string, string, string) {
+	if float, bn := isFloatType(tp); float && bn == 32 {
+		return "float", "", "Float"
+	} else if float {
+		return "double", "", "Double"
+	}
+
+	ok, bn := isIntType(tp)
+	if !ok || isVarInt(tp) {
+		doPanic("unsupported int type in java: %s", tp)
+	}
+
+	if isSigned(tp) {
+		switch bn {
+		case 8:
+			return "byte", "", ""
+
+		case 16:
+			return "short", "", "Short"
+
+		case 32:
+			return "int", "", "Int"
+		}
+		return "long", "", "Long"
+	}
+
+	switch {
+	case bn <= 8:
+		return "int", "0xff", ""
+
+	case bn%8 != 0:
+		//bit fields over 8 bits, u9~u31, are only packed into words
+		return "int", "", ""
+
+	case bn == 16:
+		return "int", "0xffff", "Short"
+
+	case bn == 32:
+		return "long", "0xffffffffL", "Int"
+	}
+
+	return "long", "", "Long"
+}
+
+func typeName4Java(tp AstType) string {
+	switch ft := tp.(type) {
+	case *AstPrimType:
+		if isString(ft) {
+			return "String"
+		}
+
+		tn, _, _ := intInfo_Java(ft)
+		return tn
+
+	case *AstStructType:
+		return ft.name
+
+	case *AstUndefType:
+		return ft.name
+
+	case *AstArrayType:
+		if isByteArray(ft) {
+			return "byte[]"
+		}
+		return typeName4Java(ft.elemType) + "[]"
+	}
+
+	doPanic("unsupported type in java: %s", tp)
+	return ""
+}
+
+//reverseBytes_Java return the class swapping the bytes of a ByteBuffer accessor type
+func reverseBytes_Java(acc string) string {
+	if acc == "Int" {
+		return "Integer"
+	}
+	return acc
+}
+
+//putNum_Java return the statement writing an int or float value, the buffer is big endian so le values are swapped,
+//le floats by their bits
+func putNum_Java(tp AstType, le bool, val string) string {
+	_, _, acc := intInfo_Java(tp)
+	switch acc {
+	case "":
+		return fmt.Sprintf("buf.put((byte) (%s));", val)
+
+	case "Float":
+		if le {
+			return fmt.Sprintf("buf.putInt(Integer.reverseBytes(Float.floatToRawIntBits(%s)));", val)
+		}
+
+	case "Double":
+		if le {
+			return fmt.Sprintf("buf.putLong(Long.reverseBytes(Double.doubleToRawLongBits(%s)));", val)
+		}
+
+	case "Long":
+		if le {
+			return fmt.Sprintf("buf.putLong(Long.reverseBytes(%s));", val)
+		}
+		return fmt.Sprintf("buf.putLong(%s);", val)
+	}
+
+	if le {
+		return fmt.Sprintf("buf.put%s(%s.reverseBytes((%s) (%s)));", acc, reverseBytes_Java(acc), strings.ToLower(acc), val)
+	}
+	return fmt.Sprintf("buf.put%s((%s) (%s));", acc, strings.ToLower(acc), val)
+}
+
+//getNum_Java return the expression reading an int or float value
+func getNum_Java(tp AstType, le bool) string {
+	_, mask, acc := intInfo_Java(tp)
+	get := fmt.Sprintf("buf.get%s()", acc)
+	if le && acc == "Float" {
+		return "Float.intBitsToFloat(Integer.reverseBytes(buf.getInt()))"
+	} else if le && acc == "Double" {
+		return "Double.longBitsToDouble(Long.reverseBytes(buf.getLong()))"
+	} else if le && acc != "" {
+		get = fmt.Sprintf("%s.reverseBytes(%s)", reverseBytes_Java(acc), get)
+	}
+
+	if len(mask) == 0 {
+		return get
+	}
+
+	return fmt.Sprintf("(%s & %s)", get, mask)
+}
+
+//greater_Java return the compare expression of 'val > max', unsigned for u64
+func greater_Java(tp AstType, val string, max string) string {
+	if _, bn := isIntType(tp); bn == 64 && !isSigned(tp) {
+		return fmt.Sprintf("Long.compareUnsigned(%s, %s) > 0", val, max)
+	}
+
+	return fmt.Sprintf("%s > %s", val, max)
+}
+
+//narrow_Java return a const assigned to a field of type tp, float consts are double and must be cast to a float field
+func narrow_Java(tp AstType, val string) string {
+	if float, bn := isFloatType(tp); float && bn == 32 {
+		return "(float) " + val
+	}
+	return val
+}
+
+func visitVarRef_Java(ref *AstVarNameRef) string {
+	if ref.this {
+		return fmt.Sprintf("this.%s", ref.name)
+	}
+
+	return ref.name
+}
+
+func (interp *interpreter) wrapExist_Java(f *AstVarDecl, op func()) {
+	if f.existIf != nil {
+		interp.addLine("if (%s) {", interp.traveseCond(true, f.existIf, visitVarRef_Java, visitBinOP_Go))
+		interp.pushStackFrame()
+	}
+
+	op()
+
+	if f.existIf != nil {
+		interp.popStackFrame()
+		interp.addLine("}")
+	}
+}
+
+//fieldDefault_Java return the initial value of a message field, arrays limited by a const are allocated in full
+func fieldDefault_Java(node *AstStructType, f *AstVarDecl) string {
+	switch ft := f.type_.(type) {
+	case *AstPrimType:
+		if isString(ft) {
+			return "\"\""
+		}
+
+	case *AstStructType, *AstUndefType:
+		return fmt.Sprintf("new %s()", typeName4Java(ft))
+
+	case *AstArrayType:
+		size := "0"
+		if !f.untilEnd && getMsgField(node, f.limit.name) == nil {
+			size = f.limit.name
+		}
+
+		tn := typeName4Java(ft)
+		return fmt.Sprintf("new %s%s]", tn[:len(tn)-1], size)
+	}
+
+	return ""
+}
+
+//stringPad_Java return the padding byte of a fixed size string field
+func stringPad_Java(f *AstVarDecl) string {
+	if f.padSpace {
+		return "(byte) ' '"
+	}
+	return "(byte) 0"
+}
+
+//stringLimitMax_Java return the most bytes of a string limited by a field, java arrays are indexed by int
+func stringLimitMax_Java(node *AstStructType, f *AstVarDecl) string {
+	lf := getMsgField(node, f.limit.name)
+	if _, bn := isIntType(lf.type_); lf.max == nil && bn >= 32 {
+		return "Integer.MAX_VALUE"
+	}
+	return stringLimitMax(node, f)
+}
+
+//encodeString_Java put a string field, the limit field of a limited string is already set from it
+func (interp *interpreter) encodeString_Java(f *AstVarDecl) {
+	if f.cstring {
+		interp.addLine("putCString(buf, this.%s, %s);", f.name, f.max.name)
+	} else if f.fixed != nil {
+		interp.addLine("putFixedString(buf, this.%s, %s, %s);", f.name, f.fixed.name, stringPad_Java(f))
+	} else {
+		interp.addLine("buf.put(cutString(this.%s, this.%s));", f.name, f.limit.name)
+	}
+}
+
+//decodeString_Java get a string field by its limit field, up to a NUL or of the fixed size, then check UTF-8 if required
+func (interp *interpreter) decodeString_Java(node *AstStructType, f *AstVarDecl) {
+	raw := ""
+	if f.cstring {
+		raw = fmt.Sprintf("getCString(buf, %s, \"%s.%s\")", f.max.name, node.name, f.name)
+	} else if f.fixed != nil {
+		raw = fmt.Sprintf("getFixedString(buf, %s, %s)", f.fixed.name, stringPad_Java(f))
+	} else {
+		raw = fmt.Sprintf("getBytes(buf, (int) this.%s)", f.limit.name)
+	}
+
+	check := "null"
+	if f.utf8 {
+		check = fmt.Sprintf("\"%s.%s\"", node.name, f.name)
+	}
+	interp.addLine("this.%s = text(%s, %s);", f.name, raw, check)
+}
+
+func (interp *interpreter) visitMsgEncode_Java(node *AstStructType) {
+	interp.addLine("public void encode(ByteBuffer buf) {")
+	interp.pushStackFrame()
+
+	//limit fields of strings are set from the strings cut on a rune boundary
+	for _, f := range node.fields {
+		if isString(f.type_) && f.limit != nil {
+			interp.addLine("this.%s = cutString(this.%s, %s).length;", f.limit.name, f.name, stringLimitMax_Java(node, f))
+			interp.addNewLine()
+		}
+	}
+
+	var notes []*AstSrcComment
+	if len(node.notes) > 0 {
+		notes = node.notes[:]
+	}
+
+	for _, u := range msgFieldUnits(node) {
+		for len(notes) > 0 && u.fields[0].line > notes[0].line {
+			interp.addLine("//" + notes[0].value)
+			notes = notes[1:]
+		}
+
+		if u.bits > 0 {
+			wt := typeName4Java(u.wordType())
+			interp.addLine("{")
+			interp.pushStackFrame()
+			interp.addLine("%s tmp = 0;", wt)
+			for idx, f := range u.fields {
+				_, bn := isIntType(f.type_)
+				val := fmt.Sprintf("this.%s & 0x%x", f.name, 1<<bn-1)
+				shift := u.bitShift(idx)
+				if typeName4Java(f.type_) != wt {
+					val = fmt.Sprintf("(%s) (%s)", wt, val)
+				} else if shift > 0 {
+					val = "(" + val + ")"
+				}
+
+				if shift > 0 {
+					interp.addLine("tmp |= %s << %d;", val, shift)
+				} else {
+					interp.addLine("tmp |= %s;", val)
+				}
+			}
+
+			if xor := u.fields[0].xor; xor != nil {
+				interp.addLine("tmp ^= %s;", xor.name)
+			}
+
+			if u.bits == 8 {
+				interp.addLine("buf.put((byte) tmp);")
+			} else {
+				interp.addLine(putNum_Java(u.wordType(), u.fields[0].le, "tmp"))
+			}
+			interp.popStackFrame()
+			interp.addLine("}")
+			interp.addNewLine()
+			continue
+		}
+
+		f := u.fields[0]
+		if isString(f.type_) {
+			interp.wrapExist_Java(f, func() {
+				interp.encodeString_Java(f)
+			})
+			continue
+		}
+
+		switch ft := f.type_.(type) {
+		case *AstPrimType:
+			if isVarInt(ft) {
+				doPanic("var int encode is not supported in java style")
+			}
+
+			interp.wrapExist_Java(f, func() {
+				if f.max != nil {
+					interp.addLine("if (%s) {", greater_Java(ft, "this."+f.name, f.max.name))
+					interp.pushStackFrame()
+					interp.addLine("this.%s = %s;", f.name, narrow_Java(ft, f.max.name))
+					interp.popStackFrame()
+					interp.addLine("}")
+				}
+
+				if f.min != nil {
+					interp.addLine("if (%s) {", greater_Java(ft, f.min.name, "this."+f.name))
+					interp.pushStackFrame()
+					interp.addLine("this.%s = %s;", f.name, narrow_Java(ft, f.min.name))
+					interp.popStackFrame()
+					interp.addLine("}")
+				}
+
+				if f.xor == nil {
+					interp.addLine(putNum_Java(ft, f.le, "this."+f.name))
+				} else {
+					interp.addLine(putNum_Java(ft, f.le, fmt.Sprintf("this.%s ^ %s", f.name, f.xor.name)))
+				}
+			})
+
+		case *AstStructType, *AstUndefType:
+			interp.wrapExist_Java(f, func() {
+				interp.addLine("this.%s.encode(buf);", f.name)
+			})
+
+		case *AstArrayType:
+			interp.wrapExist_Java(f, func() {
+				interp.addNewLine()
+				limit := fmt.Sprintf("this.%s.length", f.name)
+				if !f.untilEnd {
+					limit = arrayLimitRef(node, f, "this.")
+				}
+
+				if isByteArray(ft) {
+					interp.addLine("buf.put(this.%s, 0, (int) %s);", f.name, limit)
+					return
+				}
+
+				interp.addLine("for (int i = 0; i < (int) %s; i++) {", limit)
+				interp.pushStackFrame()
+				switch et := ft.elemType.(type) {
+				case *AstPrimType:
+					interp.addLine(putNum_Java(et, f.le, fmt.Sprintf("this.%s[i]", f.name)))
+
+				case *AstStructType, *AstUndefType:
+					interp.addLine("this.%s[i].encode(buf);", f.name)
+
+				default:
+					doPanic("unsupported array elem type encode: %s %s", f.name, ft)
+				}
+				interp.popStackFrame()
+				interp.addLine("}")
+				interp.addNewLine()
+			})
+
+		default:
+			doPanic("encode unsupported type: %s %s", f.name, ft)
+		}
+	}
+
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+func (interp *interpreter) decodeCheck_Java(node *AstStructType, f *AstVarDecl, cond string, desc string) {
+	interp.addLine("if (%s) {", cond)
+	interp.pushStackFrame()
+	interp.addLine("throw new %sException(\"%s.%s: %s check failed\");",
+		className_Java(interp.program.mspace), node.name, f.name, desc)
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+func (interp *interpreter) visitMsgDecode_Java(node *AstStructType) {
+	interp.addLine("public void decode(ByteBuffer buf) throws %sException {", className_Java(interp.program.mspace))
+	interp.pushStackFrame()
+
+	for _, u := range msgFieldUnits(node) {
+		if u.bits > 0 {
+			interp.addLine("{")
+			interp.pushStackFrame()
+			wt := typeName4Java(u.wordType())
+			if u.bits == 8 {
+				interp.addLine("int tmp = buf.get() & 0xff;")
+			} else {
+				interp.addLine("%s tmp = %s;", wt, getNum_Java(u.wordType(), u.fields[0].le))
+			}
+
+			if xor := u.fields[0].xor; xor != nil {
+				interp.addLine("tmp ^= %s;", xor.name)
+			}
+
+			for idx, f := range u.fields {
+				_, bn := isIntType(f.type_)
+				val := fmt.Sprintf("tmp & 0x%x", 1<<bn-1)
+				if shift := u.bitShift(idx); shift > 0 {
+					val = fmt.Sprintf("(tmp >> %d) & 0x%x", shift, 1<<bn-1)
+				}
+
+				if ft := typeName4Java(f.type_); ft != wt {
+					val = fmt.Sprintf("(%s) (%s)", ft, val)
+				}
+				interp.addLine("this.%s = %s;", f.name, val)
+
+				if f.equ != nil {
+					interp.decodeCheck_Java(node, f, fmt.Sprintf("this.%s != %s", f.name, f.equ.name), "equal")
+				}
+
+				if f.strict {
+					interp.decodeCheck_Java(node, f, fmt.Sprintf("(this.%s & ~%s_mask) != 0", f.name, flagsType(f.type_).name), "flags")
+				}
+			}
+			interp.popStackFrame()
+			interp.addLine("}")
+			interp.addNewLine()
+			continue
+		}
+
+		f := u.fields[0]
+		if isString(f.type_) {
+			interp.wrapExist_Java(f, func() {
+				interp.decodeString_Java(node, f)
+			})
+			continue
+		}
+
+		switch ft := f.type_.(type) {
+		case *AstPrimType:
+			if isVarInt(ft) {
+				doPanic("var int decode is not supported in java style")
+			}
+
+			interp.wrapExist_Java(f, func() {
+				if f.xor == nil {
+					interp.addLine("this.%s = %s;", f.name, getNum_Java(ft, f.le))
+				} else if _, mask, _ := intInfo_Java(ft); len(mask) > 0 {
+					interp.addLine("this.%s = (%s ^ %s) & %s;", f.name, getNum_Java(ft, f.le), f.xor.name, mask)
+				} else {
+					interp.addLine("this.%s = %s ^ %s;", f.name, getNum_Java(ft, f.le), f.xor.name)
+				}
+
+				if f.max != nil {
+					interp.decodeCheck_Java(node, f, greater_Java(ft, "this."+f.name, f.max.name), "max")
+				}
+
+				if f.min != nil {
+					interp.decodeCheck_Java(node, f, greater_Java(ft, f.min.name, "this."+f.name), "min")
+				}
+
+				if f.equ != nil {
+					interp.decodeCheck_Java(node, f, fmt.Sprintf("this.%s != %s", f.name, f.equ.name), "equal")
+				}
+
+				if f.strict {
+					interp.decodeCheck_Java(node, f, fmt.Sprintf("(this.%s & ~%s_mask) != 0", f.name, flagsType(f.type_).name), "flags")
+				}
+			})
+
+		case *AstStructType, *AstUndefType:
+			interp.wrapExist_Java(f, func() {
+				interp.addLine("this.%s.decode(buf);", f.name)
+			})
+
+		case *AstArrayType:
+			if f.untilEnd {
+				interp.addNewLine()
+				interp.decodeUntilEnd_Java(f, ft)
+				continue
+			}
+
+			interp.wrapExist_Java(f, func() {
+				interp.addNewLine()
+				limit := arrayLimitRef(node, f, "this.")
+				tn := typeName4Java(ft)
+				interp.addLine("this.%s = new %s(int) %s];", f.name, tn[:len(tn)-1], limit)
+				if isByteArray(ft) {
+					interp.addLine("buf.get(this.%s);", f.name)
+					return
+				}
+
+				interp.addLine("for (int i = 0; i < this.%s.length; i++) {", f.name)
+				interp.pushStackFrame()
+				switch et := ft.elemType.(type) {
+				case *AstPrimType:
+					interp.addLine("this.%s[i] = %s;", f.name, getNum_Java(et, f.le))
+
+				case *AstStructType, *AstUndefType:
+					interp.addLine("this.%s[i] = new %s();", f.name, typeName4Java(et))
+					interp.addLine("this.%s[i].decode(buf);", f.name)
+
+				default:
+					doPanic("unsupported array elem type decode: %s %s", f.name, ft)
+				}
+				interp.popStackFrame()
+				interp.addLine("}")
+				interp.addNewLine()
+			})
+
+		default:
+			doPanic("decode unsupported type: %s %s", f.name, ft)
+		}
+	}
+
+	if node.mend {
+		interp.addLine("if (buf.hasRemaining()) throw new %sException(\"%s: \" + buf.remaining() + \" extra bytes after message end\");", className_Java(interp.program.mspace), node.name)
+	}
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+//decodeUntilEnd_Java decode the elements of an until end array from the buf.remaining() bytes
+func (interp *interpreter) decodeUntilEnd_Java(f *AstVarDecl, ft *AstArrayType) {
+	switch et := ft.elemType.(type) {
+	case *AstPrimType:
+		//a trailing partial element underflows
+		n := primBits(et) / 8
+		tn := typeName4Java(ft)
+		if n == 1 {
+			interp.addLine("this.%s = new %sbuf.remaining()];", f.name, tn[:len(tn)-1])
+		} else {
+			interp.addLine("this.%s = new %s(buf.remaining() + %d) / %d];", f.name, tn[:len(tn)-1], n-1, n)
+		}
+
+		if isByteArray(ft) {
+			interp.addLine("buf.get(this.%s);", f.name)
+			return
+		}
+
+		interp.addLine("for (int i = 0; i < this.%s.length; i++) {", f.name)
+		interp.pushStackFrame()
+		interp.addLine("this.%s[i] = %s;", f.name, getNum_Java(et, f.le))
+		interp.popStackFrame()
+		interp.addLine("}")
+
+	default:
+		tn := typeName4Java(et)
+		interp.addLine("java.util.ArrayList<%s> elems = new java.util.ArrayList<>();", tn)
+		interp.addLine("while (buf.hasRemaining()) {")
+		interp.pushStackFrame()
+		interp.addLine("%s elem = new %s();", tn, tn)
+		interp.addLine("elem.decode(buf);")
+		interp.addLine("elems.add(elem);")
+		interp.popStackFrame()
+		interp.addLine("}")
+		interp.addLine("this.%s = elems.toArray(new %s[0]);", f.name, tn)
+	}
+}
+
+func (interp *interpreter) visitMsgDefine_Java(node *AstStructType) {
+	interp.addNewLine()
+	interp.addLine("public static class %s {", node.name)
+	interp.pushStackFrame()
+	for _, f := range node.fields {
+		tn := typeName4Java(f.type_)
+		def := fieldDefault_Java(node, f)
+		if len(def) > 0 {
+			def = " = " + def
+		}
+
+		switch ft := f.type_.(type) {
+		case *AstPrimType:
+			if f.comment != nil {
+				interp.addLine("public %s %s%s; //%s %s", tn, f.name, def, ft.name, f.comment.value)
+			} else {
+				interp.addLine("public %s %s%s; //%s", tn, f.name, def, ft.name)
+			}
+
+		default:
+			if f.comment != nil {
+				interp.addLine("public %s %s%s; //%s", tn, f.name, def, f.comment.value)
+			} else {
+				interp.addLine("public %s %s%s;", tn, f.name, def)
+			}
+		}
+	}
+
+	interp.addNewLine()
+	interp.visitMsgEncode_Java(node)
+	interp.addNewLine()
+	interp.visitMsgDecode_Java(node)
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+func (interp *interpreter) visitTypeDef_Java(node *AstTypeDef) {
+	if node.impl.astType() != AST_TP_Struct {
+		doPanic("type alias \"%s\" of non struct type is not supported in java style", node.name)
+	}
+
+	//java has no type alias, derive the codec from the message class
+	interp.addNewLine()
+	interp.addLine("public static class %s extends %s {}", node.name, typeName4Java(node.impl))
+}
+
+func (interp *interpreter) visitBinds_Java(binds []*AstBindDef) {
+	space := className_Java(interp.program.mspace)
+
+	interp.addNewLine()
+	interp.addLine("public static void encode%sMsgById(ByteBuffer buf, int mid, Object msg) throws %sException {", space, space)
+	interp.pushStackFrame()
+	interp.addLine("switch (mid) {")
+	for _, bind := range binds {
+		if len(bind.msgName) != 0 {
+			interp.addLine("case %s: ((%s) msg).encode(buf); return;", bind.msgId, bind.msgName)
+		} else {
+			interp.addLine("case %s: return;", bind.msgId)
+		}
+	}
+	interp.addLine("default: throw new %sException(\"unknown message id: \" + mid);", space)
+	interp.addLine("}")
+	interp.popStackFrame()
+	interp.addLine("}")
+
+	interp.addNewLine()
+	interp.addLine("//return null for message id without message body")
+	interp.addLine("public static Object decode%sMsgById(ByteBuffer buf, int mid) throws %sException {", space, space)
+	interp.pushStackFrame()
+	interp.addLine("switch (mid) {")
+	for _, bind := range binds {
+		if len(bind.msgName) != 0 {
+			interp.addLine("case %s: {", bind.msgId)
+			interp.pushStackFrame()
+			interp.addLine("%s m = new %s();", bind.msgName, bind.msgName)
+			interp.addLine("m.decode(buf);")
+			interp.addLine("return m;")
+			interp.popStackFrame()
+			interp.addLine("}")
+		} else {
+			interp.addLine("case %s: return null;", bind.msgId)
+		}
+	}
+	interp.addLine("default: throw new %sException(\"unknown message id: \" + mid);", space)
+	interp.addLine("}")
+	interp.popStackFrame()
+	interp.addLine("}")
+}
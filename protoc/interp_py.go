@@ -0,0 +1,778 @@
+package protoc
+
+import (
+	"fmt"
+	"strings"
+)
+
+func errorName_Py(mspace string) string {
+	return fmt.Sprint(strings.ToUpper(mspace[:1]), mspace[1:], "Error")
+}
+
+//addDefSpace_Py keep two blank lines around top level definitions
+func (interp *interpreter) addDefSpace_Py() {
+	for interp.blankLines < 2 {
+		interp.addLine("")
+	}
+}
+
+//stringCode_Py return the string helpers, only emitted for messages with string fields
+func stringCode_Py(errName string) []string {
+	return []string{
+		"def _cut_str(s, max):",
+		"    \"\"\"return the UTF-8 bytes of s, at most max of them, never cut in the middle of a sequence\"\"\"",
+		"    b = s.encode(\"utf-8\")",
+		"    if len(b) <= max:",
+		"        return b",
+		"    n = max",
+		"    while n > 0 and b[n] & 0xc0 == 0x80:",
+		"        n -= 1",
+		"    return b[:n]",
+		"",
+		"",
+		"def _put_cstr(buf, s, max):",
+		"    buf.extend(_cut_str(s.split(\"\\0\", 1)[0], max))",
+		"    buf.append(0)",
+		"",
+		"",
+		"def _put_fixed(buf, s, n, pad):",
+		"    b = _cut_str(s, n)",
+		"    buf.extend(b)",
+		"    buf.extend(bytes([pad]) * (n - len(b)))",
+		"",
+		"",
+		"def _take_cstr(buf, off, max, what):",
+		"    \"\"\"take the bytes of a string ended by a NUL, which must be within max bytes\"\"\"",
+		"    end = buf.find(b\"\\0\", off, off + max + 1)",
+		"    if end < 0 and len(buf) - off > max:",
+		"        raise " + errName + "(\"%s: max check failed\" % what)",
+		"    if end < 0:",
+		"        raise " + errName + "(\"short buffer: no NUL after offset %d\" % off)",
+		"    return bytes(buf[off:end]), end + 1",
+		"",
+		"",
+		"def _trim_str(b, pad):",
+		"    \"\"\"return the bytes of a fixed size string up to the first NUL and without the trailing padding\"\"\"",
+		"    return b.split(b\"\\0\", 1)[0].rstrip(bytes([pad]))",
+		"",
+		"",
+		"def _text(b, check=None):",
+		"    \"\"\"return the text of UTF-8 bytes, invalid sequences are replaced by U+FFFD unless checked, which raises for them\"\"\"",
+		"    if check is None:",
+		"        return b.decode(\"utf-8\", \"replace\")",
+		"    try:",
+		"        return b.decode(\"utf-8\")",
+		"    except UnicodeDecodeError:",
+		"        raise " + errName + "(\"%s: utf8 check failed\" % check) from None",
+	}
+}
+
+func (interp *interpreter) visitPrelude_Py(program *AstProgram) {
+	errName := errorName_Py(program.mspace)
+	interp.addLine("from __future__ import annotations")
+	interp.addNewLine()
+	interp.addLine("import struct")
+	interp.addLine("from dataclasses import dataclass, field")
+	interp.addLine("from typing import List")
+
+	interp.addDefSpace_Py()
+	interp.addLine("class %s(Exception):", errName)
+	interp.pushStackFrame()
+	interp.addLine("pass")
+	interp.popStackFrame()
+
+	interp.addDefSpace_Py()
+	interp.addLine("def _unpack(fmt, buf, off):")
+	interp.pushStackFrame()
+	interp.addLine("size = struct.calcsize(fmt)")
+	interp.addLine("if off + size > len(buf):")
+	interp.pushStackFrame()
+	interp.addLine("raise %s(\"short buffer: need %%d bytes at offset %%d\" %% (size, off))", errName)
+	interp.popStackFrame()
+	interp.addLine("return struct.unpack_from(fmt, buf, off)[0], off + size")
+	interp.popStackFrame()
+
+	interp.addDefSpace_Py()
+	interp.addLine("def _take(buf, off, n):")
+	interp.pushStackFrame()
+	interp.addLine("if off + n > len(buf):")
+	interp.pushStackFrame()
+	interp.addLine("raise %s(\"short buffer: need %%d bytes at offset %%d\" %% (n, off))", errName)
+	interp.popStackFrame()
+	interp.addLine("return bytes(buf[off:off + n]), off + n")
+	interp.popStackFrame()
+
+	interp.addDefSpace_Py()
+	interp.addLine("def _put_bytes(buf, data, n):")
+	interp.pushStackFrame()
+	interp.addLine("if len(data) < n:")
+	interp.pushStackFrame()
+	interp.addLine("raise %s(\"not enough bytes: need %%d, has %%d\" %% (n, len(data)))", errName)
+	interp.popStackFrame()
+	interp.addLine("buf.extend(data[:n])")
+	interp.popStackFrame()
+
+	if hasField(program, func(f *AstVarDecl) bool { return isString(f.type_) }) {
+		interp.addDefSpace_Py()
+		for _, line := range stringCode_Py(errName) {
+			interp.addLine("%s", line)
+		}
+	}
+	interp.addDefSpace_Py()
+}
+
+func (interp *interpreter) visitIdGroupDefine_Py(node *AstIdGroupDef) {
+	var notes []*AstSrcComment
+	if len(node.notes) > 0 {
+		notes = node.notes[:]
+	}
+
+	for idx, id := range node.items {
+		if id.base && idx > 0 {
+			interp.addNewLine()
+		}
+
+		for len(notes) > 0 && id.line > notes[0].line {
+			interp.addLine("#" + notes[0].value)
+			notes = notes[1:]
+		}
+
+		interp.addLine("%s = %d  # hex: 0x%x", id.name, id.idVal, id.idVal)
+	}
+
+	interp.addNewLine()
+	interp.addLine("%s_names = {", node.name)
+	interp.pushStackFrame()
+	for _, id := range node.items {
+		interp.addLine("%s: \"%s\",", id.name, id.name)
+	}
+	interp.popStackFrame()
+	interp.addLine("}")
+
+	interp.addDefSpace_Py()
+	interp.addLine("def %s_name(id):", node.name)
+	interp.pushStackFrame()
+	interp.addLine("return %s_names.get(id)", node.name)
+	interp.popStackFrame()
+	interp.addDefSpace_Py()
+}
+
+//visitFlagsDefine_Py add the flags type alias with typed masks, has/set/clear helpers and the string of the set flags
+func (interp *interpreter) visitFlagsDefine_Py(node *AstFlagsDef) {
+	interp.addLine("%s = int", node.name)
+	interp.addNewLine()
+
+	var notes []*AstSrcComment
+	if len(node.notes) > 0 {
+		notes = node.notes[:]
+	}
+
+	for _, id := range node.items {
+		for len(notes) > 0 && id.line > notes[0].line {
+			interp.addLine("#%s", notes[0].value)
+			notes = notes[1:]
+		}
+
+		interp.addLine("%s: %s = 0x%x", id.name, node.name, uint64(1)<<uint(id.idVal))
+	}
+	interp.addLine("%s_mask: %s = 0x%x  # all defined flags", node.name, node.name, flagsMask(node))
+
+	interp.addDefSpace_Py()
+	interp.addLine("# %s_has check if all flags of f are set", node.name)
+	interp.addLine("def %s_has(v: %s, f: %s) -> bool:", node.name, node.name, node.name)
+	interp.pushStackFrame()
+	interp.addLine("return v & f == f")
+	interp.popStackFrame()
+
+	interp.addDefSpace_Py()
+	interp.addLine("def %s_set(v: %s, f: %s) -> %s:", node.name, node.name, node.name, node.name)
+	interp.pushStackFrame()
+	interp.addLine("return v | f")
+	interp.popStackFrame()
+
+	interp.addDefSpace_Py()
+	interp.addLine("def %s_clear(v: %s, f: %s) -> %s:", node.name, node.name, node.name, node.name)
+	interp.pushStackFrame()
+	interp.addLine("return v & ~f")
+	interp.popStackFrame()
+
+	interp.addDefSpace_Py()
+	interp.addLine("# %s_string list the set flags joined by '|', undefined bits are in hex", node.name)
+	interp.addLine("def %s_string(v: %s) -> str:", node.name, node.name)
+	interp.pushStackFrame()
+	interp.addLine("names = []")
+	for _, id := range node.items {
+		interp.addLine("if v & %s:", id.name)
+		interp.pushStackFrame()
+		interp.addLine("names.append(\"%s\")", id.name)
+		interp.popStackFrame()
+	}
+	interp.addLine("if v & ~%s_mask:", node.name)
+	interp.pushStackFrame()
+	interp.addLine("names.append(\"0x%%x\" %% (v & ~%s_mask))", node.name)
+	interp.popStackFrame()
+	interp.addLine("return \"|\".join(names) or \"0\"")
+	interp.popStackFrame()
+	interp.addDefSpace_Py()
+}
+
+func (interp *interpreter) visitConstDef_Py(node *AstConstDef) {
+	tp := interp.visitAst(node.val)
+	switch val := tp.(type) {
+	case int:
+		interp.addLine("%s = %d  # %s", node.name, val,
+			interp.intConstComment_go(val, node.val))
+
+	case float64:
+		interp.addLine("%s = %s", node.name, floatLiteral(val))
+
+	case string:
+		interp.addLine("%s = \"%s\"", node.name, val)
+
+	default:
+		doPanic("unknown val type: %s:%T", val, val)
+	}
+}
+
+//structFormat_Py return the struct module format of a byte aligned int or float type, little endian if le
+func structFormat_Py(tp AstType, le bool) string {
+	order := ">"
+	if le {
+		order = "<"
+	}
+
+	if float, bn := isFloatType(tp); float {
+		if bn == 32 {
+			return order + "f"
+		}
+		return order + "d"
+	}
+
+	ok, bn := isIntType(tp)
+	if !ok || isVarInt(tp) {
+		doPanic("unsupported int type in python: %s", tp)
+	}
+
+	//signed formats are the lower case of the unsigned ones
+	format := ""
+	switch bn {
+	case 8:
+		format = "B"
+
+	case 16:
+		format = "H"
+
+	case 32:
+		format = "I"
+
+	case 64:
+		format = "Q"
+	}
+
+	if format == "" {
+		doPanic("int type not aligned to byte in python: %s", tp)
+	} else if isSigned(tp) {
+		format = strings.ToLower(format)
+	}
+	return order + format
+}
+
+func typeName4Py(tp AstType) string {
+	switch ft := tp.(type) {
+	case *AstPrimType:
+		if ok, _ := isIntType(ft); ok {
+			return "int"
+		} else if float, _ := isFloatType(ft); float {
+			return "float"
+		}
+
+	case *AstStructType:
+		return ft.name
+
+	case *AstUndefType:
+		return ft.name
+
+	case *AstArrayType:
+		if isByteArray(ft) {
+			return "bytes"
+		}
+		return fmt.Sprintf("List[%s]", typeName4Py(ft.elemType))
+	}
+
+	doPanic("unsupported type in python: %s", tp)
+	return ""
+}
+
+func visitVarRef_Py(ref *AstVarNameRef) string {
+	if ref.this {
+		return fmt.Sprintf("m.%s", ref.name)
+	}
+
+	return ref.name
+}
+
+func visitBinOP_Py(op *AstBinOP) string {
+	switch op.op {
+	case AND:
+		return "and"
+
+	case OR:
+		return "or"
+	}
+
+	return visitBinOP_Go(op)
+}
+
+func (interp *interpreter) wrapExist_Py(f *AstVarDecl, op func()) {
+	if f.existIf != nil {
+		interp.addLine("if %s:", interp.traveseCond(true, f.existIf, visitVarRef_Py, visitBinOP_Py))
+		interp.pushStackFrame()
+	}
+
+	op()
+
+	if f.existIf != nil {
+		interp.popStackFrame()
+	}
+}
+
+//stringPad_Py return the padding byte of a fixed size string field
+func stringPad_Py(f *AstVarDecl) string {
+	if f.padSpace {
+		return "0x20"
+	}
+	return "0"
+}
+
+//encodeString_Py put a string field, the limit field of a limited string is already set from it
+func (interp *interpreter) encodeString_Py(f *AstVarDecl) {
+	if f.cstring {
+		interp.addLine("_put_cstr(buf, m.%s, %s)", f.name, f.max.name)
+	} else if f.fixed != nil {
+		interp.addLine("_put_fixed(buf, m.%s, %s, %s)", f.name, f.fixed.name, stringPad_Py(f))
+	} else {
+		interp.addLine("buf.extend(_cut_str(m.%s, m.%s))", f.name, f.limit.name)
+	}
+}
+
+//decodeString_Py take a string field by its limit field, up to a NUL or of the fixed size, then check UTF-8 if required
+func (interp *interpreter) decodeString_Py(node *AstStructType, f *AstVarDecl) {
+	raw := "raw"
+	if f.cstring {
+		interp.addLine("raw, off = _take_cstr(buf, off, %s, \"%s.%s\")", f.max.name, node.name, f.name)
+	} else if f.fixed != nil {
+		interp.addLine("raw, off = _take(buf, off, %s)", f.fixed.name)
+		raw = fmt.Sprintf("_trim_str(raw, %s)", stringPad_Py(f))
+	} else {
+		interp.addLine("raw, off = _take(buf, off, m.%s)", f.limit.name)
+	}
+
+	if f.utf8 {
+		interp.addLine("m.%s = _text(%s, \"%s.%s\")", f.name, raw, node.name, f.name)
+	} else {
+		interp.addLine("m.%s = _text(%s)", f.name, raw)
+	}
+}
+
+func (interp *interpreter) visitMsgEncode_Py(node *AstStructType) {
+	interp.addLine("def encode_%s(buf: bytearray, m: %s) -> None:", node.name, node.name)
+	interp.pushStackFrame()
+
+	//limit fields of strings are set from the strings cut on a rune boundary
+	for _, f := range node.fields {
+		if isString(f.type_) && f.limit != nil {
+			interp.addLine("m.%s = len(_cut_str(m.%s, %s))", f.limit.name, f.name, stringLimitMax(node, f))
+			interp.addNewLine()
+		}
+	}
+
+	var notes []*AstSrcComment
+	if len(node.notes) > 0 {
+		notes = node.notes[:]
+	}
+
+	units := msgFieldUnits(node)
+	for _, u := range units {
+		for len(notes) > 0 && u.fields[0].line > notes[0].line {
+			interp.addLine("#" + notes[0].value)
+			notes = notes[1:]
+		}
+
+		if u.bits > 0 {
+			interp.addLine("tmp = 0")
+			for idx, f := range u.fields {
+				_, bn := isIntType(f.type_)
+				mask := 1<<bn - 1
+				if shift := u.bitShift(idx); shift > 0 {
+					interp.addLine("tmp |= (m.%s & 0x%x) << %d", f.name, mask, shift)
+				} else {
+					interp.addLine("tmp |= m.%s & 0x%x", f.name, mask)
+				}
+			}
+
+			if xor := u.fields[0].xor; xor != nil {
+				interp.addLine("tmp ^= %s & 0x%x", xor.name, uint64(1)<<uint(u.bits)-1)
+			}
+			interp.addLine("buf.extend(struct.pack(\"%s\", tmp))", structFormat_Py(u.wordType(), u.fields[0].le))
+			interp.addNewLine()
+			continue
+		}
+
+		f := u.fields[0]
+		if isString(f.type_) {
+			interp.wrapExist_Py(f, func() {
+				interp.encodeString_Py(f)
+			})
+			continue
+		}
+
+		switch ft := f.type_.(type) {
+		case *AstPrimType:
+			if isVarInt(ft) {
+				doPanic("var int encode is not supported in python style")
+			}
+
+			interp.wrapExist_Py(f, func() {
+				if f.max != nil {
+					interp.addNewLine()
+					interp.addLine("if m.%s > %s:", f.name, f.max.name)
+					interp.pushStackFrame()
+					interp.addLine("m.%s = %s", f.name, f.max.name)
+					interp.popStackFrame()
+				}
+
+				if f.min != nil {
+					interp.addLine("if m.%s < %s:", f.name, f.min.name)
+					interp.pushStackFrame()
+					interp.addLine("m.%s = %s", f.name, f.min.name)
+					interp.popStackFrame()
+				}
+
+				if f.xor == nil {
+					interp.addLine("buf.extend(struct.pack(\"%s\", m.%s))", structFormat_Py(ft, f.le), f.name)
+				} else {
+					_, bn := isIntType(ft)
+					interp.addLine("buf.extend(struct.pack(\"%s\", (m.%s ^ %s) & 0x%x))", structFormat_Py(ft, f.le), f.name, f.xor.name, uint64(1)<<uint(bn)-1)
+				}
+			})
+
+		case *AstStructType, *AstUndefType:
+			interp.wrapExist_Py(f, func() {
+				interp.addLine("encode_%s(buf, m.%s)", typeName4Py(ft), f.name)
+			})
+
+		case *AstArrayType:
+			interp.wrapExist_Py(f, func() {
+				limit := fmt.Sprintf("len(m.%s)", f.name)
+				if !f.untilEnd {
+					limit = arrayLimitRef(node, f, "m.")
+				}
+
+				if isByteArray(ft) {
+					interp.addNewLine()
+					interp.addLine("_put_bytes(buf, m.%s, %s)", f.name, limit)
+					return
+				}
+
+				interp.addLine("for i in range(%s):", limit)
+				interp.pushStackFrame()
+				switch et := ft.elemType.(type) {
+				case *AstPrimType:
+					interp.addLine("buf.extend(struct.pack(\"%s\", m.%s[i]))", structFormat_Py(et, f.le), f.name)
+
+				case *AstStructType, *AstUndefType:
+					interp.addLine("encode_%s(buf, m.%s[i])", typeName4Py(et), f.name)
+
+				default:
+					doPanic("unsupported array elem type encode: %s %s", f.name, ft)
+				}
+				interp.popStackFrame()
+				interp.addNewLine()
+			})
+
+		default:
+			doPanic("encode unsupported type: %s %s", f.name, ft)
+		}
+	}
+
+	if len(units) == 0 {
+		interp.addLine("pass")
+	}
+	interp.popStackFrame()
+}
+
+func (interp *interpreter) decodeCheck_Py(node *AstStructType, f *AstVarDecl, cond string, desc string) {
+	interp.addLine("if %s:", cond)
+	interp.pushStackFrame()
+	interp.addLine("raise %s(\"%s.%s: %s check failed\")", errorName_Py(interp.program.mspace), node.name, f.name, desc)
+	interp.popStackFrame()
+}
+
+func (interp *interpreter) visitMsgDecode_Py(node *AstStructType) {
+	interp.addLine("def decode_%s(buf: bytes, off: int, m: %s) -> int:", node.name, node.name)
+	interp.pushStackFrame()
+
+	for _, u := range msgFieldUnits(node) {
+		if u.bits > 0 {
+			interp.addLine("tmp, off = _unpack(\"%s\", buf, off)", structFormat_Py(u.wordType(), u.fields[0].le))
+			if xor := u.fields[0].xor; xor != nil {
+				interp.addLine("tmp ^= %s & 0x%x", xor.name, uint64(1)<<uint(u.bits)-1)
+			}
+
+			for idx, f := range u.fields {
+				_, bn := isIntType(f.type_)
+				mask := 1<<bn - 1
+				if shift := u.bitShift(idx); shift > 0 {
+					interp.addLine("m.%s = (tmp >> %d) & 0x%x", f.name, shift, mask)
+				} else {
+					interp.addLine("m.%s = tmp & 0x%x", f.name, mask)
+				}
+
+				if f.equ != nil {
+					interp.decodeCheck_Py(node, f, fmt.Sprintf("m.%s != %s", f.name, f.equ.name), "equal")
+				}
+
+				if f.strict {
+					interp.decodeCheck_Py(node, f, fmt.Sprintf("m.%s & ~%s_mask", f.name, flagsType(f.type_).name), "flags")
+				}
+			}
+			interp.addNewLine()
+			continue
+		}
+
+		f := u.fields[0]
+		if isString(f.type_) {
+			interp.wrapExist_Py(f, func() {
+				interp.decodeString_Py(node, f)
+			})
+			continue
+		}
+
+		switch ft := f.type_.(type) {
+		case *AstPrimType:
+			if isVarInt(ft) {
+				doPanic("var int decode is not supported in python style")
+			}
+
+			interp.wrapExist_Py(f, func() {
+				interp.addLine("m.%s, off = _unpack(\"%s\", buf, off)", f.name, structFormat_Py(ft, f.le))
+				if f.xor != nil {
+					_, bn := isIntType(ft)
+					interp.addLine("m.%s = (m.%s ^ %s) & 0x%x", f.name, f.name, f.xor.name, uint64(1)<<uint(bn)-1)
+				}
+
+				if f.max != nil {
+					interp.decodeCheck_Py(node, f, fmt.Sprintf("m.%s > %s", f.name, f.max.name), "max")
+				}
+
+				if f.min != nil {
+					interp.decodeCheck_Py(node, f, fmt.Sprintf("m.%s < %s", f.name, f.min.name), "min")
+				}
+
+				if f.equ != nil {
+					interp.decodeCheck_Py(node, f, fmt.Sprintf("m.%s != %s", f.name, f.equ.name), "equal")
+				}
+
+				if f.strict {
+					interp.decodeCheck_Py(node, f, fmt.Sprintf("m.%s & ~%s_mask", f.name, flagsType(f.type_).name), "flags")
+				}
+			})
+
+		case *AstStructType, *AstUndefType:
+			interp.wrapExist_Py(f, func() {
+				interp.addLine("off = decode_%s(buf, off, m.%s)", typeName4Py(ft), f.name)
+			})
+
+		case *AstArrayType:
+			if f.untilEnd && isByteArray(ft) {
+				interp.addLine("m.%s, off = _take(buf, off, len(buf) - off)", f.name)
+				continue
+			}
+
+			interp.wrapExist_Py(f, func() {
+				if isByteArray(ft) {
+					interp.addLine("m.%s, off = _take(buf, off, %s)", f.name, arrayLimitRef(node, f, "m."))
+					return
+				}
+
+				interp.addLine("m.%s = []", f.name)
+				if f.untilEnd {
+					//elements are taken up to the end of buf
+					interp.addLine("while off < len(buf):")
+				} else {
+					interp.addLine("for i in range(%s):", arrayLimitRef(node, f, "m."))
+				}
+				interp.pushStackFrame()
+				switch et := ft.elemType.(type) {
+				case *AstPrimType:
+					interp.addLine("elem, off = _unpack(\"%s\", buf, off)", structFormat_Py(et, f.le))
+
+				case *AstStructType, *AstUndefType:
+					interp.addLine("elem = %s()", typeName4Py(et))
+					interp.addLine("off = decode_%s(buf, off, elem)", typeName4Py(et))
+
+				default:
+					doPanic("unsupported array elem type decode: %s %s", f.name, ft)
+				}
+				interp.addLine("m.%s.append(elem)", f.name)
+				interp.popStackFrame()
+				interp.addNewLine()
+			})
+
+		default:
+			doPanic("decode unsupported type: %s %s", f.name, ft)
+		}
+	}
+
+	if node.mend {
+		interp.addLine("if off < len(buf):")
+		interp.pushStackFrame()
+		interp.addLine("raise %s(\"%s: %%d extra bytes after message end\" %% (len(buf) - off))", errorName_Py(interp.program.mspace), node.name)
+		interp.popStackFrame()
+	}
+	interp.addLine("return off")
+	interp.popStackFrame()
+}
+
+func (interp *interpreter) visitMsgCodec_Py(node *AstStructType) {
+	interp.addDefSpace_Py()
+	interp.visitMsgEncode_Py(node)
+	interp.addDefSpace_Py()
+	interp.visitMsgDecode_Py(node)
+	interp.addDefSpace_Py()
+}
+
+func (interp *interpreter) visitMsgDefine_Py(node *AstStructType) {
+	interp.addDefSpace_Py()
+	interp.addLine("@dataclass")
+	interp.addLine("class %s:", node.name)
+	interp.pushStackFrame()
+	for _, f := range node.fields {
+		comment := ""
+		if f.comment != nil {
+			comment = f.comment.value
+		}
+
+		if isString(f.type_) {
+			if len(comment) > 0 {
+				interp.addLine("%s: str = \"\"  # string %s", f.name, comment)
+			} else {
+				interp.addLine("%s: str = \"\"  # string", f.name)
+			}
+			continue
+		}
+
+		switch ft := f.type_.(type) {
+		case *AstPrimType:
+			zero := "0"
+			if float, _ := isFloatType(ft); float {
+				zero = "0.0"
+			}
+
+			tn := typeName4Py(ft)
+			if ft.flags != nil {
+				tn = ft.flags.name
+			}
+
+			if len(comment) > 0 {
+				interp.addLine("%s: %s = %s  # %s %s", f.name, tn, zero, ft.name, comment)
+			} else {
+				interp.addLine("%s: %s = %s  # %s", f.name, tn, zero, ft.name)
+			}
+
+		case *AstStructType, *AstUndefType:
+			if len(comment) > 0 {
+				interp.addLine("%s: %s = field(default_factory=lambda: %s())  # %s", f.name, typeName4Py(ft), typeName4Py(ft), comment)
+			} else {
+				interp.addLine("%s: %s = field(default_factory=lambda: %s())", f.name, typeName4Py(ft), typeName4Py(ft))
+			}
+
+		case *AstArrayType:
+			if isByteArray(ft) {
+				interp.addLine("%s: bytes = b\"\"", f.name)
+			} else {
+				interp.addLine("%s: %s = field(default_factory=list)", f.name, typeName4Py(ft))
+			}
+
+		default:
+			doPanic("unsupported type: %s %s", f.name, ft)
+		}
+	}
+
+	if len(node.fields) == 0 {
+		interp.addLine("pass")
+	}
+	interp.popStackFrame()
+
+	interp.visitMsgCodec_Py(node)
+}
+
+func (interp *interpreter) visitTypeDef_Py(node *AstTypeDef) {
+	interp.addLine("%s = %s", node.name, typeName4Py(node.impl))
+
+	if node.impl.astType() == AST_TP_Struct {
+		impl := node.impl.(*AstStructType)
+		oname := impl.name
+		impl.name = node.name
+		interp.visitMsgCodec_Py(impl)
+		impl.name = oname
+	}
+}
+
+func (interp *interpreter) visitBindEncode_Py(binds []*AstBindDef) {
+	mspace := interp.program.mspace
+	interp.addDefSpace_Py()
+	interp.addLine("def encode%s%sMsgById(buf: bytearray, mid: int, msg) -> None:", strings.ToUpper(mspace[:1]), mspace[1:])
+	interp.pushStackFrame()
+
+	for idx, bind := range binds {
+		if idx == 0 {
+			interp.addLine("if mid == %s:", bind.msgId)
+		} else {
+			interp.addLine("elif mid == %s:", bind.msgId)
+		}
+		interp.pushStackFrame()
+		if len(bind.msgName) != 0 {
+			interp.addLine("encode_%s(buf, msg)", bind.msgName)
+		} else {
+			interp.addLine("pass")
+		}
+		interp.popStackFrame()
+	}
+	interp.addLine("else:")
+	interp.pushStackFrame()
+	interp.addLine("raise %s(\"unknown message id: %%d\" %% mid)", errorName_Py(mspace))
+	interp.popStackFrame()
+	interp.popStackFrame()
+}
+
+func (interp *interpreter) visitBindDecode_Py(binds []*AstBindDef) {
+	mspace := interp.program.mspace
+	interp.addDefSpace_Py()
+	interp.addLine("def decode%s%sMsgById(buf: bytes, off: int, mid: int):", strings.ToUpper(mspace[:1]), mspace[1:])
+	interp.pushStackFrame()
+	interp.addLine("\"\"\"return the decoded message(None for message without body) and the new offset\"\"\"")
+
+	for idx, bind := range binds {
+		if idx == 0 {
+			interp.addLine("if mid == %s:", bind.msgId)
+		} else {
+			interp.addLine("elif mid == %s:", bind.msgId)
+		}
+		interp.pushStackFrame()
+		if len(bind.msgName) != 0 {
+			interp.addLine("msg = %s()", bind.msgName)
+			interp.addLine("return msg, decode_%s(buf, off, msg)", bind.msgName)
+		} else {
+			interp.addLine("return None, off")
+		}
+		interp.popStackFrame()
+	}
+	interp.addLine("raise %s(\"unknown message id: %%d\" %% mid)", errorName_Py(mspace))
+	interp.popStackFrame()
+}
+
+func (interp *interpreter) visitBinds_Py(binds []*AstBindDef) {
+	interp.visitBindEncode_Py(binds)
+	interp.visitBindDecode_Py(binds)
+}
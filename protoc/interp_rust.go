@@ -0,0 +1,1016 @@
+package protoc
+
+import (
+	"fmt"
+	"strings"
+)
+
+//error type and byte reader shared by the generated encode/decode functions
+var byteBufCode_Rust = []string{
+	"#[derive(Debug, Clone, PartialEq)]",
+	"pub enum Error {",
+	"    Short { need: usize, offset: usize },",
+	"    Check { msg: &'static str, field: &'static str, reason: &'static str },",
+	"    Extra { msg: &'static str, extra: usize },",
+	"    UnknownId(u16),",
+	"}",
+	"",
+	"impl core::fmt::Display for Error {",
+	"    fn fmt(&self, f: &mut core::fmt::Formatter) -> core::fmt::Result {",
+	"        match self {",
+	"            Error::Short { need, offset } => write!(f, \"short buffer: need {} bytes at offset {}\", need, offset),",
+	"            Error::Check { msg, field, reason } => write!(f, \"{}.{}: {} check failed\", msg, field, reason),",
+	"            Error::Extra { msg, extra } => write!(f, \"{}: {} extra bytes after message end\", msg, extra),",
+	"            Error::UnknownId(mid) => write!(f, \"unknown message id: {}\", mid),",
+	"        }",
+	"    }",
+	"}",
+	"",
+	"impl std::error::Error for Error {}",
+	"",
+	"pub struct Reader<'a> {",
+	"    buf: &'a [u8],",
+	"    pos: usize,",
+	"}",
+	"",
+	"impl<'a> Reader<'a> {",
+	"    pub fn new(buf: &'a [u8]) -> Self {",
+	"        Reader { buf, pos: 0 }",
+	"    }",
+	"",
+	"    pub fn pos(&self) -> usize {",
+	"        self.pos",
+	"    }",
+	"",
+	"    pub fn remaining(&self) -> usize {",
+	"        self.buf.len() - self.pos",
+	"    }",
+	"",
+	"    pub fn get_bytes(&mut self, n: usize) -> Result<&'a [u8], Error> {",
+	"        if self.buf.len() - self.pos < n {",
+	"            return Err(Error::Short { need: n, offset: self.pos });",
+	"        }",
+	"        let b = &self.buf[self.pos..self.pos + n];",
+	"        self.pos += n;",
+	"        Ok(b)",
+	"    }",
+	"",
+	"    pub fn get_u8(&mut self) -> Result<u8, Error> {",
+	"        Ok(self.get_bytes(1)?[0])",
+	"    }",
+	"",
+	"    pub fn get_u16(&mut self) -> Result<u16, Error> {",
+	"        Ok(u16::from_be_bytes(self.get_bytes(2)?.try_into().unwrap()))",
+	"    }",
+	"",
+	"    pub fn get_u32(&mut self) -> Result<u32, Error> {",
+	"        Ok(u32::from_be_bytes(self.get_bytes(4)?.try_into().unwrap()))",
+	"    }",
+	"",
+	"    pub fn get_u64(&mut self) -> Result<u64, Error> {",
+	"        Ok(u64::from_be_bytes(self.get_bytes(8)?.try_into().unwrap()))",
+	"    }",
+	"",
+	"    pub fn get_u16_le(&mut self) -> Result<u16, Error> {",
+	"        Ok(u16::from_le_bytes(self.get_bytes(2)?.try_into().unwrap()))",
+	"    }",
+	"",
+	"    pub fn get_u32_le(&mut self) -> Result<u32, Error> {",
+	"        Ok(u32::from_le_bytes(self.get_bytes(4)?.try_into().unwrap()))",
+	"    }",
+	"",
+	"    pub fn get_u64_le(&mut self) -> Result<u64, Error> {",
+	"        Ok(u64::from_le_bytes(self.get_bytes(8)?.try_into().unwrap()))",
+	"    }",
+	"}",
+}
+
+//byteOrder_Rust return the byte order of a field used in to_xx_bytes and the reader getters
+func byteOrder_Rust(f *AstVarDecl) string {
+	if f.le {
+		return "le"
+	}
+	return "be"
+}
+
+//getNum_Rust return the reader call of an int or float field element type, signed ints are cast from the unsigned
+//of the same bits, floats are made from their bits
+func getNum_Rust(f *AstVarDecl, tp AstType) string {
+	tn := typeName4Rust(tp)
+	get := "r.get_" + strings.Replace(tn, "i", "u", 1)
+	if float, bn := isFloatType(tp); float {
+		get = fmt.Sprintf("r.get_u%d", bn)
+	}
+
+	if f.le {
+		get += "_le"
+	}
+
+	if isSigned(tp) {
+		return fmt.Sprintf("%s()? as %s", get, tn)
+	} else if float, _ := isFloatType(tp); float {
+		return fmt.Sprintf("%s::from_bits(%s()?)", tn, get)
+	}
+	return get + "()?"
+}
+
+//zero_Rust return the zero literal of an int or float type
+func zero_Rust(tp AstType) string {
+	if float, _ := isFloatType(tp); float {
+		return "0.0"
+	}
+	return "0"
+}
+
+//string helpers, only emitted for messages with string fields, which are UTF-8 text on the wire
+var stringCode_Rust = []string{
+	"//cut_str return the UTF-8 bytes of s, at most max of them, never cut in the middle of a sequence",
+	"pub fn cut_str(s: &str, max: usize) -> &[u8] {",
+	"    let mut n = s.len().min(max);",
+	"    while !s.is_char_boundary(n) {",
+	"        n -= 1;",
+	"    }",
+	"    &s.as_bytes()[..n]",
+	"}",
+	"",
+	"pub fn put_cstr(buf: &mut Vec<u8>, s: &str, max: usize) {",
+	"    buf.extend_from_slice(cut_str(s.split('\\0').next().unwrap_or(\"\"), max));",
+	"    buf.push(0);",
+	"}",
+	"",
+	"//put_fixed_str put s cut or padded to n bytes",
+	"pub fn put_fixed_str(buf: &mut Vec<u8>, s: &str, n: usize, pad: u8) {",
+	"    let b = cut_str(s, n);",
+	"    buf.extend_from_slice(b);",
+	"    buf.resize(buf.len() + n - b.len(), pad);",
+	"}",
+	"",
+	"impl<'a> Reader<'a> {",
+	"    //get_cstr get the bytes of a string ended by a NUL, which must be within max bytes",
+	"    pub fn get_cstr(&mut self, max: usize, msg: &'static str, field: &'static str) -> Result<&'a [u8], Error> {",
+	"        let rest = &self.buf[self.pos..];",
+	"        match rest.iter().take(max + 1).position(|&c| c == 0) {",
+	"            Some(n) => {",
+	"                self.pos += n + 1;",
+	"                Ok(&rest[..n])",
+	"            }",
+	"            None if rest.len() > max => Err(Error::Check { msg, field, reason: \"max\" }),",
+	"            None => Err(Error::Short { need: rest.len() + 1, offset: self.pos }),",
+	"        }",
+	"    }",
+	"",
+	"    //get_fixed_str get the bytes of a fixed size string up to the first NUL and without the trailing padding",
+	"    pub fn get_fixed_str(&mut self, n: usize, pad: u8) -> Result<&'a [u8], Error> {",
+	"        let b = self.get_bytes(n)?;",
+	"        let mut end = b.iter().position(|&c| c == 0).unwrap_or(n);",
+	"        while end > 0 && b[end - 1] == pad {",
+	"            end -= 1;",
+	"        }",
+	"        Ok(&b[..end])",
+	"    }",
+	"}",
+}
+
+func (interp *interpreter) visitPrelude_Rust(program *AstProgram) {
+	interp.addLine("#![allow(non_camel_case_types, non_snake_case, non_upper_case_globals, dead_code, unused_mut)]")
+	interp.addNewLine()
+	for _, line := range byteBufCode_Rust {
+		interp.addLine("%s", line)
+	}
+	interp.addNewLine()
+
+	if hasField(program, func(f *AstVarDecl) bool { return isString(f.type_) }) {
+		for _, line := range stringCode_Rust {
+			interp.addLine("%s", line)
+		}
+		interp.addNewLine()
+	}
+}
+
+func (interp *interpreter) visitIdGroupDefine_Rust(node *AstIdGroupDef) {
+	var notes []*AstSrcComment
+	if len(node.notes) > 0 {
+		notes = node.notes[:]
+	}
+
+	for idx, id := range node.items {
+		if id.base && idx > 0 {
+			interp.addNewLine()
+		}
+
+		for len(notes) > 0 && id.line > notes[0].line {
+			interp.addLine("//" + notes[0].value)
+			notes = notes[1:]
+		}
+
+		interp.addLine("pub const %s: u16 = %d; //hex: 0x%x", id.name, id.idVal, id.idVal)
+	}
+
+	interp.addNewLine()
+	interp.addLine("pub fn %s_name(id: u16) -> Option<&'static str> {", node.name)
+	interp.pushStackFrame()
+
+	interp.addLine("match id {")
+	interp.pushStackFrame()
+	for _, id := range node.items {
+		interp.addLine("%s => Some(\"%s\"),", id.name, id.name)
+	}
+	interp.addLine("_ => None,")
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+//visitFlagsDefine_Rust add the flags type alias with typed masks, has/set/clear helpers and the string of the set flags
+func (interp *interpreter) visitFlagsDefine_Rust(node *AstFlagsDef) {
+	interp.addNewLine()
+	interp.addLine("pub type %s = %s;", node.name, typeName4Rust(node.base))
+	interp.addNewLine()
+
+	var notes []*AstSrcComment
+	if len(node.notes) > 0 {
+		notes = node.notes[:]
+	}
+
+	for _, id := range node.items {
+		for len(notes) > 0 && id.line > notes[0].line {
+			interp.addLine("//%s", notes[0].value)
+			notes = notes[1:]
+		}
+
+		interp.addLine("pub const %s: %s = 0x%x;", id.name, node.name, uint64(1)<<uint(id.idVal))
+	}
+	interp.addLine("pub const %s_mask: %s = 0x%x; //all defined flags", node.name, node.name, flagsMask(node))
+
+	interp.addNewLine()
+	interp.addLine("//%s_has check if all flags of f are set", node.name)
+	interp.addLine("pub fn %s_has(v: %s, f: %s) -> bool {", node.name, node.name, node.name)
+	interp.pushStackFrame()
+	interp.addLine("v & f == f")
+	interp.popStackFrame()
+	interp.addLine("}")
+
+	interp.addNewLine()
+	interp.addLine("pub fn %s_set(v: &mut %s, f: %s) {", node.name, node.name, node.name)
+	interp.pushStackFrame()
+	interp.addLine("*v |= f;")
+	interp.popStackFrame()
+	interp.addLine("}")
+
+	interp.addNewLine()
+	interp.addLine("pub fn %s_clear(v: &mut %s, f: %s) {", node.name, node.name, node.name)
+	interp.pushStackFrame()
+	interp.addLine("*v &= !f;")
+	interp.popStackFrame()
+	interp.addLine("}")
+
+	interp.addNewLine()
+	interp.addLine("//%s_string list the set flags joined by '|', undefined bits are in hex", node.name)
+	interp.addLine("pub fn %s_string(v: %s) -> String {", node.name, node.name)
+	interp.pushStackFrame()
+	interp.addLine("let mut names: Vec<String> = Vec::new();")
+	for _, id := range node.items {
+		interp.addLine("if v & %s != 0 {", id.name)
+		interp.pushStackFrame()
+		interp.addLine("names.push(\"%s\".to_string());", id.name)
+		interp.popStackFrame()
+		interp.addLine("}")
+	}
+	interp.addLine("let rest = v & !%s_mask;", node.name)
+	interp.addLine("if rest != 0 {")
+	interp.pushStackFrame()
+	interp.addLine("names.push(format!(\"0x{:x}\", rest));")
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.addLine("if names.is_empty() {")
+	interp.pushStackFrame()
+	interp.addLine("return \"0\".to_string();")
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.addLine("names.join(\"|\")")
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+func (interp *interpreter) visitConstDef_Rust(node *AstConstDef) {
+	tp := interp.visitAst(node.val)
+	switch val := tp.(type) {
+	case int:
+		tn := "u64"
+		if val < 0 {
+			tn = "i64"
+		}
+		interp.addLine("pub const %s: %s = %d; //%s", node.name, tn, val,
+			interp.intConstComment_go(val, node.val))
+
+	case float64:
+		interp.addLine("pub const %s: f64 = %s;", node.name, floatLiteral(val))
+
+	case string:
+		interp.addLine("pub const %s: &str = \"%s\";", node.name, val)
+
+	default:
+		doPanic("unknown val type: %s:%T", val, val)
+	}
+}
+
+func typeName4Rust(tp AstType) string {
+	switch ft := tp.(type) {
+	case *AstPrimType:
+		if ok, bn := isIntType(ft); ok && !isVarInt(ft) {
+			if isSigned(ft) {
+				return fmt.Sprintf("i%d", bn)
+			}
+			return fmt.Sprintf("u%d", storageBits(bn))
+		} else if float, bn := isFloatType(ft); float {
+			return fmt.Sprintf("f%d", bn)
+		} else if isString(ft) {
+			return "String"
+		}
+
+	case *AstStructType:
+		return ft.name
+
+	case *AstUndefType:
+		return ft.name
+	}
+
+	doPanic("unsupported type in rust: %s", tp)
+	return ""
+}
+
+//rustArrayType return the rust type of an array field, fixed arrays are sized by the max of the limit
+func (interp *interpreter) rustArrayType(node *AstStructType, f *AstVarDecl) string {
+	ft := f.type_.(*AstArrayType)
+	if !interp.RustFixedArray || f.untilEnd {
+		return fmt.Sprintf("Vec<%s>", typeName4Rust(ft.elemType))
+	}
+
+	size := f.limit.name
+	if lm := getLimitFieldMax(node, f.limit.name); lm != nil {
+		size = lm.name
+	} else if getMsgField(node, f.limit.name) != nil {
+		doPanic("fixed array \"%s\" limited by field \"%s\" which has no max, line: %d", f.name, f.limit.name, f.line)
+	}
+
+	return fmt.Sprintf("[%s; %s as usize]", typeName4Rust(ft.elemType), size)
+}
+
+//condType_Rust return the rust type of the first message field in a condition, empty if there is none
+func condType_Rust(node *AstStructType, cond AstNode) string {
+	switch ast := cond.(type) {
+	case *AstVarNameRef:
+		if f := getMsgField(node, ast.name); ast.this && f != nil {
+			return typeName4Rust(f.type_)
+		}
+
+	case *AstBinOP:
+		if tp := condType_Rust(node, ast.left); tp != "" {
+			return tp
+		}
+		return condType_Rust(node, ast.right)
+	}
+
+	return ""
+}
+
+//cond_Rust render an exist if condition, consts are cast to the type of the field they meet as rust never widens ints implicitly
+func cond_Rust(node *AstStructType, cond AstNode, host string, top bool, tp string) string {
+	switch ast := cond.(type) {
+	case *AstVarNameRef:
+		if ast.this {
+			return host + ast.name
+		} else if tp != "" {
+			return fmt.Sprintf("(%s as %s)", ast.name, tp)
+		}
+		return ast.name
+
+	case *AstBinOP:
+		if ast.op == AND || ast.op == OR {
+			tp = ""
+		} else if ft := condType_Rust(node, ast); ft != "" {
+			tp = ft
+		}
+
+		expr := fmt.Sprintf("%s %s %s", cond_Rust(node, ast.left, host, false, tp), visitBinOP_Go(ast), cond_Rust(node, ast.right, host, false, tp))
+		if top {
+			return expr
+		}
+		return "(" + expr + ")"
+
+	case *AstIntConst:
+		return fmt.Sprint(ast.value)
+	}
+
+	return "??"
+}
+
+func (interp *interpreter) wrapExist_Rust(node *AstStructType, f *AstVarDecl, host string, op func()) {
+	if f.existIf != nil {
+		interp.addLine("if %s {", cond_Rust(node, f.existIf, host, true, ""))
+		interp.pushStackFrame()
+	}
+
+	op()
+
+	if f.existIf != nil {
+		interp.popStackFrame()
+		interp.addLine("}")
+	}
+}
+
+//encodeRef_Rust return the value to encode of a field, fields with max or min are clamped to local variables,
+//so are the limit fields of strings set from the strings
+func encodeRef_Rust(node *AstStructType, f *AstVarDecl) string {
+	if f.max != nil || f.min != nil || limitedString(node, f) != nil {
+		return f.name
+	}
+
+	return "self." + f.name
+}
+
+//usize_Rust return a const or an int literal as usize
+func usize_Rust(val string) string {
+	if strings.HasPrefix(val, "0x") {
+		return val
+	}
+	return val + " as usize"
+}
+
+//stringPad_Rust return the padding byte of a fixed size string field
+func stringPad_Rust(f *AstVarDecl) string {
+	if f.padSpace {
+		return "b' '"
+	}
+	return "0"
+}
+
+//encodeString_Rust put a string field, the limit field of a limited string is a local set from it
+func (interp *interpreter) encodeString_Rust(node *AstStructType, f *AstVarDecl) {
+	if f.cstring {
+		interp.addLine("put_cstr(buf, &self.%s, %s);", f.name, usize_Rust(f.max.name))
+	} else if f.fixed != nil {
+		interp.addLine("put_fixed_str(buf, &self.%s, %s, %s);", f.name, usize_Rust(f.fixed.name), stringPad_Rust(f))
+	} else {
+		interp.addLine("buf.extend_from_slice(cut_str(&self.%s, %s as usize));", f.name, encodeRef_Rust(node, getMsgField(node, f.limit.name)))
+	}
+}
+
+//decodeString_Rust get a string field by its limit field, up to a NUL or of the fixed size, then check UTF-8 if required
+func (interp *interpreter) decodeString_Rust(node *AstStructType, f *AstVarDecl) {
+	raw := ""
+	if f.cstring {
+		raw = fmt.Sprintf("r.get_cstr(%s, \"%s\", \"%s\")?", usize_Rust(f.max.name), node.name, f.name)
+	} else if f.fixed != nil {
+		raw = fmt.Sprintf("r.get_fixed_str(%s, %s)?", usize_Rust(f.fixed.name), stringPad_Rust(f))
+	} else {
+		raw = fmt.Sprintf("r.get_bytes(m.%s as usize)?", f.limit.name)
+	}
+
+	if f.utf8 {
+		interp.addLine("m.%s = String::from_utf8(%s.to_vec()).map_err(|_| Error::Check { msg: \"%s\", field: \"%s\", reason: \"utf8\" })?;",
+			f.name, raw, node.name, f.name)
+	} else {
+		interp.addLine("m.%s = String::from_utf8_lossy(%s).into_owned();", f.name, raw)
+	}
+}
+
+func (interp *interpreter) visitMsgEncode_Rust(node *AstStructType) {
+	interp.addLine("pub fn encode(&self, buf: &mut Vec<u8>) {")
+	interp.pushStackFrame()
+
+	units := msgFieldUnits(node)
+	declared := map[int]bool{}
+	for _, u := range units {
+		if u.bits > 0 && !declared[u.bits] {
+			declared[u.bits] = true
+			interp.addLine("let mut %s: %s;", bitWord_Go(u.bits), typeName4Rust(u.wordType()))
+		}
+	}
+
+	for _, f := range node.fields {
+		if sf := limitedString(node, f); sf != nil {
+			interp.addLine("let %s = cut_str(&self.%s, %s).len() as %s;", f.name, sf.name, usize_Rust(stringLimitMax(node, sf)), typeName4Rust(f.type_))
+			continue
+		} else if isString(f.type_) {
+			continue
+		}
+
+		clamp := ""
+		if f.max != nil {
+			clamp += fmt.Sprintf(".min(%s as %s)", f.max.name, typeName4Rust(f.type_))
+		}
+
+		if f.min != nil {
+			clamp += fmt.Sprintf(".max(%s as %s)", f.min.name, typeName4Rust(f.type_))
+		}
+
+		if clamp != "" {
+			interp.addLine("let %s = self.%s%s;", f.name, f.name, clamp)
+		}
+	}
+
+	var notes []*AstSrcComment
+	if len(node.notes) > 0 {
+		notes = node.notes[:]
+	}
+
+	for _, u := range units {
+		for len(notes) > 0 && u.fields[0].line > notes[0].line {
+			interp.addLine("//" + notes[0].value)
+			notes = notes[1:]
+		}
+
+		if u.bits > 0 {
+			word, wt := bitWord_Go(u.bits), typeName4Rust(u.wordType())
+			interp.addLine("%s = 0;", word)
+			for idx, f := range u.fields {
+				_, bn := isIntType(f.type_)
+				val := fmt.Sprintf("self.%s & 0x%x", f.name, 1<<bn-1)
+				shift := u.bitShift(idx)
+				if typeName4Rust(f.type_) != wt {
+					val = fmt.Sprintf("(%s) as %s", val, wt)
+				}
+
+				if shift > 0 {
+					interp.addLine("%s |= (%s) << %d;", word, val, shift)
+				} else {
+					interp.addLine("%s |= %s;", word, val)
+				}
+			}
+
+			if xor := u.fields[0].xor; xor != nil {
+				interp.addLine("%s ^= %s as %s;", word, xor.name, wt)
+			}
+			if u.bits == 8 {
+				interp.addLine("buf.push(%s);", word)
+			} else {
+				interp.addLine("buf.extend_from_slice(&%s.to_%s_bytes());", word, byteOrder_Rust(u.fields[0]))
+			}
+			interp.addNewLine()
+			continue
+		}
+
+		f := u.fields[0]
+		if isString(f.type_) {
+			interp.wrapExist_Rust(node, f, "self.", func() {
+				interp.encodeString_Rust(node, f)
+			})
+			continue
+		}
+
+		switch ft := f.type_.(type) {
+		case *AstPrimType:
+			if isVarInt(ft) {
+				doPanic("var int encode is not supported in rust style")
+			}
+
+			interp.wrapExist_Rust(node, f, "self.", func() {
+				if f.xor == nil {
+					interp.addLine("buf.extend_from_slice(&%s.to_%s_bytes());", encodeRef_Rust(node, f), byteOrder_Rust(f))
+				} else {
+					interp.addLine("buf.extend_from_slice(&(%s ^ %s as %s).to_%s_bytes());", encodeRef_Rust(node, f), f.xor.name, typeName4Rust(ft), byteOrder_Rust(f))
+				}
+			})
+
+		case *AstStructType, *AstUndefType:
+			interp.wrapExist_Rust(node, f, "self.", func() {
+				interp.addLine("self.%s.encode(buf);", f.name)
+			})
+
+		case *AstArrayType:
+			if f.untilEnd {
+				interp.encodeUntilEnd_Rust(f, ft)
+				continue
+			}
+
+			interp.wrapExist_Rust(node, f, "self.", func() {
+				limit := f.limit.name + " as usize"
+				if lf := getMsgField(node, f.limit.name); lf != nil {
+					limit = encodeRef_Rust(node, lf) + " as usize"
+				}
+
+				if !interp.RustFixedArray {
+					interp.encodeVec_Rust(f, ft, limit)
+					return
+				}
+
+				if isByteArray(ft) {
+					interp.addNewLine()
+					interp.addLine("buf.extend_from_slice(&self.%s[..%s]);", f.name, limit)
+					return
+				}
+
+				interp.addLine("for e in &self.%s[..%s] {", f.name, limit)
+				interp.pushStackFrame()
+				switch ft.elemType.(type) {
+				case *AstPrimType:
+					interp.addLine("buf.extend_from_slice(&e.to_%s_bytes());", byteOrder_Rust(f))
+
+				case *AstStructType, *AstUndefType:
+					interp.addLine("e.encode(buf);")
+
+				default:
+					doPanic("unsupported array elem type encode: %s %s", f.name, ft)
+				}
+				interp.popStackFrame()
+				interp.addLine("}")
+				interp.addNewLine()
+			})
+
+		default:
+			doPanic("encode unsupported type: %s %s", f.name, ft)
+		}
+	}
+
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+//encodeVec_Rust encode limit elements of a Vec field, a Vec shorter than the limit is padded by zeros or default messages
+func (interp *interpreter) encodeVec_Rust(f *AstVarDecl, ft *AstArrayType, limit string) {
+	if isByteArray(ft) {
+		interp.addNewLine()
+		interp.addLine("buf.extend_from_slice(&self.%s[..self.%s.len().min(%s)]);", f.name, f.name, limit)
+		interp.addLine("buf.resize(buf.len() + (%s).saturating_sub(self.%s.len()), 0);", limit, f.name)
+		return
+	}
+
+	interp.addLine("for i in 0..%s {", limit)
+	interp.pushStackFrame()
+	switch et := ft.elemType.(type) {
+	case *AstPrimType:
+		interp.addLine("buf.extend_from_slice(&self.%s.get(i).copied().unwrap_or(%s).to_%s_bytes());", f.name, zero_Rust(et), byteOrder_Rust(f))
+
+	case *AstStructType, *AstUndefType:
+		interp.addLine("match self.%s.get(i) {", f.name)
+		interp.pushStackFrame()
+		interp.addLine("Some(e) => e.encode(buf),")
+		interp.addLine("None => %s::default().encode(buf),", typeName4Rust(et))
+		interp.popStackFrame()
+		interp.addLine("}")
+
+	default:
+		doPanic("unsupported array elem type encode: %s %s", f.name, ft)
+	}
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.addNewLine()
+}
+
+//encodeUntilEnd_Rust encode all elements of an until end array, the decoder takes them up to the end
+func (interp *interpreter) encodeUntilEnd_Rust(f *AstVarDecl, ft *AstArrayType) {
+	if isByteArray(ft) {
+		interp.addLine("buf.extend_from_slice(&self.%s);", f.name)
+		return
+	}
+
+	interp.addLine("for e in &self.%s {", f.name)
+	interp.pushStackFrame()
+	if _, ok := ft.elemType.(*AstPrimType); ok {
+		interp.addLine("buf.extend_from_slice(&e.to_%s_bytes());", byteOrder_Rust(f))
+	} else {
+		interp.addLine("e.encode(buf);")
+	}
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+func (interp *interpreter) decodeCheck_Rust(node *AstStructType, f *AstVarDecl, cond string, desc string) {
+	interp.addLine("if %s {", cond)
+	interp.pushStackFrame()
+	interp.addLine("return Err(Error::Check { msg: \"%s\", field: \"%s\", reason: \"%s\" });", node.name, f.name, desc)
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+func (interp *interpreter) visitMsgDecode_Rust(node *AstStructType) {
+	interp.addLine("pub fn decode(buf: &[u8]) -> Result<Self, Error> {")
+	interp.pushStackFrame()
+	interp.addLine("Self::decode_from(&mut Reader::new(buf))")
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.addLine("")
+
+	interp.addLine("pub fn decode_from(r: &mut Reader) -> Result<Self, Error> {")
+	interp.pushStackFrame()
+	interp.addLine("let mut m = Self::default();")
+
+	for _, u := range msgFieldUnits(node) {
+		if u.bits > 0 {
+			word, wt := bitWord_Go(u.bits), typeName4Rust(u.wordType())
+			interp.addLine("let %s = %s;", word, getNum_Rust(u.fields[0], u.wordType()))
+			if xor := u.fields[0].xor; xor != nil {
+				interp.addLine("let %s = %s ^ %s as %s;", word, word, xor.name, wt)
+			}
+
+			for idx, f := range u.fields {
+				_, bn := isIntType(f.type_)
+				val := fmt.Sprintf("%s & 0x%x", word, 1<<bn-1)
+				if shift := u.bitShift(idx); shift > 0 {
+					val = fmt.Sprintf("(%s >> %d) & 0x%x", word, shift, 1<<bn-1)
+				}
+
+				if ft := typeName4Rust(f.type_); ft != wt {
+					val = fmt.Sprintf("(%s) as %s", val, ft)
+				}
+				interp.addLine("m.%s = %s;", f.name, val)
+
+				if f.equ != nil {
+					interp.decodeCheck_Rust(node, f, fmt.Sprintf("m.%s != %s as %s", f.name, f.equ.name, typeName4Rust(f.type_)), "equal")
+				}
+
+				if f.strict {
+					interp.decodeCheck_Rust(node, f, fmt.Sprintf("m.%s & !%s_mask != 0", f.name, flagsType(f.type_).name), "flags")
+				}
+			}
+			interp.addNewLine()
+			continue
+		}
+
+		f := u.fields[0]
+		if isString(f.type_) {
+			interp.wrapExist_Rust(node, f, "m.", func() {
+				interp.decodeString_Rust(node, f)
+			})
+			continue
+		}
+
+		switch ft := f.type_.(type) {
+		case *AstPrimType:
+			if isVarInt(ft) {
+				doPanic("var int decode is not supported in rust style")
+			}
+
+			interp.wrapExist_Rust(node, f, "m.", func() {
+				tn := typeName4Rust(ft)
+				interp.addLine("m.%s = %s;", f.name, getNum_Rust(f, ft))
+				if f.xor != nil {
+					interp.addLine("m.%s ^= %s as %s;", f.name, f.xor.name, tn)
+				}
+
+				if f.max != nil {
+					interp.decodeCheck_Rust(node, f, fmt.Sprintf("m.%s > %s as %s", f.name, f.max.name, tn), "max")
+				}
+
+				if f.min != nil {
+					interp.decodeCheck_Rust(node, f, fmt.Sprintf("m.%s < %s as %s", f.name, f.min.name, tn), "min")
+				}
+
+				if f.equ != nil {
+					interp.decodeCheck_Rust(node, f, fmt.Sprintf("m.%s != %s as %s", f.name, f.equ.name, tn), "equal")
+				}
+
+				if f.strict {
+					interp.decodeCheck_Rust(node, f, fmt.Sprintf("m.%s & !%s_mask != 0", f.name, flagsType(f.type_).name), "flags")
+				}
+			})
+
+		case *AstStructType, *AstUndefType:
+			interp.wrapExist_Rust(node, f, "m.", func() {
+				interp.addLine("m.%s = %s::decode_from(r)?;", f.name, typeName4Rust(ft))
+			})
+
+		case *AstArrayType:
+			if f.untilEnd && isByteArray(ft) {
+				interp.addLine("m.%s = r.get_bytes(r.remaining())?.to_vec();", f.name)
+				continue
+			}
+
+			interp.wrapExist_Rust(node, f, "m.", func() {
+				if isByteArray(ft) {
+					limit := arrayLimitRef(node, f, "m.") + " as usize"
+					if interp.RustFixedArray {
+						interp.addLine("let n = %s;", limit)
+						interp.addLine("m.%s[..n].copy_from_slice(r.get_bytes(n)?);", f.name)
+					} else {
+						interp.addLine("m.%s = r.get_bytes(%s)?.to_vec();", f.name, limit)
+					}
+					return
+				}
+
+				elem := ""
+				switch et := ft.elemType.(type) {
+				case *AstPrimType:
+					elem = getNum_Rust(f, et)
+
+				case *AstStructType, *AstUndefType:
+					elem = fmt.Sprintf("%s::decode_from(r)?", typeName4Rust(et))
+
+				default:
+					doPanic("unsupported array elem type decode: %s %s", f.name, ft)
+				}
+
+				if f.untilEnd {
+					interp.addLine("while r.remaining() > 0 {")
+					interp.pushStackFrame()
+					interp.addLine("m.%s.push(%s);", f.name, elem)
+					interp.popStackFrame()
+					interp.addLine("}")
+					return
+				}
+
+				interp.addLine("for i in 0..%s as usize {", arrayLimitRef(node, f, "m."))
+				interp.pushStackFrame()
+				if interp.RustFixedArray {
+					interp.addLine("m.%s[i] = %s;", f.name, elem)
+				} else {
+					interp.addLine("let _ = i;")
+					interp.addLine("m.%s.push(%s);", f.name, elem)
+				}
+				interp.popStackFrame()
+				interp.addLine("}")
+				interp.addNewLine()
+			})
+
+		default:
+			doPanic("decode unsupported type: %s %s", f.name, ft)
+		}
+	}
+
+	if node.mend {
+		interp.addLine("if r.remaining() > 0 {")
+		interp.pushStackFrame()
+		interp.addLine("return Err(Error::Extra { msg: \"%s\", extra: r.remaining() });", node.name)
+		interp.popStackFrame()
+		interp.addLine("}")
+	}
+	interp.addLine("Ok(m)")
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+func (interp *interpreter) visitMsgCodec_Rust(node *AstStructType) {
+	interp.addLine("impl %s {", node.name)
+	interp.pushStackFrame()
+	interp.visitMsgEncode_Rust(node)
+	interp.addLine("")
+	interp.visitMsgDecode_Rust(node)
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+func (interp *interpreter) visitMsgDefine_Rust(node *AstStructType) {
+	interp.addLine("")
+	interp.addLine("#[derive(Debug, Clone, PartialEq)]")
+	interp.addLine("pub struct %s {", node.name)
+	interp.pushStackFrame()
+	for _, f := range node.fields {
+		switch ft := f.type_.(type) {
+		case *AstPrimType:
+			tn := typeName4Rust(ft)
+			if ft.flags != nil {
+				tn = ft.flags.name
+			}
+
+			if f.comment != nil {
+				interp.addLine("pub %s: %s, //%s %s", f.name, tn, ft.name, f.comment.value)
+			} else {
+				interp.addLine("pub %s: %s, //%s", f.name, tn, ft.name)
+			}
+
+		case *AstStructType, *AstUndefType:
+			if f.comment != nil {
+				interp.addLine("pub %s: %s, //%s", f.name, typeName4Rust(ft), f.comment.value)
+			} else {
+				interp.addLine("pub %s: %s,", f.name, typeName4Rust(ft))
+			}
+
+		case *AstArrayType:
+			interp.addLine("pub %s: %s,", f.name, interp.rustArrayType(node, f))
+
+		default:
+			doPanic("unsupported type: %s %s", f.name, ft)
+		}
+	}
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.addLine("")
+
+	//fixed arrays may be too large to derive Default
+	interp.addLine("impl Default for %s {", node.name)
+	interp.pushStackFrame()
+	interp.addLine("fn default() -> Self {")
+	interp.pushStackFrame()
+	interp.addLine("%s {", node.name)
+	interp.pushStackFrame()
+	for _, f := range node.fields {
+		switch ft := f.type_.(type) {
+		case *AstPrimType:
+			if isString(ft) {
+				interp.addLine("%s: String::new(),", f.name)
+			} else {
+				interp.addLine("%s: %s,", f.name, zero_Rust(ft))
+			}
+
+		case *AstArrayType:
+			if interp.RustFixedArray && !f.untilEnd {
+				interp.addLine("%s: core::array::from_fn(|_| Default::default()),", f.name)
+			} else {
+				interp.addLine("%s: Vec::new(),", f.name)
+			}
+
+		default:
+			interp.addLine("%s: Default::default(),", f.name)
+		}
+	}
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.addLine("")
+
+	interp.visitMsgCodec_Rust(node)
+}
+
+func (interp *interpreter) visitTypeDef_Rust(node *AstTypeDef) {
+	interp.addLine("pub type %s = %s;", node.name, typeName4Rust(node.impl))
+
+	if node.impl.astType() == AST_TP_Struct {
+		impl := node.impl.(*AstStructType)
+		oname := impl.name
+		impl.name = node.name
+		interp.visitMsgCodec_Rust(impl)
+		impl.name = oname
+	}
+}
+
+func (interp *interpreter) visitBinds_Rust(binds []*AstBindDef) {
+	mspace := interp.program.mspace
+	space := fmt.Sprint(strings.ToUpper(mspace[:1]), mspace[1:])
+
+	interp.addNewLine()
+	interp.addLine("//all messages bind to message id, variants are named by the message id")
+	interp.addLine("#[derive(Debug, Clone, PartialEq)]")
+	interp.addLine("pub enum %sMessage {", space)
+	interp.pushStackFrame()
+	for _, bind := range binds {
+		if len(bind.msgName) != 0 {
+			interp.addLine("%s(%s),", bind.msgId, bind.msgName)
+		} else {
+			interp.addLine("%s,", bind.msgId)
+		}
+	}
+	interp.popStackFrame()
+	interp.addLine("}")
+
+	interp.addNewLine()
+	interp.addLine("impl %sMessage {", space)
+	interp.pushStackFrame()
+	interp.addLine("pub fn mid(&self) -> u16 {")
+	interp.pushStackFrame()
+	interp.addLine("match self {")
+	interp.pushStackFrame()
+	for _, bind := range binds {
+		if len(bind.msgName) != 0 {
+			interp.addLine("%sMessage::%s(_) => %s,", space, bind.msgId, bind.msgId)
+		} else {
+			interp.addLine("%sMessage::%s => %s,", space, bind.msgId, bind.msgId)
+		}
+	}
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.popStackFrame()
+	interp.addLine("}")
+
+	interp.addNewLine()
+	interp.addLine("pub fn encode%sMsgById(buf: &mut Vec<u8>, msg: &%sMessage) {", space, space)
+	interp.pushStackFrame()
+	interp.addLine("match msg {")
+	interp.pushStackFrame()
+	for _, bind := range binds {
+		if len(bind.msgName) != 0 {
+			interp.addLine("%sMessage::%s(m) => m.encode(buf),", space, bind.msgId)
+		} else {
+			interp.addLine("%sMessage::%s => {}", space, bind.msgId)
+		}
+	}
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.popStackFrame()
+	interp.addLine("}")
+
+	interp.addNewLine()
+	interp.addLine("pub fn decode%sMsgById(buf: &[u8], mid: u16) -> Result<%sMessage, Error> {", space, space)
+	interp.pushStackFrame()
+	interp.addLine("match mid {")
+	interp.pushStackFrame()
+	for _, bind := range binds {
+		if len(bind.msgName) != 0 {
+			interp.addLine("%s => Ok(%sMessage::%s(%s::decode(buf)?)),", bind.msgId, space, bind.msgId, bind.msgName)
+		} else {
+			interp.addLine("%s => Ok(%sMessage::%s),", bind.msgId, space, bind.msgId)
+		}
+	}
+	interp.addLine("_ => Err(Error::UnknownId(mid)),")
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.addNewLine()
+}
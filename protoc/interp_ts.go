@@ -0,0 +1,904 @@
+package protoc
+
+import (
+	"fmt"
+	"strings"
+)
+
+//byte writer/reader over DataView shared by the generated encode/decode functions
+var byteBufCode_Ts = []string{
+	"export class ByteWriter {",
+	"    buf: Uint8Array;",
+	"    view: DataView;",
+	"    pos = 0;",
+	"",
+	"    constructor(size: number = 256) {",
+	"        this.buf = new Uint8Array(size);",
+	"        this.view = new DataView(this.buf.buffer);",
+	"    }",
+	"",
+	"    private reserve(n: number): number {",
+	"        if (this.pos + n > this.buf.length) {",
+	"            const buf = new Uint8Array(Math.max(this.buf.length * 2, this.pos + n));",
+	"            buf.set(this.buf);",
+	"            this.buf = buf;",
+	"            this.view = new DataView(buf.buffer);",
+	"        }",
+	"        const pos = this.pos;",
+	"        this.pos += n;",
+	"        return pos;",
+	"    }",
+	"",
+	"    //reserve may replace the buffer, so always call it before touching the view",
+	"    putU8(v: number): void { const pos = this.reserve(1); this.view.setUint8(pos, v); }",
+	"    putU16(v: number): void { const pos = this.reserve(2); this.view.setUint16(pos, v); }",
+	"    putU32(v: number): void { const pos = this.reserve(4); this.view.setUint32(pos, v); }",
+	"    putU64(v: bigint): void { const pos = this.reserve(8); this.view.setBigUint64(pos, v); }",
+	"    putU16LE(v: number): void { const pos = this.reserve(2); this.view.setUint16(pos, v, true); }",
+	"    putU32LE(v: number): void { const pos = this.reserve(4); this.view.setUint32(pos, v, true); }",
+	"    putU64LE(v: bigint): void { const pos = this.reserve(8); this.view.setBigUint64(pos, v, true); }",
+	"    putI8(v: number): void { const pos = this.reserve(1); this.view.setInt8(pos, v); }",
+	"    putI16(v: number): void { const pos = this.reserve(2); this.view.setInt16(pos, v); }",
+	"    putI32(v: number): void { const pos = this.reserve(4); this.view.setInt32(pos, v); }",
+	"    putI64(v: bigint): void { const pos = this.reserve(8); this.view.setBigInt64(pos, v); }",
+	"    putI16LE(v: number): void { const pos = this.reserve(2); this.view.setInt16(pos, v, true); }",
+	"    putI32LE(v: number): void { const pos = this.reserve(4); this.view.setInt32(pos, v, true); }",
+	"    putI64LE(v: bigint): void { const pos = this.reserve(8); this.view.setBigInt64(pos, v, true); }",
+	"    putF32(v: number): void { const pos = this.reserve(4); this.view.setFloat32(pos, v); }",
+	"    putF64(v: number): void { const pos = this.reserve(8); this.view.setFloat64(pos, v); }",
+	"    putF32LE(v: number): void { const pos = this.reserve(4); this.view.setFloat32(pos, v, true); }",
+	"    putF64LE(v: number): void { const pos = this.reserve(8); this.view.setFloat64(pos, v, true); }",
+	"",
+	"    putBytes(v: Uint8Array, n: number): void {",
+	"        if (v.length < n) throw new RangeError(`not enough bytes: need ${n}, has ${v.length}`);",
+	"        const pos = this.reserve(n);",
+	"        this.buf.set(v.subarray(0, n), pos);",
+	"    }",
+	"",
+	"    bytes(): Uint8Array { return this.buf.slice(0, this.pos); }",
+	"}",
+	"",
+	"export class ByteReader {",
+	"    view: DataView;",
+	"    pos = 0;",
+	"",
+	"    constructor(data: Uint8Array) {",
+	"        this.view = new DataView(data.buffer, data.byteOffset, data.byteLength);",
+	"    }",
+	"",
+	"    private advance(n: number): number {",
+	"        if (this.pos + n > this.view.byteLength) throw new RangeError(`short buffer: need ${n} bytes at offset ${this.pos}`);",
+	"        const pos = this.pos;",
+	"        this.pos += n;",
+	"        return pos;",
+	"    }",
+	"",
+	"    getU8(): number { return this.view.getUint8(this.advance(1)); }",
+	"    getU16(): number { return this.view.getUint16(this.advance(2)); }",
+	"    getU32(): number { return this.view.getUint32(this.advance(4)); }",
+	"    getU64(): bigint { return this.view.getBigUint64(this.advance(8)); }",
+	"    getU16LE(): number { return this.view.getUint16(this.advance(2), true); }",
+	"    getU32LE(): number { return this.view.getUint32(this.advance(4), true); }",
+	"    getU64LE(): bigint { return this.view.getBigUint64(this.advance(8), true); }",
+	"    getI8(): number { return this.view.getInt8(this.advance(1)); }",
+	"    getI16(): number { return this.view.getInt16(this.advance(2)); }",
+	"    getI32(): number { return this.view.getInt32(this.advance(4)); }",
+	"    getI64(): bigint { return this.view.getBigInt64(this.advance(8)); }",
+	"    getI16LE(): number { return this.view.getInt16(this.advance(2), true); }",
+	"    getI32LE(): number { return this.view.getInt32(this.advance(4), true); }",
+	"    getI64LE(): bigint { return this.view.getBigInt64(this.advance(8), true); }",
+	"    getF32(): number { return this.view.getFloat32(this.advance(4)); }",
+	"    getF64(): number { return this.view.getFloat64(this.advance(8)); }",
+	"    getF32LE(): number { return this.view.getFloat32(this.advance(4), true); }",
+	"    getF64LE(): number { return this.view.getFloat64(this.advance(8), true); }",
+	"",
+	"    getBytes(n: number): Uint8Array {",
+	"        const pos = this.advance(n);",
+	"        return new Uint8Array(this.view.buffer.slice(this.view.byteOffset + pos, this.view.byteOffset + pos + n));",
+	"    }",
+	"}",
+}
+
+//string helpers, only emitted for messages with string fields, which are UTF-8 text on the wire
+var stringCode_Ts = []string{
+	"const textEncoder = new TextEncoder();",
+	"",
+	"//cutString return the UTF-8 bytes of s, at most max of them, never cut in the middle of a sequence",
+	"export function cutString(s: string, max: number): Uint8Array {",
+	"    const b = textEncoder.encode(s);",
+	"    if (b.length <= max) return b;",
+	"    let n = max;",
+	"    while (n > 0 && (b[n] & 0xc0) === 0x80) n--;",
+	"    return b.subarray(0, n);",
+	"}",
+	"",
+	"export function putCString(w: ByteWriter, s: string, max: number): void {",
+	"    const b = cutString(s.split(\"\\0\")[0], max);",
+	"    w.putBytes(b, b.length);",
+	"    w.putU8(0);",
+	"}",
+	"",
+	"//putFixedString put s cut or padded to n bytes",
+	"export function putFixedString(w: ByteWriter, s: string, n: number, pad: number): void {",
+	"    const b = cutString(s, n);",
+	"    w.putBytes(b, b.length);",
+	"    for (let i = b.length; i < n; i++) w.putU8(pad);",
+	"}",
+	"",
+	"//getCString get the bytes of a string ended by a NUL, which must be within max bytes",
+	"export function getCString(r: ByteReader, max: number, what: string): Uint8Array {",
+	"    for (let n = 0; ; n++) {",
+	"        if (r.pos + n >= r.view.byteLength) throw new RangeError(`short buffer: no NUL after offset ${r.pos}`);",
+	"        if (r.view.getUint8(r.pos + n) === 0) {",
+	"            const b = r.getBytes(n);",
+	"            r.pos++;",
+	"            return b;",
+	"        }",
+	"        if (n === max) throw new RangeError(`${what}: max check failed`);",
+	"    }",
+	"}",
+	"",
+	"//trimString return the bytes of a fixed size string up to the first NUL and without the trailing padding",
+	"export function trimString(b: Uint8Array, pad: number): Uint8Array {",
+	"    let n = b.indexOf(0);",
+	"    if (n < 0) n = b.length;",
+	"    while (n > 0 && b[n - 1] === pad) n--;",
+	"    return b.subarray(0, n);",
+	"}",
+	"",
+	"//textOf return the text of UTF-8 bytes, invalid sequences are replaced by U+FFFD unless checked, which throws for them",
+	"export function textOf(b: Uint8Array, check?: string): string {",
+	"    if (check === undefined) return new TextDecoder().decode(b);",
+	"    try {",
+	"        return new TextDecoder(\"utf-8\", { fatal: true }).decode(b);",
+	"    } catch (e) {",
+	"        throw new RangeError(`${check}: utf8 check failed`);",
+	"    }",
+	"}",
+}
+
+func (interp *interpreter) visitPrelude_Ts(program *AstProgram) {
+	for _, line := range byteBufCode_Ts {
+		interp.addLine("%s", line)
+	}
+	interp.addNewLine()
+
+	if hasField(program, func(f *AstVarDecl) bool { return isString(f.type_) }) {
+		for _, line := range stringCode_Ts {
+			interp.addLine("%s", line)
+		}
+		interp.addNewLine()
+	}
+}
+
+func (interp *interpreter) visitIdGroupDefine_Ts(node *AstIdGroupDef) {
+	var notes []*AstSrcComment
+	if len(node.notes) > 0 {
+		notes = node.notes[:]
+	}
+
+	for idx, id := range node.items {
+		if id.base && idx > 0 {
+			interp.addNewLine()
+		}
+
+		for len(notes) > 0 && id.line > notes[0].line {
+			interp.addLine("//" + notes[0].value)
+			notes = notes[1:]
+		}
+
+		interp.addLine("export const %s = %d; //hex: 0x%x", id.name, id.idVal, id.idVal)
+	}
+
+	interp.addNewLine()
+	interp.addLine("export function %s_name(id: number): string | undefined {", node.name)
+	interp.pushStackFrame()
+
+	interp.addLine("switch (id) {")
+	for idx, id := range node.items {
+		if idx != 0 {
+			interp.addNewLine()
+		}
+		interp.addLine("case %s:", id.name)
+		interp.pushStackFrame()
+		interp.addLine("return \"%s\";", id.name)
+		interp.popStackFrame()
+	}
+
+	interp.addLine("}")
+	interp.addLine("return undefined;")
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+//visitFlagsDefine_Ts add the flags type alias with typed masks, has/set/clear helpers and the string of the set flags,
+//u64 flags are bigint, u32 results are kept unsigned by >>> 0
+func (interp *interpreter) visitFlagsDefine_Ts(node *AstFlagsDef) {
+	_, bn := isIntType(node.base)
+	val := func(v uint64) string { return fmt.Sprintf("0x%x", v) }
+	unsigned := func(expr string) string { return expr }
+	switch storageBits(bn) {
+	case 64:
+		val = func(v uint64) string { return fmt.Sprintf("BigInt(\"0x%x\")", v) }
+
+	case 32:
+		unsigned = func(expr string) string { return fmt.Sprintf("(%s) >>> 0", expr) }
+	}
+
+	interp.addNewLine()
+	interp.addLine("export type %s = %s;", node.name, typeName4Ts(node.base))
+	interp.addNewLine()
+
+	var notes []*AstSrcComment
+	if len(node.notes) > 0 {
+		notes = node.notes[:]
+	}
+
+	for _, id := range node.items {
+		for len(notes) > 0 && id.line > notes[0].line {
+			interp.addLine("//%s", notes[0].value)
+			notes = notes[1:]
+		}
+
+		interp.addLine("export const %s: %s = %s;", id.name, node.name, val(uint64(1)<<uint(id.idVal)))
+	}
+	interp.addLine("export const %s_mask: %s = %s; //all defined flags", node.name, node.name, val(flagsMask(node)))
+
+	interp.addNewLine()
+	interp.addLine("//%s_has check if all flags of f are set", node.name)
+	interp.addLine("export function %s_has(v: %s, f: %s): boolean {", node.name, node.name, node.name)
+	interp.pushStackFrame()
+	interp.addLine("return (%s) === f;", unsigned("v & f"))
+	interp.popStackFrame()
+	interp.addLine("}")
+
+	interp.addNewLine()
+	interp.addLine("export function %s_set(v: %s, f: %s): %s {", node.name, node.name, node.name, node.name)
+	interp.pushStackFrame()
+	interp.addLine("return %s;", unsigned("v | f"))
+	interp.popStackFrame()
+	interp.addLine("}")
+
+	interp.addNewLine()
+	interp.addLine("export function %s_clear(v: %s, f: %s): %s {", node.name, node.name, node.name, node.name)
+	interp.pushStackFrame()
+	interp.addLine("return %s;", unsigned("v & ~f"))
+	interp.popStackFrame()
+	interp.addLine("}")
+
+	interp.addNewLine()
+	interp.addLine("//%s_string list the set flags joined by '|', undefined bits are in hex", node.name)
+	interp.addLine("export function %s_string(v: %s): string {", node.name, node.name)
+	interp.pushStackFrame()
+	interp.addLine("const names: string[] = [];")
+	for _, id := range node.items {
+		interp.addLine("if (v & %s) names.push(\"%s\");", id.name, id.name)
+	}
+	interp.addLine("const rest = %s;", unsigned(fmt.Sprintf("v & ~%s_mask", node.name)))
+	interp.addLine("if (rest) names.push(\"0x\" + rest.toString(16));")
+	interp.addLine("return names.join(\"|\") || \"0\";")
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+//strictCond_Ts return the condition of a strict flags field holding undefined bits
+func strictCond_Ts(f *AstVarDecl) string {
+	cond := fmt.Sprintf("(m.%s & ~%s_mask)", f.name, flagsType(f.type_).name)
+	if _, bn := isIntType(f.type_); bn == 64 {
+		return cond + " !== BigInt(0)"
+	}
+
+	return cond + " !== 0"
+}
+
+func (interp *interpreter) visitConstDef_Ts(node *AstConstDef) {
+	tp := interp.visitAst(node.val)
+	switch val := tp.(type) {
+	case int:
+		interp.addLine("export const %s = %d; //%s", node.name, val,
+			interp.intConstComment_go(val, node.val))
+
+	case float64:
+		interp.addLine("export const %s = %s;", node.name, floatLiteral(val))
+
+	case string:
+		interp.addLine("export const %s = \"%s\";", node.name, val)
+
+	default:
+		doPanic("unknown val type: %s:%T", val, val)
+	}
+}
+
+func typeName4Ts(tp AstType) string {
+	switch ft := tp.(type) {
+	case *AstPrimType:
+		if ok, bn := isIntType(ft); ok {
+			if bn == 64 {
+				return "bigint"
+			}
+			return "number"
+		} else if float, _ := isFloatType(ft); float {
+			return "number"
+		} else if isString(ft) {
+			return "string"
+		}
+
+	case *AstStructType:
+		return ft.name
+
+	case *AstUndefType:
+		return ft.name
+
+	case *AstArrayType:
+		if isByteArray(ft) {
+			return "Uint8Array"
+		}
+		return typeName4Ts(ft.elemType) + "[]"
+	}
+
+	doPanic("unsupported type in ts: %s", tp)
+	return ""
+}
+
+//intValue_Ts convert a number expression to the runtime value of an int type
+func intValue_Ts(tp AstType, expr string) string {
+	if _, bn := isIntType(tp); bn == 64 {
+		return fmt.Sprintf("BigInt(%s)", expr)
+	}
+
+	return expr
+}
+
+//numOp_Ts return the DataView accessor suffix of a byte aligned int or float type, I for signed, F for float and LE suffix for little endian
+func numOp_Ts(tp AstType, le bool) string {
+	ok, bn := isIntType(tp)
+	float, fbn := isFloatType(tp)
+	if !(ok || float) || bn%8 != 0 || isVarInt(tp) {
+		doPanic("unsupported int type in ts: %s", tp)
+	}
+
+	op := fmt.Sprintf("U%d", bn)
+	if isSigned(tp) {
+		op = fmt.Sprintf("I%d", bn)
+	} else if float {
+		op = fmt.Sprintf("F%d", fbn)
+	}
+
+	if le {
+		return op + "LE"
+	}
+	return op
+}
+
+//bitWord_Ts return the variable holding a word of bit fields, 64 bits words are bigint so they have their own
+func bitWord_Ts(bits int) string {
+	if bits == 64 {
+		return "tmp64"
+	}
+	return "tmp"
+}
+
+//xorWord_Ts return the xor value of a bit fields word, js bit operators work on 32 bits
+func xorWord_Ts(u *fieldUnit, xor string) string {
+	if u.bits == 64 {
+		return intValue_Ts(u.wordType(), xor)
+	}
+	return fmt.Sprintf("%s & 0x%x", xor, uint64(1)<<uint(u.bits)-1)
+}
+
+func visitVarRef_Ts(ref *AstVarNameRef) string {
+	if ref.this {
+		return fmt.Sprintf("m.%s", ref.name)
+	}
+
+	return ref.name
+}
+
+func visitBinOP_Ts(op *AstBinOP) string {
+	switch op.op {
+	case EQU:
+		return "==="
+
+	case NEQ:
+		return "!=="
+	}
+
+	return visitBinOP_Go(op)
+}
+
+func (interp *interpreter) wrapExist_Ts(f *AstVarDecl, op func()) {
+	if f.existIf != nil {
+		interp.addLine("if (%s) {", interp.traveseCond(true, f.existIf, visitVarRef_Ts, visitBinOP_Ts))
+		interp.pushStackFrame()
+	}
+
+	op()
+
+	if f.existIf != nil {
+		interp.popStackFrame()
+		interp.addLine("}")
+	}
+}
+
+//fieldDefault_Ts return the initial value of a message field
+func fieldDefault_Ts(tp AstType) string {
+	switch ft := tp.(type) {
+	case *AstPrimType:
+		if isString(ft) {
+			return "\"\""
+		}
+		return intValue_Ts(ft, "0")
+
+	case *AstStructType, *AstUndefType:
+		return fmt.Sprintf("new_%s()", typeName4Ts(ft))
+
+	case *AstArrayType:
+		if isByteArray(ft) {
+			return "new Uint8Array(0)"
+		}
+		return "[]"
+	}
+
+	doPanic("unsupported type in ts: %s", tp)
+	return ""
+}
+
+//stringPad_Ts return the padding byte of a fixed size string field
+func stringPad_Ts(f *AstVarDecl) string {
+	if f.padSpace {
+		return "0x20"
+	}
+	return "0"
+}
+
+//encodeString_Ts put a string field, the limit field of a limited string is already set from it
+func (interp *interpreter) encodeString_Ts(node *AstStructType, f *AstVarDecl) {
+	if f.cstring {
+		interp.addLine("putCString(w, m.%s, %s);", f.name, f.max.name)
+	} else if f.fixed != nil {
+		interp.addLine("putFixedString(w, m.%s, %s, %s);", f.name, f.fixed.name, stringPad_Ts(f))
+	} else {
+		n := stringLength_Ts(node, f)
+		interp.addLine("w.putBytes(cutString(m.%s, %s), %s);", f.name, n, n)
+	}
+}
+
+//stringLength_Ts return the byte length of a limited string, which is its limit field
+func stringLength_Ts(node *AstStructType, f *AstVarDecl) string {
+	if _, bn := isIntType(getMsgField(node, f.limit.name).type_); bn == 64 {
+		return fmt.Sprintf("Number(m.%s)", f.limit.name)
+	}
+	return "m." + f.limit.name
+}
+
+//decodeString_Ts get a string field by its limit field, up to a NUL or of the fixed size, then check UTF-8 if required
+func (interp *interpreter) decodeString_Ts(node *AstStructType, f *AstVarDecl) {
+	raw := ""
+	if f.cstring {
+		raw = fmt.Sprintf("getCString(r, %s, \"%s.%s\")", f.max.name, node.name, f.name)
+	} else if f.fixed != nil {
+		raw = fmt.Sprintf("trimString(r.getBytes(%s), %s)", f.fixed.name, stringPad_Ts(f))
+	} else {
+		raw = fmt.Sprintf("r.getBytes(%s)", stringLength_Ts(node, f))
+	}
+
+	if f.utf8 {
+		interp.addLine("m.%s = textOf(%s, \"%s.%s\");", f.name, raw, node.name, f.name)
+	} else {
+		interp.addLine("m.%s = textOf(%s);", f.name, raw)
+	}
+}
+
+func (interp *interpreter) visitMsgEncode_Ts(node *AstStructType) {
+	interp.addLine("export function encode_%s(w: ByteWriter, m: %s): void {", node.name, node.name)
+	interp.pushStackFrame()
+
+	//limit fields of strings are set from the strings cut on a rune boundary
+	for _, f := range node.fields {
+		if isString(f.type_) && f.limit != nil {
+			lf := getMsgField(node, f.limit.name)
+			interp.addLine("m.%s = %s;", lf.name, intValue_Ts(lf.type_, fmt.Sprintf("cutString(m.%s, %s).length", f.name, stringLimitMax(node, f))))
+			interp.addNewLine()
+		}
+	}
+
+	var notes []*AstSrcComment
+	if len(node.notes) > 0 {
+		notes = node.notes[:]
+	}
+
+	hasTmp := map[string]bool{}
+	for _, u := range msgFieldUnits(node) {
+		for len(notes) > 0 && u.fields[0].line > notes[0].line {
+			interp.addLine("//" + notes[0].value)
+			notes = notes[1:]
+		}
+
+		if u.bits > 0 {
+			word := bitWord_Ts(u.bits)
+			if !hasTmp[word] {
+				hasTmp[word] = true
+				interp.addLine("let %s = %s;", word, intValue_Ts(u.wordType(), "0"))
+			} else {
+				interp.addLine("%s = %s;", word, intValue_Ts(u.wordType(), "0"))
+			}
+
+			for idx, f := range u.fields {
+				_, bn := isIntType(f.type_)
+				val := fmt.Sprintf("m.%s & 0x%x", f.name, 1<<bn-1)
+				shift := u.bitShift(idx)
+				if u.bits == 64 {
+					val = intValue_Ts(u.wordType(), val)
+				} else if shift > 0 {
+					val = "(" + val + ")"
+				}
+
+				if shift > 0 {
+					interp.addLine("%s |= %s << %s;", word, val, intValue_Ts(u.wordType(), fmt.Sprint(shift)))
+				} else {
+					interp.addLine("%s |= %s;", word, val)
+				}
+			}
+
+			if xor := u.fields[0].xor; xor != nil {
+				interp.addLine("%s ^= %s;", word, xorWord_Ts(u, xor.name))
+			}
+			interp.addLine("w.put%s(%s);", numOp_Ts(u.wordType(), u.fields[0].le), word)
+			interp.addNewLine()
+			continue
+		}
+
+		f := u.fields[0]
+		if isString(f.type_) {
+			interp.wrapExist_Ts(f, func() {
+				interp.encodeString_Ts(node, f)
+			})
+			continue
+		}
+
+		switch ft := f.type_.(type) {
+		case *AstPrimType:
+			if isVarInt(ft) {
+				doPanic("var int encode is not supported in ts style")
+			}
+
+			interp.wrapExist_Ts(f, func() {
+				if f.max != nil {
+					interp.addNewLine()
+					interp.addLine("if (m.%s > %s) m.%s = %s;", f.name, f.max.name, f.name, intValue_Ts(ft, f.max.name))
+				}
+
+				if f.min != nil {
+					interp.addLine("if (m.%s < %s) m.%s = %s;", f.name, f.min.name, f.name, intValue_Ts(ft, f.min.name))
+				}
+
+				if f.xor == nil {
+					interp.addLine("w.put%s(m.%s);", numOp_Ts(ft, f.le), f.name)
+				} else {
+					interp.addLine("w.put%s(m.%s ^ %s);", numOp_Ts(ft, f.le), f.name, intValue_Ts(ft, f.xor.name))
+				}
+			})
+
+		case *AstStructType, *AstUndefType:
+			interp.wrapExist_Ts(f, func() {
+				interp.addLine("encode_%s(w, m.%s);", typeName4Ts(ft), f.name)
+			})
+
+		case *AstArrayType:
+			interp.wrapExist_Ts(f, func() {
+				limit := fmt.Sprintf("m.%s.length", f.name)
+				if !f.untilEnd {
+					limit = arrayLimitRef(node, f, "m.")
+				}
+
+				if isByteArray(ft) {
+					interp.addNewLine()
+					interp.addLine("w.putBytes(m.%s, %s);", f.name, limit)
+					return
+				}
+
+				interp.addLine("for (let i = 0; i < %s; i++) {", limit)
+				interp.pushStackFrame()
+				switch et := ft.elemType.(type) {
+				case *AstPrimType:
+					interp.addLine("w.put%s(m.%s[i]);", numOp_Ts(et, f.le), f.name)
+
+				case *AstStructType, *AstUndefType:
+					interp.addLine("encode_%s(w, m.%s[i]);", typeName4Ts(et), f.name)
+
+				default:
+					doPanic("unsupported array elem type encode: %s %s", f.name, ft)
+				}
+				interp.popStackFrame()
+				interp.addLine("}")
+				interp.addNewLine()
+			})
+
+		default:
+			doPanic("encode unsupported type: %s %s", f.name, ft)
+		}
+	}
+
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+func (interp *interpreter) decodeCheck_Ts(node *AstStructType, f *AstVarDecl, cond string, desc string) {
+	interp.addLine("if (%s) throw new RangeError(\"%s.%s: %s check failed\");", cond, node.name, f.name, desc)
+}
+
+func (interp *interpreter) visitMsgDecode_Ts(node *AstStructType) {
+	interp.addLine("export function decode_%s(r: ByteReader, m: %s): void {", node.name, node.name)
+	interp.pushStackFrame()
+
+	hasTmp := map[string]bool{}
+	for _, u := range msgFieldUnits(node) {
+		if u.bits > 0 {
+			word := bitWord_Ts(u.bits)
+			if !hasTmp[word] {
+				hasTmp[word] = true
+				interp.addLine("let %s = r.get%s();", word, numOp_Ts(u.wordType(), u.fields[0].le))
+			} else {
+				interp.addLine("%s = r.get%s();", word, numOp_Ts(u.wordType(), u.fields[0].le))
+			}
+
+			if xor := u.fields[0].xor; xor != nil {
+				interp.addLine("%s ^= %s;", word, xorWord_Ts(u, xor.name))
+			}
+
+			for idx, f := range u.fields {
+				_, bn := isIntType(f.type_)
+				val := word
+				if shift := u.bitShift(idx); shift > 0 {
+					val = fmt.Sprintf("(%s >> %s)", word, intValue_Ts(u.wordType(), fmt.Sprint(shift)))
+				}
+
+				if u.bits == 64 {
+					interp.addLine("m.%s = Number(%s & %s);", f.name, val, intValue_Ts(u.wordType(), fmt.Sprintf("0x%x", 1<<bn-1)))
+				} else {
+					interp.addLine("m.%s = %s & 0x%x;", f.name, val, 1<<bn-1)
+				}
+
+				if f.equ != nil {
+					interp.decodeCheck_Ts(node, f, fmt.Sprintf("m.%s !== %s", f.name, f.equ.name), "equal")
+				}
+
+				if f.strict {
+					interp.decodeCheck_Ts(node, f, strictCond_Ts(f), "flags")
+				}
+			}
+			interp.addNewLine()
+			continue
+		}
+
+		f := u.fields[0]
+		if isString(f.type_) {
+			interp.wrapExist_Ts(f, func() {
+				interp.decodeString_Ts(node, f)
+			})
+			continue
+		}
+
+		switch ft := f.type_.(type) {
+		case *AstPrimType:
+			if isVarInt(ft) {
+				doPanic("var int decode is not supported in ts style")
+			}
+
+			interp.wrapExist_Ts(f, func() {
+				interp.addLine("m.%s = r.get%s();", f.name, numOp_Ts(ft, f.le))
+				if f.xor != nil {
+					_, bn := isIntType(ft)
+					switch bn {
+					case 64:
+						interp.addLine("m.%s ^= %s;", f.name, intValue_Ts(ft, f.xor.name))
+
+					case 32:
+						interp.addLine("m.%s = (m.%s ^ %s) >>> 0;", f.name, f.name, f.xor.name)
+
+					default:
+						interp.addLine("m.%s = (m.%s ^ %s) & 0x%x;", f.name, f.name, f.xor.name, 1<<bn-1)
+					}
+				}
+
+				if f.max != nil {
+					interp.decodeCheck_Ts(node, f, fmt.Sprintf("m.%s > %s", f.name, f.max.name), "max")
+				}
+
+				if f.min != nil {
+					interp.decodeCheck_Ts(node, f, fmt.Sprintf("m.%s < %s", f.name, f.min.name), "min")
+				}
+
+				if f.equ != nil {
+					interp.decodeCheck_Ts(node, f, fmt.Sprintf("m.%s !== %s", f.name, intValue_Ts(ft, f.equ.name)), "equal")
+				}
+
+				if f.strict {
+					interp.decodeCheck_Ts(node, f, strictCond_Ts(f), "flags")
+				}
+			})
+
+		case *AstStructType, *AstUndefType:
+			interp.wrapExist_Ts(f, func() {
+				interp.addLine("decode_%s(r, m.%s);", typeName4Ts(ft), f.name)
+			})
+
+		case *AstArrayType:
+			if f.untilEnd && isByteArray(ft) {
+				interp.addLine("m.%s = r.getBytes(r.view.byteLength - r.pos);", f.name)
+				continue
+			}
+
+			interp.wrapExist_Ts(f, func() {
+				if isByteArray(ft) {
+					interp.addLine("m.%s = r.getBytes(%s);", f.name, arrayLimitRef(node, f, "m."))
+					return
+				}
+
+				interp.addLine("m.%s = [];", f.name)
+				if f.untilEnd {
+					interp.addLine("while (r.pos < r.view.byteLength) {")
+				} else {
+					interp.addLine("for (let i = 0; i < %s; i++) {", arrayLimitRef(node, f, "m."))
+				}
+				interp.pushStackFrame()
+				switch et := ft.elemType.(type) {
+				case *AstPrimType:
+					interp.addLine("m.%s.push(r.get%s());", f.name, numOp_Ts(et, f.le))
+
+				case *AstStructType, *AstUndefType:
+					interp.addLine("const elem = new_%s();", typeName4Ts(et))
+					interp.addLine("decode_%s(r, elem);", typeName4Ts(et))
+					interp.addLine("m.%s.push(elem);", f.name)
+
+				default:
+					doPanic("unsupported array elem type decode: %s %s", f.name, ft)
+				}
+				interp.popStackFrame()
+				interp.addLine("}")
+				interp.addNewLine()
+			})
+
+		default:
+			doPanic("decode unsupported type: %s %s", f.name, ft)
+		}
+	}
+
+	if node.mend {
+		interp.addLine("if (r.pos < r.view.byteLength) throw new RangeError(`%s: ${r.view.byteLength - r.pos} extra bytes after message end`);", node.name)
+	}
+	interp.popStackFrame()
+	interp.addLine("}")
+}
+
+func (interp *interpreter) visitMsgCodec_Ts(node *AstStructType) {
+	interp.addLine("export function new_%s(): %s {", node.name, node.name)
+	interp.pushStackFrame()
+	interp.addLine("return {")
+	interp.pushStackFrame()
+	for _, f := range node.fields {
+		interp.addLine("%s: %s,", f.name, fieldDefault_Ts(f.type_))
+	}
+	interp.popStackFrame()
+	interp.addLine("};")
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.addLine("")
+	interp.visitMsgEncode_Ts(node)
+	interp.addLine("")
+	interp.visitMsgDecode_Ts(node)
+}
+
+func (interp *interpreter) visitMsgDefine_Ts(node *AstStructType) {
+	interp.addLine("")
+	interp.addLine("export interface %s {", node.name)
+	interp.pushStackFrame()
+	for _, f := range node.fields {
+		switch ft := f.type_.(type) {
+		case *AstPrimType:
+			tn := typeName4Ts(ft)
+			if ft.flags != nil {
+				tn = ft.flags.name
+			}
+
+			if f.comment != nil {
+				interp.addLine("%s: %s; //%s %s", f.name, tn, ft.name, f.comment.value)
+			} else {
+				interp.addLine("%s: %s; //%s", f.name, tn, ft.name)
+			}
+
+		case *AstStructType, *AstUndefType, *AstArrayType:
+			if f.comment != nil {
+				interp.addLine("%s: %s; //%s", f.name, typeName4Ts(ft), f.comment.value)
+			} else {
+				interp.addLine("%s: %s;", f.name, typeName4Ts(ft))
+			}
+
+		default:
+			doPanic("unsupported type: %s %s", f.name, ft)
+		}
+	}
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.addLine("")
+
+	interp.visitMsgCodec_Ts(node)
+}
+
+func (interp *interpreter) visitTypeDef_Ts(node *AstTypeDef) {
+	interp.addLine("export type %s = %s;", node.name, typeName4Ts(node.impl))
+
+	if node.impl.astType() == AST_TP_Struct {
+		impl := node.impl.(*AstStructType)
+		oname := impl.name
+		impl.name = node.name
+		interp.visitMsgCodec_Ts(impl)
+		impl.name = oname
+	}
+}
+
+func (interp *interpreter) visitBindEncode_Ts(binds []*AstBindDef) {
+	interp.addNewLine()
+	mspace := interp.program.mspace
+	interp.addLine("export function encode%s%sMsgById(w: ByteWriter, mid: number, msg: unknown): void {", strings.ToUpper(mspace[:1]), mspace[1:])
+	interp.pushStackFrame()
+
+	interp.addLine("switch (mid) {")
+	for idx, bind := range binds {
+		if idx != 0 {
+			interp.addNewLine()
+		}
+		interp.addLine("case %s:", bind.msgId)
+		interp.pushStackFrame()
+		if len(bind.msgName) != 0 {
+			interp.addLine("encode_%s(w, msg as %s);", bind.msgName, bind.msgName)
+		}
+		interp.addLine("return;")
+		interp.popStackFrame()
+	}
+	interp.addLine("}")
+
+	interp.addNewLine()
+	interp.addLine("throw new RangeError(`unknown message id: ${mid}`);")
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.addNewLine()
+}
+
+func (interp *interpreter) visitBindDecode_Ts(binds []*AstBindDef) {
+	interp.addNewLine()
+	mspace := interp.program.mspace
+	interp.addLine("//return the decoded message, null for message without body")
+	interp.addLine("export function decode%s%sMsgById(r: ByteReader, mid: number): unknown {", strings.ToUpper(mspace[:1]), mspace[1:])
+	interp.pushStackFrame()
+
+	interp.addLine("switch (mid) {")
+	for idx, bind := range binds {
+		if idx != 0 {
+			interp.addNewLine()
+		}
+		interp.addLine("case %s: {", bind.msgId)
+		interp.pushStackFrame()
+		if len(bind.msgName) != 0 {
+			interp.addLine("const msg = new_%s();", bind.msgName)
+			interp.addLine("decode_%s(r, msg);", bind.msgName)
+			interp.addLine("return msg;")
+		} else {
+			interp.addLine("return null;")
+		}
+		interp.popStackFrame()
+		interp.addLine("}")
+	}
+	interp.addLine("}")
+
+	interp.addNewLine()
+	interp.addLine("throw new RangeError(`unknown message id: ${mid}`);")
+	interp.popStackFrame()
+	interp.addLine("}")
+	interp.addNewLine()
+}
+
+func (interp *interpreter) visitBinds_Ts(binds []*AstBindDef) {
+	interp.visitBindEncode_Ts(binds)
+	interp.visitBindDecode_Ts(binds)
+}
@@ -2,7 +2,11 @@ package protoc
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"runtime/debug"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -10,6 +14,10 @@ import (
 const (
 	INTERP_MODE_GO = iota + 1
 	INTERP_MODE_C
+	INTERP_MODE_PYTHON
+	INTERP_MODE_TS
+	INTERP_MODE_RUST
+	INTERP_MODE_JAVA
 )
 
 const (
@@ -36,6 +44,7 @@ type sourceCodeWriter interface {
 	addLine(format string, args ...interface{})
 	pushScope()
 	popSope()
+	code() []byte
 }
 
 type memCodeWriter struct {
@@ -70,6 +79,14 @@ func (w *memCodeWriter) addLine(format string, args ...interface{}) {
 	w.lines = append(w.lines, desc)
 }
 
+func (w *memCodeWriter) code() []byte {
+	if len(w.lines) == 0 {
+		return nil
+	}
+
+	return []byte(strings.Join(w.lines, "\n") + "\n")
+}
+
 func (interp *interpreter) addNewLine() {
 	if interp.lastNewLine {
 		return
@@ -80,14 +97,13 @@ func (interp *interpreter) addNewLine() {
 }
 
 func (interp *interpreter) addLine(format string, args ...interface{}) {
-	head := ""
-	space := (len(interp.callStack) - 1) * 4
-	for i := 0; i < space; i++ {
-		head += " "
-	}
-	desc := fmt.Sprintf(head+format+"\n", args...)
-	fmt.Printf(desc)
+	interp.writer.addLine(format, args...)
 	interp.lastNewLine = false
+	if len(format) == 0 {
+		interp.blankLines++
+	} else {
+		interp.blankLines = 0
+	}
 }
 
 func makeFrame(interp *interpreter, level int, upLevel *stackFrame) *stackFrame {
@@ -223,8 +239,28 @@ type interpreter struct {
 	Mode        int
 	SrcFile     string
 	lastNewLine bool
+	blankLines  int
 	binds       []*AstBindDef
 	program     *AstProgram
+	visited_C   map[string]bool
+	writer      sourceCodeWriter
+
+	//go mode: package name of the generated code, derived from mspace if empty
+	Package string
+
+	//go mode: generate AppendX/UnmarshalX on []byte instead of encode_X/decode_X on io.Writer/io.Reader
+	GoAppend bool
+
+	//go mode: arrays limited by a field are slices sized by the field instead of fixed arrays of the max
+	GoSlice bool
+
+	//generated code is written to OutFile, or a file named after the source in OutDir, or stdout if both empty.
+	//go mode: with OutDir the runtime is written to its own file shared by the package, otherwise the used part is linked in
+	OutFile string
+	OutDir  string
+
+	//rust mode: arrays are fixed arrays sized by the limit max instead of Vec
+	RustFixedArray bool
 }
 
 func (interp *interpreter) pushStackFrame() *stackFrame {
@@ -232,6 +268,7 @@ func (interp *interpreter) pushStackFrame() *stackFrame {
 	interp.callStack = append(interp.callStack, symTb)
 	interp.stackSize++
 	interp.curFrame = symTb
+	interp.writer.pushScope()
 	interp.lastNewLine = true
 	return interp.curFrame
 }
@@ -242,6 +279,7 @@ func (interp *interpreter) popStackFrame() *stackFrame {
 	interp.stackSize--
 	interp.curFrame = interp.callStack[len(interp.callStack)-1]
 	interp.curFrame.state = popFrame.state
+	interp.writer.popSope()
 	return interp.curFrame
 }
 
@@ -282,8 +320,12 @@ func (interp *interpreter) visitTraverse(program *AstProgram) {
 			interp.visitConstDef(node)
 			break
 
+		case *AstFlagsDef:
+			interp.visitFlagsDefine(node)
+			break
+
 		case *AstSrcComment:
-			interp.addLine("//" + node.value)
+			interp.addLine(interp.lineComment() + node.value)
 			break
 
 		case *AstStructType:
@@ -306,6 +348,15 @@ func (interp *interpreter) visitTraverse(program *AstProgram) {
 	}
 }
 
+//lineComment return the single line comment leader of the target language
+func (interp *interpreter) lineComment() string {
+	if interp.Mode == INTERP_MODE_PYTHON {
+		return "#"
+	}
+
+	return "//"
+}
+
 type visitVarRef func(ref *AstVarNameRef) string
 type visitBinOP func(ref *AstBinOP) string
 
@@ -329,20 +380,124 @@ func (interp *interpreter) traveseCond(top bool, node AstNode, refOp visitVarRef
 	}
 }
 
-func (interp *interpreter) wrapExist_Go(f *AstVarDecl, op func()) {
+//existJoined check if the idx-th field follows the exist if of the field right above, they share one if block
+func existJoined(node *AstStructType, idx int) bool {
+	f := node.fields[idx]
+	return idx > 0 && f.existCondFollow && node.fields[idx-1].existIf == f.existIf
+}
+
+//optionalBit return the bit of an optional field in the presence bitmap of the message
+func optionalBit(node *AstStructType, f *AstVarDecl) int {
+	for i, of := range node.optionals {
+		if of == f {
+			return i
+		}
+	}
+
+	return -1
+}
+
+//wrapExist_Go put the code of a field in an if block by its exist if or its presence bit if optional
+func (interp *interpreter) wrapExist_Go(node *AstStructType, f *AstVarDecl, op func()) {
+	idx := 0
+	for idx < len(node.fields) && node.fields[idx] != f {
+		idx++
+	}
+
+	cond := ""
 	if f.existIf != nil {
-		interp.addLine("if %s {", interp.traveseCond(true, f.existIf, visitVarRef_Go, visitBinOP_Go))
+		cond = interp.traveseCond(true, f.existIf, visitVarRef_Go, visitBinOP_Go)
+	} else if f.optional {
+		cond = fmt.Sprintf("m.%s&(1<<%d) != 0", node.presence.name, optionalBit(node, f))
+	}
+
+	if cond != "" && !existJoined(node, idx) {
+		interp.addLine("if %s {", cond)
 		interp.pushStackFrame()
 	}
 
 	op()
 
-	if f.existIf != nil {
+	if cond != "" && (idx+1 >= len(node.fields) || !existJoined(node, idx+1)) {
 		interp.popStackFrame()
 		interp.addLine("}")
 	}
 }
 
+func isByteArray(tp *AstArrayType) bool {
+	if ut, ok := tp.elemType.(*AstPrimType); ok {
+		if ok, bn := isIntType(ut); ok && bn == 8 && !isSigned(ut) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//arrayLimitRef return the element count expression of an array field, host is
+//the message accessor of the target language, eg. "m." or "m->"
+func arrayLimitRef(node *AstStructType, f *AstVarDecl, host string) string {
+	for _, lf := range node.fields {
+		if lf.name == f.limit.name {
+			return host + lf.name
+		}
+	}
+
+	return f.limit.name
+}
+
+//fieldUnit is one serialize unit of a message, it is either a single field
+//or a series of bit fields aggregated into one integer of 'bits' width
+type fieldUnit struct {
+	fields []*AstVarDecl
+	bits   int
+}
+
+//bitShift return the left shift of the idx-th field in a bit aggregate unit,
+//bit fields are packed from the most significant bit
+func (u *fieldUnit) bitShift(idx int) int {
+	used := 0
+	for i := 0; i <= idx; i++ {
+		_, bn := isIntType(u.fields[i].type_)
+		used += bn
+	}
+
+	return u.bits - used
+}
+
+//wordType return the unsigned int type of the word holding a bit aggregate unit, it takes the byte order of the first field
+func (u *fieldUnit) wordType() AstType {
+	return &AstPrimType{name: fmt.Sprintf("u%d", u.bits)}
+}
+
+//msgFieldUnits split the message fields into serialize units, the semantic
+//analyzer guarantees every bit field series closes in a 8/16/32/64 bits word
+func msgFieldUnits(node *AstStructType) []*fieldUnit {
+	units := []*fieldUnit{}
+	var aggr *fieldUnit
+	for _, f := range node.fields {
+		ok, bn := isIntType(f.type_)
+		if aggr != nil {
+			aggr.fields = append(aggr.fields, f)
+			aggr.bits += bn
+			if isBitWord(aggr.bits) {
+				aggr = nil
+			}
+			continue
+		}
+
+		if ok && bn%8 != 0 {
+			aggr = &fieldUnit{fields: []*AstVarDecl{f}, bits: bn}
+			units = append(units, aggr)
+			continue
+		}
+
+		units = append(units, &fieldUnit{fields: []*AstVarDecl{f}})
+	}
+
+	return units
+}
+
 func (interp *interpreter) visitProgram(program *AstProgram) {
 	mode := ""
 	switch interp.Mode {
@@ -352,23 +507,153 @@ func (interp *interpreter) visitProgram(program *AstProgram) {
 	case INTERP_MODE_C:
 		mode = "c single file"
 
+	case INTERP_MODE_PYTHON:
+		mode = "python"
+
+	case INTERP_MODE_TS:
+		mode = "typescript"
+
+	case INTERP_MODE_RUST:
+		mode = "rust"
+
+	case INTERP_MODE_JAVA:
+		mode = "java"
+
 	default:
 		mode = "unknown mode"
 	}
-	interp.addLine("/*")
-	interp.addLine(" * code auto generated from: %s @%s, Do NOT touch by hand!!!", interp.SrcFile, currentTimeString())
-	interp.addLine(" * generator %s; mode: %s", INTERP_VERSION, mode)
-	interp.addLine("*/")
+
+	if interp.Mode == INTERP_MODE_PYTHON {
+		interp.addLine("\"\"\"")
+		interp.addLine("code auto generated from: %s @%s, Do NOT touch by hand!!!", interp.SrcFile, currentTimeString())
+		interp.addLine("generator %s; mode: %s", INTERP_VERSION, mode)
+		interp.addLine("\"\"\"")
+	} else {
+		interp.addLine("/*")
+		interp.addLine(" * code auto generated from: %s @%s, Do NOT touch by hand!!!", interp.SrcFile, currentTimeString())
+		interp.addLine(" * generator %s; mode: %s", INTERP_VERSION, mode)
+		interp.addLine("*/")
+	}
 	interp.program = program
 
+	switch interp.Mode {
+	case INTERP_MODE_GO:
+		interp.visitPrelude_Go(program)
+
+	case INTERP_MODE_C:
+		interp.visitPrelude_C(program)
+
+	case INTERP_MODE_PYTHON:
+		interp.visitPrelude_Py(program)
+
+	case INTERP_MODE_TS:
+		interp.visitPrelude_Ts(program)
+
+	case INTERP_MODE_RUST:
+		interp.visitPrelude_Rust(program)
+
+	case INTERP_MODE_JAVA:
+		interp.visitPrelude_Java(program)
+	}
+
 	interp.visitTraverse(program)
 	interp.visitBinds()
+
+	if interp.Mode == INTERP_MODE_JAVA {
+		interp.visitEpilogue_Java(program)
+	}
 }
 
 func (interp *interpreter) visitIdGroupDefine(node *AstIdGroupDef) {
-	if interp.Mode == INTERP_MODE_GO {
+	switch interp.Mode {
+	case INTERP_MODE_GO:
 		interp.visitIdGroupDefine_Go(node)
+
+	case INTERP_MODE_C:
+		interp.visitIdGroupDefine_C(node)
+
+	case INTERP_MODE_PYTHON:
+		interp.visitIdGroupDefine_Py(node)
+
+	case INTERP_MODE_TS:
+		interp.visitIdGroupDefine_Ts(node)
+
+	case INTERP_MODE_RUST:
+		interp.visitIdGroupDefine_Rust(node)
+
+	case INTERP_MODE_JAVA:
+		interp.visitIdGroupDefine_Java(node)
+	}
+}
+
+//visitFlagsDefine add the flags type with typed masks, has/set/clear helpers and the string of the set flags
+func (interp *interpreter) visitFlagsDefine(node *AstFlagsDef) {
+	switch interp.Mode {
+	case INTERP_MODE_GO:
+		interp.visitFlagsDefine_Go(node)
+
+	case INTERP_MODE_C:
+		interp.visitFlagsDefine_C(node)
+
+	case INTERP_MODE_PYTHON:
+		interp.visitFlagsDefine_Py(node)
+
+	case INTERP_MODE_TS:
+		interp.visitFlagsDefine_Ts(node)
+
+	case INTERP_MODE_RUST:
+		interp.visitFlagsDefine_Rust(node)
+
+	case INTERP_MODE_JAVA:
+		interp.visitFlagsDefine_Java(node)
+	}
+}
+
+//hasField check if any message of the program has a field matched, the runtime of some features is only emitted when used
+func hasField(program *AstProgram, match func(f *AstVarDecl) bool) bool {
+	for _, decl := range program.decl_list {
+		if node, ok := decl.(*AstStructType); ok {
+			for _, f := range node.fields {
+				if match(f) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+//limitedString return the string field limited by field lf, nil if there is none
+func limitedString(node *AstStructType, lf *AstVarDecl) *AstVarDecl {
+	for _, f := range node.fields {
+		if isString(f.type_) && f.limit != nil && f.limit.name == lf.name {
+			return f
+		}
 	}
+
+	return nil
+}
+
+//stringLimitMax return the most bytes of a string limited by a field, the max of the limit field or the range of its type
+func stringLimitMax(node *AstStructType, f *AstVarDecl) string {
+	lf := getMsgField(node, f.limit.name)
+	if lf.max != nil {
+		return lf.max.name
+	}
+
+	_, bn := isIntType(lf.type_)
+	return fmt.Sprintf("0x%x", uint64(1)<<uint(bn)-1)
+}
+
+//flagsMask return the mask of all defined flags
+func flagsMask(node *AstFlagsDef) uint64 {
+	mask := uint64(0)
+	for _, id := range node.items {
+		mask |= 1 << uint(id.idVal)
+	}
+
+	return mask
 }
 
 func (interp *interpreter) visitBindDef(node *AstBindDef) {
@@ -380,26 +665,106 @@ func (interp *interpreter) visitBinds() {
 		return
 	}
 
-	if interp.Mode == INTERP_MODE_GO {
+	switch interp.Mode {
+	case INTERP_MODE_GO:
 		interp.visitBinds_Go(interp.binds)
+
+	case INTERP_MODE_C:
+		interp.visitBinds_C(interp.binds)
+
+	case INTERP_MODE_PYTHON:
+		interp.visitBinds_Py(interp.binds)
+
+	case INTERP_MODE_TS:
+		interp.visitBinds_Ts(interp.binds)
+
+	case INTERP_MODE_RUST:
+		interp.visitBinds_Rust(interp.binds)
+
+	case INTERP_MODE_JAVA:
+		interp.visitBinds_Java(interp.binds)
 	}
 }
 
 func (interp *interpreter) visitTypeDef(node *AstTypeDef) {
-	if interp.Mode == INTERP_MODE_GO {
+	switch interp.Mode {
+	case INTERP_MODE_GO:
 		interp.visitTypeDef_Go(node)
+
+	case INTERP_MODE_C:
+		interp.visitTypeDef_C(node)
+
+	case INTERP_MODE_PYTHON:
+		interp.visitTypeDef_Py(node)
+
+	case INTERP_MODE_TS:
+		interp.visitTypeDef_Ts(node)
+
+	case INTERP_MODE_RUST:
+		interp.visitTypeDef_Rust(node)
+
+	case INTERP_MODE_JAVA:
+		interp.visitTypeDef_Java(node)
 	}
 }
 
 func (interp *interpreter) visitConstDef(node *AstConstDef) {
-	if interp.Mode == INTERP_MODE_GO {
+	switch interp.Mode {
+	case INTERP_MODE_GO:
 		interp.visitConstDef_Go(node)
+
+	case INTERP_MODE_C:
+		interp.visitConstDef_C(node)
+
+	case INTERP_MODE_PYTHON:
+		interp.visitConstDef_Py(node)
+
+	case INTERP_MODE_TS:
+		interp.visitConstDef_Ts(node)
+
+	case INTERP_MODE_RUST:
+		interp.visitConstDef_Rust(node)
+
+	case INTERP_MODE_JAVA:
+		interp.visitConstDef_Java(node)
 	}
 }
 
 func (interp *interpreter) visitMsgDefine(node *AstStructType) {
-	if interp.Mode == INTERP_MODE_GO {
+	if interp.Mode != INTERP_MODE_GO {
+		for _, f := range node.fields {
+			if _, ok := f.type_.(*AstUnionType); ok {
+				doPanic("union fields are only supported in go mode, field: \"%s\", line: %d", f.name, f.line)
+			}
+
+			if f.sized != nil {
+				doPanic("sized by is only supported in go mode, field: \"%s\", line: %d", f.name, f.line)
+			}
+
+			if f.optional {
+				doPanic("optional fields are only supported in go mode, field: \"%s\", line: %d", f.name, f.line)
+			}
+		}
+	}
+
+	switch interp.Mode {
+	case INTERP_MODE_GO:
 		interp.visitMsgDefine_Go(node)
+
+	case INTERP_MODE_C:
+		interp.visitMsgDefine_C(node)
+
+	case INTERP_MODE_PYTHON:
+		interp.visitMsgDefine_Py(node)
+
+	case INTERP_MODE_TS:
+		interp.visitMsgDefine_Ts(node)
+
+	case INTERP_MODE_RUST:
+		interp.visitMsgDefine_Rust(node)
+
+	case INTERP_MODE_JAVA:
+		interp.visitMsgDefine_Java(node)
 	}
 }
 
@@ -604,7 +969,7 @@ func (interp *interpreter) visitBinOP(node *AstBinOP) interface{} {
 func (interp *interpreter) visitUnaryOP(node *AstUnaryOP) interface{} {
 	var rhs interface{}
 	switch node.dst.(type) {
-	case *AstBinOP, *AstUnaryOP, *AstIntConst, *AstVarNameRef:
+	case *AstBinOP, *AstUnaryOP, *AstIntConst, *AstFloatConst, *AstVarNameRef:
 		rhs = interp.visitAst(node.dst)
 		break
 
@@ -612,6 +977,18 @@ func (interp *interpreter) visitUnaryOP(node *AstUnaryOP) interface{} {
 		doPanic("error in unaryop dst, unknown ast type: %s, line: %d", node.dst, node.line)
 	}
 
+	if floatVal, ok := rhs.(float64); ok {
+		switch node.op {
+		case PLUS:
+			return floatVal
+
+		case MINUS:
+			return -floatVal
+		}
+
+		doPanic("unsupported unary operator of float: %s, line: %d", node.op, node.line)
+	}
+
 	intVal := rhs.(int)
 	switch node.op {
 	case PLUS:
@@ -661,6 +1038,10 @@ func (interp *interpreter) visitIntConst(node *AstIntConst) interface{} {
 	return node.value
 }
 
+func (interp *interpreter) visitFloatConst(node *AstFloatConst) interface{} {
+	return node.value
+}
+
 func (interp *interpreter) visitStringConst(node *AstStringConst) interface{} {
 	return node.value
 }
@@ -745,9 +1126,93 @@ func (interp *interpreter) DoInterpret(root AstNode) (result error) {
 		return errors.Errorf("root ast type should be program, actual recv: %T", root)
 	}
 
+	return interp.flush()
+}
+
+//outputPath return the file to write the generated code, empty for stdout
+func (interp *interpreter) outputPath() string {
+	if len(interp.OutFile) > 0 {
+		return filepath.Join(interp.OutDir, interp.OutFile)
+	}
+
+	if len(interp.OutDir) == 0 {
+		return ""
+	}
+
+	base := strings.TrimSuffix(filepath.Base(interp.SrcFile), filepath.Ext(interp.SrcFile))
+	switch interp.Mode {
+	case INTERP_MODE_GO:
+		base += ".go"
+
+	case INTERP_MODE_C:
+		base += ".c"
+
+	case INTERP_MODE_PYTHON:
+		base += ".py"
+
+	case INTERP_MODE_TS:
+		base += ".ts"
+
+	case INTERP_MODE_RUST:
+		base += ".rs"
+
+	case INTERP_MODE_JAVA:
+		//public class must be saved in the file of the same name
+		base = className_Java(interp.program.mspace) + ".java"
+	}
+
+	return filepath.Join(interp.OutDir, base)
+}
+
+//flush write the generated code out, go code is completed with imports and formatted first.
+//nothing is written if generation failed, so an existing output file is kept intact
+func (interp *interpreter) flush() error {
+	code := interp.writer.code()
+	var runtime []byte
+	if interp.Mode == INTERP_MODE_GO {
+		//the runtime is shared by all files in the output dir, or linked into the single file
+		var err error
+		if len(interp.OutDir) > 0 {
+			runtime, err = interp.runtimeFile_Go()
+		} else {
+			code, err = interp.linkRuntime_Go(code)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if code, err = completeFile_Go(code); err != nil {
+			return err
+		}
+	}
+
+	fpath := interp.outputPath()
+	if len(fpath) == 0 {
+		_, err := os.Stdout.Write(code)
+		return err
+	}
+
+	if err := writeFile(fpath, code); err != nil {
+		return err
+	}
+
+	if runtime != nil {
+		return writeFile(filepath.Join(interp.OutDir, interp.runtimeFileName_Go()), runtime)
+	}
 	return nil
 }
 
+func writeFile(fpath string, code []byte) error {
+	if dir := filepath.Dir(fpath); len(dir) > 0 {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	return ioutil.WriteFile(fpath, code, 0644)
+}
+
 func (interp *interpreter) visitAst(ast AstNode) interface{} {
 	//fmt.Printf("visit ast: %T\n", ast)
 	switch statement := ast.(type) {
@@ -770,6 +1235,9 @@ func (interp *interpreter) visitAst(ast AstNode) interface{} {
 	case *AstIntConst:
 		return interp.visitIntConst(statement)
 
+	case *AstFloatConst:
+		return interp.visitFloatConst(statement)
+
 	case *AstStringConst:
 		return interp.visitStringConst(statement)
 
@@ -794,11 +1262,12 @@ func (interp *interpreter) visitAst(ast AstNode) interface{} {
 }
 
 func NewInterpreter() *interpreter {
-	inter := &interpreter{}
+	inter := &interpreter{writer: &memCodeWriter{}}
 
 	symTb := makeFrame(inter, 0, nil)
 	inter.callStack = []*stackFrame{symTb}
 	inter.stackSize = 1
 	inter.curFrame = inter.callStack[0]
+	inter.visited_C = make(map[string]bool)
 	return inter
 }
@@ -3,7 +3,11 @@ package protoc
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
+	"os/exec"
 	"path"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -27,6 +31,7 @@ func TestInterp(t *testing.T) {
 	interp := NewInterpreter()
 	interp.Mode = INTERP_MODE_GO
 	interp.SrcFile = path.Base(file)
+	interp.OutFile = filepath.Join(t.TempDir(), "gen")
 	err = interp.DoInterpret(pro)
 
 	if err != nil {
@@ -37,3 +42,2137 @@ func TestInterp(t *testing.T) {
 	// 	fmt.Printf("%s %s: %v\n", va.name, va.type_, va.val)
 	// }
 }
+
+func interpFile(t *testing.T, file string, mode int, opts ...func(interp *interpreter)) {
+	body, _ := ioutil.ReadFile(file)
+	program := string(body)
+
+	p := NewParser(program)
+	analyzer := NewSemanticAnalyzer()
+
+	pro := p.Program()
+	err := analyzer.DoAnalyze(pro)
+	if err != nil {
+		t.Errorf("analyze error: %v\n", err)
+		return
+	}
+
+	interp := NewInterpreter()
+	interp.Mode = mode
+	interp.SrcFile = path.Base(file)
+	interp.OutFile = filepath.Join(t.TempDir(), "gen")
+	for _, opt := range opts {
+		opt(interp)
+	}
+	err = interp.DoInterpret(pro)
+
+	if err != nil {
+		t.Errorf("interpret error: %v\n", err)
+	}
+}
+
+//genCode generate the code of a proto source into a temp file and return it
+func genCode(t *testing.T, src string, mode int, opts ...func(interp *interpreter)) string {
+	pro := NewParser(src).Program()
+	if err := NewSemanticAnalyzer().DoAnalyze(pro); err != nil {
+		t.Fatalf("analyze error: %v", err)
+	}
+
+	interp := NewInterpreter()
+	interp.Mode = mode
+	interp.SrcFile = "gen.proto"
+	interp.OutFile = filepath.Join(t.TempDir(), "gen")
+	for _, opt := range opts {
+		opt(interp)
+	}
+
+	if err := interp.DoInterpret(pro); err != nil {
+		t.Fatalf("interpret error: %v", err)
+	}
+
+	code, err := ioutil.ReadFile(interp.OutFile)
+	if err != nil {
+		t.Fatalf("read generated file error: %v", err)
+	}
+	return string(code)
+}
+
+//backendFixtures are the protos every backend generates code for
+var backendFixtures = []string{"test", "endian", "exist", "mend", "range", "float", "bits", "flags"}
+
+//gcc compile generated c code, or compile and run it at once if main is given.
+//skipped if gcc is not installed
+func gcc(t *testing.T, code string, main string) {
+	bin, err := exec.LookPath("gcc")
+	if err != nil {
+		t.Skip("gcc not found")
+	}
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "gen.c")
+	if err := ioutil.WriteFile(src, []byte(code+main), 0644); err != nil {
+		t.Fatalf("write c code error: %v", err)
+	}
+
+	args := []string{"-Wall", "-Wextra", "-Werror", "-c", "-o", filepath.Join(dir, "gen.o"), src}
+	if main != "" {
+		args = []string{"-Wall", "-Wextra", "-Werror", "-o", filepath.Join(dir, "gen"), src}
+	}
+
+	if out, err := exec.Command(bin, args...).CombinedOutput(); err != nil {
+		t.Fatalf("gcc error: %v\n%s", err, out)
+	}
+
+	if main != "" {
+		if out, err := exec.Command(filepath.Join(dir, "gen")).CombinedOutput(); err != nil {
+			t.Errorf("run c code error: %v\n%s", err, out)
+		}
+	}
+}
+
+//checkC is the head of c test mains, CHECK returns 1 from main if the condition fails
+const checkC = `
+#include <stdio.h>
+
+#define CHECK(c) do { if (!(c)) { fprintf(stderr, "line %d: %s\n", __LINE__, #c); return 1; } } while (0)
+`
+
+//genFixture generate the code of a proto under data
+func genFixture(t *testing.T, name string, mode int, opts ...func(interp *interpreter)) string {
+	body, err := ioutil.ReadFile("../data/" + name + ".proto")
+	if err != nil {
+		t.Fatalf("read proto error: %v", err)
+	}
+	return genCode(t, string(body), mode, opts...)
+}
+
+func TestInterpC(t *testing.T) {
+	interpFile(t, "../data/test.proto", INTERP_MODE_C)
+	for _, name := range backendFixtures {
+		gcc(t, genFixture(t, name, INTERP_MODE_C), "")
+	}
+
+	main := checkC + `
+int main(void) {
+    static const uint8_t want[] = {0x45, 1, 10, 0, 0, 1, 0x1f, 0x90, 3, 'a', 'b', 'c'};
+    uint8_t data[64];
+    byte_buf buf;
+    LweMsg_Header h = {ProtoVersion, Compressed | Urgent, Lwe_msg_connect}, dh;
+    LweMsg_Connect m = {0x0a000001, 8080, 3, "abcd"}, dm;
+
+    byte_buf_init(&buf, data, sizeof(data));
+    CHECK(encode_LweMsg_Header(&buf, &h) == 0);
+    CHECK(encodeLweMsgById(&buf, h.MessageId, &m) == 0);
+    CHECK(buf.pos == sizeof(want) && memcmp(data, want, sizeof(want)) == 0);
+
+    byte_buf_init(&buf, data, sizeof(want));
+    CHECK(decode_LweMsg_Header(&buf, &dh) == 0);
+    CHECK(dh.Version == h.Version && dh.Flags == h.Flags && dh.MessageId == h.MessageId);
+    CHECK(decodeLweMsgById(&buf, dh.MessageId, &dm) == 0 && buf.pos == sizeof(want));
+    CHECK(dm.IP == m.IP && dm.Port == m.Port && dm.NameLen == 3 && memcmp(dm.Name, "abc", 3) == 0);
+    CHECK(strcmp(lwe_msgid_name(Lwe_msg_connect_ack), "Lwe_msg_connect_ack") == 0);
+
+    //short buffer, name over max, wrong version
+    byte_buf_init(&buf, data, sizeof(want) - 1);
+    CHECK(decode_LweMsg_Header(&buf, &dh) == 0 && decode_LweMsg_Connect(&buf, &dm) < 0);
+    data[8] = MaxNameSize + 1;
+    byte_buf_init(&buf, data + 2, sizeof(data) - 2);
+    CHECK(decode_LweMsg_Connect(&buf, &dm) < 0);
+    data[0] = 0x85;
+    byte_buf_init(&buf, data, sizeof(data));
+    CHECK(decode_LweMsg_Header(&buf, &dh) < 0);
+    return 0;
+}
+`
+	gcc(t, genFixture(t, "test", INTERP_MODE_C), main)
+}
+
+//python run generated python code with the main code appended, skipped if python3 is not installed
+func python(t *testing.T, code string, main string) {
+	bin, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python3 not found")
+	}
+
+	src := filepath.Join(t.TempDir(), "gen.py")
+	if err := ioutil.WriteFile(src, []byte(code+main), 0644); err != nil {
+		t.Fatalf("write python code error: %v", err)
+	}
+
+	if out, err := exec.Command(bin, src).CombinedOutput(); err != nil {
+		t.Errorf("run python code error: %v\n%s", err, out)
+	}
+}
+
+//checkPy is the head of python test mains, expect_error asserts f(*args) raises LweError
+const checkPy = `
+
+def expect_error(f, *args):
+    try:
+        f(*args)
+    except LweError:
+        return
+    raise AssertionError("%s%r should fail" % (f.__name__, args))
+`
+
+func TestInterpPython(t *testing.T) {
+	interpFile(t, "../data/test.proto", INTERP_MODE_PYTHON)
+	for _, name := range backendFixtures {
+		python(t, genFixture(t, name, INTERP_MODE_PYTHON), "")
+	}
+
+	main := checkPy + `
+
+h = LweMsg_Header(ProtoVersion, Compressed | Urgent, Lwe_msg_connect)
+m = LweMsg_Connect(0x0a000001, 8080, 3, b"abcd")
+buf = bytearray()
+encode_LweMsg_Header(buf, h)
+encodeLweMsgById(buf, h.MessageId, m)
+assert buf == bytes([0x45, 1, 10, 0, 0, 1, 0x1f, 0x90, 3]) + b"abc", buf
+
+dh = LweMsg_Header()
+off = decode_LweMsg_Header(buf, 0, dh)
+assert dh == h, dh
+dm, off = decodeLweMsgById(buf, off, dh.MessageId)
+assert off == len(buf) and dm == LweMsg_Connect(0x0a000001, 8080, 3, b"abc"), dm
+assert lwe_msgid_name(Lwe_msg_connect_ack) == "Lwe_msg_connect_ack"
+
+# short buffer, name over max, wrong version
+expect_error(decode_LweMsg_Connect, bytes(buf[2:-1]), 0, LweMsg_Connect())
+buf[8] = MaxNameSize + 1
+expect_error(decode_LweMsg_Connect, bytes(buf), 2, LweMsg_Connect())
+buf[0] = 0x85
+expect_error(decode_LweMsg_Header, bytes(buf), 0, LweMsg_Header())
+`
+	python(t, genFixture(t, "test", INTERP_MODE_PYTHON), main)
+}
+
+//tsc type check generated typescript code in strict mode, or compile and run it by node at once if main is given.
+//skipped if tsc or node is not installed
+func tsc(t *testing.T, code string, main string) {
+	bin, err := exec.LookPath("tsc")
+	if err != nil {
+		t.Skip("tsc not found")
+	}
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "gen.ts")
+	if err := ioutil.WriteFile(src, []byte(code+main), 0644); err != nil {
+		t.Fatalf("write ts code error: %v", err)
+	}
+
+	args := []string{"--strict", "--target", "es2020", "--noEmit", src}
+	if main != "" {
+		args = []string{"--strict", "--target", "es2020", "--module", "commonjs", "--outDir", dir, src}
+	}
+
+	if out, err := exec.Command(bin, args...).CombinedOutput(); err != nil {
+		t.Fatalf("tsc error: %v\n%s", err, out)
+	}
+
+	if main != "" {
+		node, err := exec.LookPath("node")
+		if err != nil {
+			t.Skip("node not found")
+		}
+
+		if out, err := exec.Command(node, filepath.Join(dir, "gen.js")).CombinedOutput(); err != nil {
+			t.Errorf("run ts code error: %v\n%s", err, out)
+		}
+	}
+}
+
+//checkTs is the head of ts test mains, expectError asserts f throws a RangeError
+const checkTs = `
+function check(ok: boolean, what: string): void {
+    if (!ok) throw new Error(what);
+}
+
+function expectError(f: () => void, what: string): void {
+    try {
+        f();
+    } catch (e) {
+        if (e instanceof RangeError) return;
+        throw e;
+    }
+    throw new Error(what + " should fail");
+}
+`
+
+func TestInterpTs(t *testing.T) {
+	interpFile(t, "../data/test.proto", INTERP_MODE_TS)
+	for _, name := range backendFixtures {
+		tsc(t, genFixture(t, name, INTERP_MODE_TS), "")
+	}
+
+	main := checkTs + `
+const h: LweMsg_Header = { Version: ProtoVersion, Flags: Compressed | Urgent, MessageId: Lwe_msg_connect };
+const m: LweMsg_Connect = { IP: 0x0a000001, Port: 8080, NameLen: 3, Name: Uint8Array.of(97, 98, 99, 100) };
+const w = new ByteWriter(4);
+encode_LweMsg_Header(w, h);
+encodeLweMsgById(w, h.MessageId, m);
+const b = w.bytes();
+check(b.join() === [0x45, 1, 10, 0, 0, 1, 0x1f, 0x90, 3, 97, 98, 99].join(), "encode " + b);
+
+const r = new ByteReader(b);
+const dh = new_LweMsg_Header();
+decode_LweMsg_Header(r, dh);
+check(JSON.stringify(dh) === JSON.stringify(h), "decode " + JSON.stringify(dh));
+const dm = decodeLweMsgById(r, dh.MessageId) as LweMsg_Connect;
+check(r.pos === b.length && dm.IP === m.IP && dm.Port === m.Port && dm.NameLen === 3 && dm.Name.join() === "97,98,99", "decode " + JSON.stringify(dm));
+check(lwe_msgid_name(Lwe_msg_connect_ack) === "Lwe_msg_connect_ack", "id name");
+
+//short buffer, name over max, wrong version
+expectError(() => decode_LweMsg_Connect(new ByteReader(b.subarray(2, b.length - 1)), new_LweMsg_Connect()), "short buffer");
+b[8] = MaxNameSize + 1;
+expectError(() => decode_LweMsg_Connect(new ByteReader(b.subarray(2)), new_LweMsg_Connect()), "name over max");
+b[0] = 0x85;
+expectError(() => decode_LweMsg_Header(new ByteReader(b), new_LweMsg_Header()), "wrong version");
+`
+	tsc(t, genFixture(t, "test", INTERP_MODE_TS), main)
+}
+
+func TestInterpRust(t *testing.T) {
+	interpFile(t, "../data/test.proto", INTERP_MODE_RUST)
+}
+
+//rustc compile generated rust code as a library, or as a program run at once if main is given.
+//skipped if rustc is not installed
+func rustc(t *testing.T, code string, main string) {
+	bin, err := exec.LookPath("rustc")
+	if err != nil {
+		t.Skip("rustc not found")
+	}
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "gen.rs")
+	if err := ioutil.WriteFile(src, []byte(code+main), 0644); err != nil {
+		t.Fatalf("write rust code error: %v", err)
+	}
+
+	args := []string{"--edition", "2021", "--crate-type", "lib", "--out-dir", dir, src}
+	if main != "" {
+		args = []string{"--edition", "2021", "-o", filepath.Join(dir, "gen"), src}
+	}
+
+	if out, err := exec.Command(bin, args...).CombinedOutput(); err != nil {
+		t.Fatalf("rustc error: %v\n%s", err, out)
+	}
+
+	if main != "" {
+		if out, err := exec.Command(filepath.Join(dir, "gen")).CombinedOutput(); err != nil {
+			t.Errorf("run rust code error: %v\n%s", err, out)
+		}
+	}
+}
+
+func TestInterpRustExist(t *testing.T) {
+	body, _ := ioutil.ReadFile("../data/exist.proto")
+	for _, fixed := range []bool{false, true} {
+		rustc(t, genCode(t, string(body), INTERP_MODE_RUST, func(interp *interpreter) {
+			interp.RustFixedArray = fixed
+		}), "")
+	}
+}
+
+func TestInterpRustVec(t *testing.T) {
+	src := "mspace lwe\nconst Fix 2\nconst N 3\ndefmsg Sub {\n A u8\n B u16\n}\n" +
+		"defmsg M {\n Fixed []u8 -> limit by Fix\n Cnt u8 -> max N\n Vals []u16 -> limit by Cnt\n Items []Sub -> limit by N\n}\n"
+	main := `
+fn main() {
+    let mut buf = Vec::new();
+    M::default().encode(&mut buf);
+    assert_eq!(buf, vec![0u8; 12]);
+
+    let m = M { Fixed: vec![1, 2, 3], Cnt: 2, Vals: vec![0x102], Items: vec![Sub { A: 7, B: 8 }] };
+    let mut buf = Vec::new();
+    m.encode(&mut buf);
+    assert_eq!(buf, vec![1, 2, 2, 1, 2, 0, 0, 7, 0, 8, 0, 0, 0, 0, 0, 0]);
+    let d = M::decode(&buf).unwrap();
+    assert_eq!(d.Vals, vec![0x102, 0]);
+    assert_eq!(d.Items[0], Sub { A: 7, B: 8 });
+    assert_eq!(d.Items[2], Sub::default());
+}
+`
+	rustc(t, genCode(t, src, INTERP_MODE_RUST), main)
+}
+
+//javac compile the generated java class cls, or compile and run it with the Main class of main at once if main is given.
+//skipped if javac or java is not installed
+func javac(t *testing.T, cls string, code string, main string) {
+	bin, err := exec.LookPath("javac")
+	if err != nil {
+		t.Skip("javac not found")
+	}
+
+	dir := t.TempDir()
+	srcs := map[string]string{cls + ".java": code}
+	if main != "" {
+		srcs["Main.java"] = main
+	}
+
+	args := []string{"-d", dir}
+	for name, src := range srcs {
+		fpath := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(fpath, []byte(src), 0644); err != nil {
+			t.Fatalf("write java code error: %v", err)
+		}
+		args = append(args, fpath)
+	}
+
+	if out, err := exec.Command(bin, args...).CombinedOutput(); err != nil {
+		t.Fatalf("javac error: %v\n%s", err, out)
+	}
+
+	if main != "" {
+		java, err := exec.LookPath("java")
+		if err != nil {
+			t.Skip("java not found")
+		}
+
+		if out, err := exec.Command(java, "-cp", dir, "Main").CombinedOutput(); err != nil {
+			t.Errorf("run java code error: %v\n%s", err, out)
+		}
+	}
+}
+
+//javaMain wrap body as the main method of the Main class, expectError asserts f throws LweException or BufferUnderflowException
+func javaMain(body string) string {
+	return `import java.nio.BufferUnderflowException;
+import java.nio.ByteBuffer;
+import java.util.Arrays;
+
+public class Main {
+    interface Body {
+        void run() throws Exception;
+    }
+
+    static void check(boolean ok, String what) {
+        if (!ok) throw new AssertionError(what);
+    }
+
+    static void expectError(Body f, String what) {
+        try {
+            f.run();
+        } catch (Lwe.LweException | BufferUnderflowException e) {
+            return;
+        } catch (Exception e) {
+            throw new AssertionError(what + ": " + e);
+        }
+        throw new AssertionError(what + " should fail");
+    }
+
+    public static void main(String[] args) throws Exception {` + body + `    }
+}
+`
+}
+
+func TestInterpJava(t *testing.T) {
+	interpFile(t, "../data/test.proto", INTERP_MODE_JAVA)
+	for _, name := range backendFixtures {
+		javac(t, "Lwe", genFixture(t, name, INTERP_MODE_JAVA), "")
+	}
+
+	main := javaMain(`
+        Lwe.LweMsg_Header h = new Lwe.LweMsg_Header();
+        h.Version = Lwe.ProtoVersion;
+        h.Flags = Lwe.Compressed | Lwe.Urgent;
+        h.MessageId = Lwe.Lwe_msg_connect;
+        Lwe.LweMsg_Connect m = new Lwe.LweMsg_Connect();
+        m.IP = 0x0a000001L;
+        m.Port = 8080;
+        m.NameLen = 3;
+        m.Name = new byte[] {'a', 'b', 'c', 'd'};
+
+        ByteBuffer buf = ByteBuffer.allocate(64);
+        h.encode(buf);
+        Lwe.encodeLweMsgById(buf, h.MessageId, m);
+        byte[] want = {0x45, 1, 10, 0, 0, 1, 0x1f, (byte) 0x90, 3, 'a', 'b', 'c'};
+        byte[] b = Arrays.copyOf(buf.array(), buf.position());
+        check(Arrays.equals(b, want), "encode " + Arrays.toString(b));
+
+        buf = ByteBuffer.wrap(b);
+        Lwe.LweMsg_Header dh = new Lwe.LweMsg_Header();
+        dh.decode(buf);
+        check(dh.Version == h.Version && dh.Flags == h.Flags && dh.MessageId == h.MessageId, "decode header");
+        Lwe.LweMsg_Connect dm = (Lwe.LweMsg_Connect) Lwe.decodeLweMsgById(buf, dh.MessageId);
+        check(!buf.hasRemaining() && dm.IP == m.IP && dm.Port == m.Port && dm.NameLen == 3, "decode connect");
+        check(Arrays.equals(dm.Name, new byte[] {'a', 'b', 'c'}), "decode name " + Arrays.toString(dm.Name));
+        check("Lwe_msg_connect_ack".equals(Lwe.lwe_msgid_name(Lwe.Lwe_msg_connect_ack)), "id name");
+
+        //short buffer, name over max, wrong version
+        expectError(() -> new Lwe.LweMsg_Connect().decode(ByteBuffer.wrap(b, 2, b.length - 3)), "short buffer");
+        b[8] = Lwe.MaxNameSize + 1;
+        expectError(() -> new Lwe.LweMsg_Connect().decode(ByteBuffer.wrap(b, 2, b.length - 2)), "name over max");
+        b[0] = (byte) 0x85;
+        expectError(() -> new Lwe.LweMsg_Header().decode(ByteBuffer.wrap(b)), "wrong version");
+`)
+	javac(t, "Lwe", genFixture(t, "test", INTERP_MODE_JAVA), main)
+}
+
+//backendRoundTrip run the c, python, ts, rust and java mains with the code generated from src,
+//each backend is a subtest so a missing toolchain only skips its own
+func backendRoundTrip(t *testing.T, src string, c, py, ts, rs, java string) {
+	t.Run("c", func(t *testing.T) {
+		gcc(t, genCode(t, src, INTERP_MODE_C), checkC+c)
+	})
+	t.Run("python", func(t *testing.T) {
+		python(t, genCode(t, src, INTERP_MODE_PYTHON), checkPy+py)
+	})
+	t.Run("ts", func(t *testing.T) {
+		tsc(t, genCode(t, src, INTERP_MODE_TS), checkTs+ts)
+	})
+	t.Run("rust", func(t *testing.T) {
+		rustc(t, genCode(t, src, INTERP_MODE_RUST), rs)
+	})
+	t.Run("java", func(t *testing.T) {
+		javac(t, "Lwe", genCode(t, src, INTERP_MODE_JAVA), javaMain(java))
+	})
+}
+
+func TestCompleteFile_Go(t *testing.T) {
+	code := "package lwe\nfunc f(buf io.Writer) int {\nif binary.Write(buf, binary.BigEndian, uint8(1)) != nil { return -1 }\nreturn 0\n}\n"
+	out, err := completeFile_Go([]byte(code))
+	if err != nil {
+		t.Fatalf("complete go file error: %v", err)
+	}
+
+	if !strings.Contains(string(out), "import (\n\t\"encoding/binary\"\n\t\"io\"\n)") {
+		t.Errorf("imports not added:\n%s", out)
+	}
+}
+
+func TestInterpOutDir(t *testing.T) {
+	body, _ := ioutil.ReadFile("../data/test.proto")
+	p := NewParser(string(body))
+	pro := p.Program()
+	if err := NewSemanticAnalyzer().DoAnalyze(pro); err != nil {
+		t.Fatalf("analyze error: %v", err)
+	}
+
+	dir := t.TempDir()
+	interp := NewInterpreter()
+	interp.Mode = INTERP_MODE_GO
+	interp.SrcFile = "../data/test.proto"
+	interp.OutDir = dir
+	if err := interp.DoInterpret(pro); err != nil {
+		t.Fatalf("interpret error: %v", err)
+	}
+
+	code, err := ioutil.ReadFile(path.Join(dir, "test.go"))
+	if err != nil {
+		t.Fatalf("read generated file error: %v", err)
+	}
+
+	if !strings.HasPrefix(string(code), "/*") || !strings.Contains(string(code), "package lwe\n") {
+		t.Errorf("unexpected generated file:\n%s", code)
+	}
+
+	//the runtime is shared by all files of the dir instead of declared in each
+	runtime, err := ioutil.ReadFile(path.Join(dir, "lwe_runtime.go"))
+	if err != nil {
+		t.Fatalf("read runtime file error: %v", err)
+	}
+
+	if strings.Contains(string(code), "type DecodeError struct") || !strings.Contains(string(runtime), "type DecodeError struct") ||
+		!strings.Contains(string(runtime), "func appendUvarint(") || !strings.Contains(string(runtime), "func (c *countReader) readCString(") {
+		t.Errorf("unexpected runtime file:\n%s", runtime)
+	}
+}
+
+func TestInterpGoRuntime(t *testing.T) {
+	body, _ := ioutil.ReadFile("../data/exist.proto")
+	code := genCode(t, string(body), INTERP_MODE_GO)
+	for _, decl := range []string{"type DecodeError struct", "func (e *DecodeError) Error() string", "func newCountReader("} {
+		if !strings.Contains(code, decl) {
+			t.Errorf("used runtime %q not linked:\n%s", decl, code)
+		}
+	}
+
+	for _, decl := range []string{"readUvarint", "readRest", "func cutString(", "func appendUvarint("} {
+		if strings.Contains(code, decl) {
+			t.Errorf("unused runtime %q linked:\n%s", decl, code)
+		}
+	}
+}
+
+//goTest write the files into a module and run its tests, skip if go is not found
+func goTest(t *testing.T, files map[string]string) {
+	bin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not found")
+	}
+
+	dir := t.TempDir()
+	files["go.mod"] = "module gen\n\ngo 1.16\n"
+	for name, code := range files {
+		fpath := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+			t.Fatalf("make dir error: %v", err)
+		}
+		if err := ioutil.WriteFile(fpath, []byte(code), 0644); err != nil {
+			t.Fatalf("write go code error: %v", err)
+		}
+	}
+
+	cmd := exec.Command(bin, "test", "./...")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go test error: %v\n%s", err, out)
+	}
+}
+
+//goExport return the code exporting the codec of every message of src by name, for the io or the append style generated with opts
+func goExport(t *testing.T, src string, pkg string, appendStyle bool, opts ...func(interp *interpreter)) string {
+	pro := NewParser(src).Program()
+	if err := NewSemanticAnalyzer().DoAnalyze(pro); err != nil {
+		t.Fatalf("analyze error: %v", err)
+	}
+
+	imports := "import \"bytes\"\n"
+	if appendStyle {
+		imports = ""
+	}
+
+	interp := NewInterpreter()
+	for _, opt := range opts {
+		opt(interp)
+	}
+
+	var names, decodes, encodes []string
+	seen := map[*AstStructType]bool{}
+	for _, decl := range pro.(*AstProgram).decl_list {
+		st, ok := decl.(*AstStructType)
+		if !ok {
+			continue
+		}
+
+		names = append(names, fmt.Sprintf("%q", st.name))
+		if !appendStyle {
+			decodes = append(decodes, fmt.Sprintf("case %q:\n\tm := &%s{}\n\tr := bytes.NewReader(b)\n\terr := decode_%s(r, m)\n\treturn m, len(b) - r.Len(), err", st.name, st.name, st.name))
+			encodes = append(encodes, fmt.Sprintf("case *%s:\n\tvar buf bytes.Buffer\n\terr := encode_%s(&buf, v)\n\treturn buf.Bytes(), err", st.name, st.name))
+			continue
+		}
+
+		decodes = append(decodes, fmt.Sprintf("case %q:\n\tm := &%s{}\n\tn, err := Unmarshal%s(b, m)\n\treturn m, n, err", st.name, st.name, st.name))
+		if interp.encodeFails_GoAppend(st, seen) {
+			encodes = append(encodes, fmt.Sprintf("case *%s:\n\treturn Append%s(nil, v)", st.name, st.name))
+		} else {
+			encodes = append(encodes, fmt.Sprintf("case *%s:\n\treturn Append%s(nil, v), nil", st.name, st.name))
+		}
+	}
+
+	return fmt.Sprintf(`package %s
+
+%s
+var Msgs = []string{%s}
+
+func Decode(name string, b []byte) (interface{}, int, error) {
+	switch name {
+	%s
+	}
+	panic(name)
+}
+
+func Encode(m interface{}) ([]byte, error) {
+	switch v := m.(type) {
+	%s
+	}
+	panic(m)
+}
+`, pkg, imports, strings.Join(names, ", "), strings.Join(decodes, "\n"), strings.Join(encodes, "\n"))
+}
+
+//goBehave run the test code in the packages of the io and the append style codec of src generated with opts,
+//it tests by Encode and Decode of goExport
+func goBehave(t *testing.T, src string, test string, opts ...func(interp *interpreter)) {
+	files := map[string]string{}
+	for _, pkg := range []string{"iop", "app"} {
+		appendStyle := pkg == "app"
+		files[pkg+"/gen.go"] = genCode(t, src, INTERP_MODE_GO, append(opts, func(interp *interpreter) {
+			interp.Package = pkg
+			interp.GoAppend = appendStyle
+		})...)
+		files[pkg+"/export.go"] = goExport(t, src, pkg, appendStyle, opts...)
+		files[pkg+"/gen_test.go"] = "package " + pkg + "\n\n" + test
+	}
+	goTest(t, files)
+}
+
+//equalTest_Go decode the same bytes by the io and the append style, then encode the results back, both must agree on everything
+const equalTest_Go = `package gen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"gen/app"
+	"gen/iop"
+)
+
+//errKey describe an error by all but its Err, which is the same in both styles only as a text
+func errKey(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	v := reflect.ValueOf(err).Elem()
+	return fmt.Sprintf("%s %s.%s at %d: %s", v.Type().Name(), v.FieldByName("Msg"), v.FieldByName("Field"), v.FieldByName("Offset").Int(), v.FieldByName("Reason"))
+}
+
+//errAt return the offset and the reason of an error of either style
+func errAt(err error) (int, string) {
+	v := reflect.ValueOf(err).Elem()
+	return int(v.FieldByName("Offset").Int()), v.FieldByName("Reason").String()
+}
+
+//input is the bytes to decode, random ones are mutated at the offset of the failure up to tries times to get through the constraints
+type input struct {
+	b     []byte
+	tries int
+}
+
+func TestEqual(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, name := range iop.Msgs {
+		var inputs []input
+		for i := 0; i < 64; i++ {
+			inputs = append(inputs, input{make([]byte, i), 0}, input{bytes.Repeat([]byte{0xff}, i), 0})
+		}
+		for i := 0; i < 500; i++ {
+			b := make([]byte, rnd.Intn(64))
+			rnd.Read(b)
+			inputs = append(inputs, input{b, 64})
+		}
+
+		valid := 0
+		for i := 0; i < len(inputs) && i < 50000; i++ {
+			b := inputs[i].b
+			im, in, ierr := iop.Decode(name, b)
+			am, an, aerr := app.Decode(name, b)
+			if errKey(ierr) != errKey(aerr) {
+				t.Fatalf("%s %x: io %v, append %v", name, b, ierr, aerr)
+			}
+
+			if ierr != nil {
+				if inputs[i].tries == 0 {
+					continue
+				}
+
+				off, reason := errAt(ierr)
+				c := append([]byte(nil), b...)
+				if off < len(c) && reason != "short" {
+					k := off + rnd.Intn(len(c)-off)
+					c[k] = byte(rnd.Intn(256) >> uint(rnd.Intn(8)))
+				} else if len(c) < 256 && rnd.Intn(2) == 0 {
+					c = append(c, byte(rnd.Intn(256)>>uint(rnd.Intn(8))))
+				} else if len(c) > 0 {
+					c[rnd.Intn(len(c))] = byte(rnd.Intn(256) >> uint(rnd.Intn(8)))
+				}
+				inputs = append(inputs, input{c, inputs[i].tries - 1})
+				continue
+			}
+
+			ij, _ := json.Marshal(im)
+			aj, _ := json.Marshal(am)
+			if in != an || !bytes.Equal(ij, aj) {
+				t.Fatalf("%s %x: io %d %s, append %d %s", name, b, in, ij, an, aj)
+			}
+
+			ib, ierr := iop.Encode(im)
+			ab, aerr := app.Encode(am)
+			if errKey(ierr) != errKey(aerr) || !bytes.Equal(ib, ab) {
+				t.Fatalf("%s %x: io %x %v, append %x %v", name, b, ib, ierr, ab, aerr)
+			}
+
+			valid++
+			if valid > 100 {
+				continue
+			}
+			for k := 0; k < in; k++ {
+				c := append([]byte(nil), b[:in]...)
+				c[k] ^= byte(1 + rnd.Intn(255))
+				inputs = append(inputs, input{b[:k], 0}, input{c, 0})
+			}
+		}
+
+		if valid == 0 {
+			t.Errorf("%s: no valid input", name)
+		}
+	}
+}
+`
+
+func TestInterpGoAppend(t *testing.T) {
+	interpFile(t, "../data/test.proto", INTERP_MODE_GO, func(interp *interpreter) {
+		interp.GoAppend = true
+	})
+
+	//the append style has the same wire bytes and errors as the io style
+	files, _ := filepath.Glob("../data/*.proto")
+	for _, file := range files {
+		body, _ := ioutil.ReadFile(file)
+		src := string(body)
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			t.Parallel()
+			goTest(t, map[string]string{
+				"iop/gen.go": genCode(t, src, INTERP_MODE_GO, func(interp *interpreter) {
+					interp.Package = "iop"
+				}),
+				"iop/export.go": goExport(t, src, "iop", false),
+				"app/gen.go": genCode(t, src, INTERP_MODE_GO, func(interp *interpreter) {
+					interp.Package = "app"
+					interp.GoAppend = true
+				}),
+				"app/export.go": goExport(t, src, "app", true),
+				"gen_test.go":   equalTest_Go,
+			})
+		})
+	}
+}
+
+func TestInterpGoVarint(t *testing.T) {
+	interpFile(t, "../data/varint.proto", INTERP_MODE_GO)
+	interpFile(t, "../data/varint.proto", INTERP_MODE_GO, func(interp *interpreter) {
+		interp.GoAppend = true
+	})
+}
+
+func TestInterpGoSlice(t *testing.T) {
+	interpFile(t, "../data/varint.proto", INTERP_MODE_GO, func(interp *interpreter) {
+		interp.GoSlice = true
+	})
+	interpFile(t, "../data/test.proto", INTERP_MODE_GO, func(interp *interpreter) {
+		interp.GoSlice = true
+		interp.GoAppend = true
+	})
+
+	//slices sharing a limit field must be of the same length, or the limit would index out of the shorter one
+	src := "mspace lwe\nconst C 4\ndefmsg M {\n N u8 -> max C\n A []u8 -> limit by N\n B []u16 -> limit by N\n}\n"
+	goBehave(t, src, `import (
+	"bytes"
+	"testing"
+)
+
+func TestShared(t *testing.T) {
+	_, err := Encode(&M{A: []uint8{1}, B: []uint16{2, 3}})
+	if ee, ok := err.(*EncodeError); !ok || ee.Field != "B" || ee.Offset != 0 || ee.Reason != "size" {
+		t.Errorf("encode slices of different lengths error %v, want size of B at 0", err)
+	}
+
+	m := &M{A: []uint8{1, 2}, B: []uint16{3, 4}}
+	want := []byte{2, 1, 2, 0, 3, 0, 4}
+	if b, err := Encode(m); err != nil || !bytes.Equal(b, want) || m.N != 2 {
+		t.Errorf("encode %x %v, want %x", b, err, want)
+	}
+}
+`, func(interp *interpreter) {
+		interp.GoSlice = true
+	})
+}
+
+func TestInterpEndian(t *testing.T) {
+	for _, mode := range []int{INTERP_MODE_GO, INTERP_MODE_C, INTERP_MODE_PYTHON, INTERP_MODE_TS, INTERP_MODE_RUST, INTERP_MODE_JAVA} {
+		interpFile(t, "../data/endian.proto", mode)
+	}
+	interpFile(t, "../data/endian.proto", INTERP_MODE_GO, func(interp *interpreter) {
+		interp.GoAppend = true
+	})
+}
+
+func TestInterpGoSigned(t *testing.T) {
+	interpFile(t, "../data/signed.proto", INTERP_MODE_GO)
+	interpFile(t, "../data/signed.proto", INTERP_MODE_GO, func(interp *interpreter) {
+		interp.GoAppend = true
+	})
+}
+
+func TestInterpSigned(t *testing.T) {
+	//s32/s64 are varints the other backends do not support, so the fixture is inlined
+	src := "mspace lwe\nconst MaxDelta 100\nconst Base -40\nconst Count 2\ndefmsg M {\n Temp i16 -> max MaxDelta\n Tiny i8 -> equal Base\n" +
+		" Lat i32 -> le\n Lon i64\n Offsets []i16 -> limit by Count\n Raw []i8 -> limit by Count\n}\n"
+
+	backendRoundTrip(t, src, `
+int main(void) {
+    static const uint8_t want[] = {0xfe, 0xd4, 0xd8, 0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfd, 0xff, 0xff, 0, 2, 0x80, 0x7f};
+    uint8_t data[64];
+    byte_buf buf;
+    M m = {-300, Base, -2, -3, {-1, 2}, {-128, 127}}, d;
+
+    byte_buf_init(&buf, data, sizeof(data));
+    CHECK(encode_M(&buf, &m) == 0 && buf.pos == sizeof(want) && memcmp(data, want, sizeof(want)) == 0);
+    byte_buf_init(&buf, data, sizeof(want));
+    CHECK(decode_M(&buf, &d) == 0 && buf.pos == sizeof(want));
+    CHECK(d.Temp == -300 && d.Tiny == -40 && d.Lat == -2 && d.Lon == -3);
+    CHECK(d.Offsets[0] == -1 && d.Offsets[1] == 2 && d.Raw[0] == -128 && d.Raw[1] == 127);
+
+    //max clamps on encode and fails decode as signed, equal fails
+    m.Temp = 200;
+    byte_buf_init(&buf, data, sizeof(data));
+    CHECK(encode_M(&buf, &m) == 0 && data[0] == 0 && data[1] == MaxDelta);
+    data[1] = MaxDelta + 1;
+    byte_buf_init(&buf, data, sizeof(want));
+    CHECK(decode_M(&buf, &d) < 0);
+    data[1] = 0;
+    data[2] = 40;
+    byte_buf_init(&buf, data, sizeof(want));
+    CHECK(decode_M(&buf, &d) < 0);
+    return 0;
+}
+`, `
+
+m = M(-300, Base, -2, -3, [-1, 2], [-128, 127])
+buf = bytearray()
+encode_M(buf, m)
+assert buf == bytes([0xfe, 0xd4, 0xd8, 0xfe] + [0xff] * 10 + [0xfd, 0xff, 0xff, 0, 2, 0x80, 0x7f]), buf.hex()
+d = M()
+assert decode_M(bytes(buf), 0, d) == len(buf) and d == m, d
+
+# max clamps on encode and fails decode as signed, equal fails
+m.Temp = 200
+b = bytearray()
+encode_M(b, m)
+assert b[:2] == bytes([0, MaxDelta]), b.hex()
+buf[0:2] = bytes([0, MaxDelta + 1])
+expect_error(decode_M, bytes(buf), 0, M())
+buf[1:3] = bytes([0, 40])
+expect_error(decode_M, bytes(buf), 0, M())
+`, `
+const m: M = { Temp: -300, Tiny: Base, Lat: -2, Lon: BigInt(-3), Offsets: [-1, 2], Raw: [-128, 127] };
+let w = new ByteWriter();
+encode_M(w, m);
+const b = w.bytes();
+check(b.join() === [0xfe, 0xd4, 0xd8, 0xfe, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 0xfd, 0xff, 0xff, 0, 2, 0x80, 0x7f].join(), "encode " + b);
+const r = new ByteReader(b);
+const d = new_M();
+decode_M(r, d);
+check(r.pos === b.length && d.Temp === -300 && d.Tiny === -40 && d.Lat === -2 && d.Lon === BigInt(-3), "decode " + d.Lon);
+check(d.Offsets.join() === "-1,2" && d.Raw.join() === "-128,127", "decode arrays");
+
+//max clamps on encode and fails decode as signed, equal fails
+m.Temp = 200;
+w = new ByteWriter();
+encode_M(w, m);
+check(w.bytes()[1] === MaxDelta, "clamp");
+b[0] = 0;
+b[1] = MaxDelta + 1;
+expectError(() => decode_M(new ByteReader(b), new_M()), "over max");
+b[1] = 0;
+b[2] = 40;
+expectError(() => decode_M(new ByteReader(b), new_M()), "not equal");
+`, `
+fn main() {
+    let m = M { Temp: -300, Tiny: Base as i8, Lat: -2, Lon: -3, Offsets: vec![-1, 2], Raw: vec![-128, 127] };
+    let mut buf = Vec::new();
+    m.encode(&mut buf);
+    assert_eq!(buf, vec![0xfe, 0xd4, 0xd8, 0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfd, 0xff, 0xff, 0, 2, 0x80, 0x7f]);
+    assert_eq!(M::decode(&buf), Ok(m.clone()));
+
+    //max clamps on encode and fails decode as signed, equal fails
+    let mut b = Vec::new();
+    M { Temp: 200, ..m }.encode(&mut b);
+    assert_eq!(b[..2], [0, MaxDelta as u8]);
+    buf[..2].copy_from_slice(&[0, MaxDelta as u8 + 1]);
+    assert_eq!(M::decode(&buf), Err(Error::Check { msg: "M", field: "Temp", reason: "max" }));
+    buf[1..3].copy_from_slice(&[0, 40]);
+    assert_eq!(M::decode(&buf), Err(Error::Check { msg: "M", field: "Tiny", reason: "equal" }));
+}
+`, `
+        Lwe.M m = new Lwe.M();
+        m.Temp = -300;
+        m.Tiny = Lwe.Base;
+        m.Lat = -2;
+        m.Lon = -3;
+        m.Offsets = new short[] {-1, 2};
+        m.Raw = new byte[] {-128, 127};
+        ByteBuffer buf = ByteBuffer.allocate(64);
+        m.encode(buf);
+        byte[] b = Arrays.copyOf(buf.array(), buf.position());
+        byte[] want = {(byte) 0xfe, (byte) 0xd4, (byte) 0xd8, (byte) 0xfe, -1, -1, -1, -1, -1, -1, -1, -1, -1, -1, (byte) 0xfd, -1, -1, 0, 2, (byte) 0x80, 0x7f};
+        check(Arrays.equals(b, want), "encode " + Arrays.toString(b));
+        Lwe.M d = new Lwe.M();
+        d.decode(ByteBuffer.wrap(b));
+        check(d.Temp == -300 && d.Tiny == -40 && d.Lat == -2 && d.Lon == -3, "decode");
+        check(Arrays.equals(d.Offsets, m.Offsets) && Arrays.equals(d.Raw, m.Raw), "decode arrays");
+
+        //max clamps on encode and fails decode as signed, equal fails
+        m.Temp = 200;
+        buf.clear();
+        m.encode(buf);
+        check(buf.get(0) == 0 && buf.get(1) == Lwe.MaxDelta, "clamp");
+        b[0] = 0;
+        b[1] = Lwe.MaxDelta + 1;
+        expectError(() -> new Lwe.M().decode(ByteBuffer.wrap(b)), "over max");
+        b[1] = 0;
+        b[2] = 40;
+        expectError(() -> new Lwe.M().decode(ByteBuffer.wrap(b)), "not equal");
+`)
+}
+
+func TestInterpGoFloat(t *testing.T) {
+	interpFile(t, "../data/float.proto", INTERP_MODE_GO)
+	interpFile(t, "../data/float.proto", INTERP_MODE_GO, func(interp *interpreter) {
+		interp.GoAppend = true
+	})
+}
+
+func TestInterpFloat(t *testing.T) {
+	//floats are put by their IEEE-754 bits, Pressure is little endian
+	body, _ := ioutil.ReadFile("../data/float.proto")
+	backendRoundTrip(t, string(body), `
+int main(void) {
+    static const uint8_t want[] = {0x41, 0xac, 0, 0, 0, 0, 0, 0, 0, 0xaa, 0x8f, 0x40, 2, 0xbf, 0xc0, 0, 0, 0x3e, 0x80, 0, 0};
+    uint8_t data[64];
+    byte_buf buf;
+    LweMsg_Telemetry m = {21.5f, 1013.25, 2, {-1.5f, 0.25f}}, d;
+
+    byte_buf_init(&buf, data, sizeof(data));
+    CHECK(encode_LweMsg_Telemetry(&buf, &m) == 0 && buf.pos == sizeof(want) && memcmp(data, want, sizeof(want)) == 0);
+    byte_buf_init(&buf, data, sizeof(want));
+    CHECK(decode_LweMsg_Telemetry(&buf, &d) == 0 && buf.pos == sizeof(want));
+    CHECK(d.Temp == 21.5f && d.Pressure == 1013.25 && d.Count == 2 && d.Readings[0] == -1.5f && d.Readings[1] == 0.25f);
+
+    //max clamps on encode and fails decode
+    m.Temp = 200;
+    byte_buf_init(&buf, data, sizeof(data));
+    CHECK(encode_LweMsg_Telemetry(&buf, &m) == 0 && data[0] == 0x42 && data[1] == 0xfb);
+    data[0] = 0x43;
+    data[1] = 0;
+    byte_buf_init(&buf, data, sizeof(want));
+    CHECK(decode_LweMsg_Telemetry(&buf, &d) < 0);
+    return 0;
+}
+`, `
+m = LweMsg_Telemetry(21.5, 1013.25, 2, [-1.5, 0.25])
+buf = bytearray()
+encode_LweMsg_Telemetry(buf, m)
+assert buf == bytes.fromhex("41ac0000" "0000000000aa8f40" "02" "bfc00000" "3e800000"), buf.hex()
+d = LweMsg_Telemetry()
+assert decode_LweMsg_Telemetry(bytes(buf), 0, d) == len(buf) and d == m, d
+
+# max clamps on encode and fails decode
+m.Temp = 200
+b = bytearray()
+encode_LweMsg_Telemetry(b, m)
+assert b[:4] == bytes.fromhex("42fb0000"), b.hex()
+buf[0:4] = bytes.fromhex("43000000")
+expect_error(decode_LweMsg_Telemetry, bytes(buf), 0, LweMsg_Telemetry())
+`, `
+const m: LweMsg_Telemetry = { Temp: 21.5, Pressure: 1013.25, Count: 2, Readings: [-1.5, 0.25] };
+let w = new ByteWriter();
+encode_LweMsg_Telemetry(w, m);
+const b = w.bytes();
+check(b.join() === [0x41, 0xac, 0, 0, 0, 0, 0, 0, 0, 0xaa, 0x8f, 0x40, 2, 0xbf, 0xc0, 0, 0, 0x3e, 0x80, 0, 0].join(), "encode " + b);
+const r = new ByteReader(b);
+const d = new_LweMsg_Telemetry();
+decode_LweMsg_Telemetry(r, d);
+check(r.pos === b.length && JSON.stringify(d) === JSON.stringify(m), "decode " + JSON.stringify(d));
+
+//max clamps on encode and fails decode
+m.Temp = 200;
+w = new ByteWriter();
+encode_LweMsg_Telemetry(w, m);
+check(w.bytes().subarray(0, 4).join() === [0x42, 0xfb, 0, 0].join(), "clamp");
+b.set([0x43, 0, 0, 0]);
+expectError(() => decode_LweMsg_Telemetry(new ByteReader(b), new_LweMsg_Telemetry()), "over max");
+`, `
+fn main() {
+    let m = LweMsg_Telemetry { Temp: 21.5, Pressure: 1013.25, Count: 2, Readings: vec![-1.5, 0.25] };
+    let mut buf = Vec::new();
+    m.encode(&mut buf);
+    assert_eq!(buf, vec![0x41, 0xac, 0, 0, 0, 0, 0, 0, 0, 0xaa, 0x8f, 0x40, 2, 0xbf, 0xc0, 0, 0, 0x3e, 0x80, 0, 0]);
+    assert_eq!(LweMsg_Telemetry::decode(&buf), Ok(m.clone()));
+
+    //max clamps on encode and fails decode
+    let mut b = Vec::new();
+    LweMsg_Telemetry { Temp: 200.0, ..m }.encode(&mut b);
+    assert_eq!(b[..4], [0x42, 0xfb, 0, 0]);
+    buf[..4].copy_from_slice(&[0x43, 0, 0, 0]);
+    assert_eq!(LweMsg_Telemetry::decode(&buf), Err(Error::Check { msg: "LweMsg_Telemetry", field: "Temp", reason: "max" }));
+}
+`, `
+        Lwe.LweMsg_Telemetry m = new Lwe.LweMsg_Telemetry();
+        m.Temp = 21.5f;
+        m.Pressure = 1013.25;
+        m.Count = 2;
+        m.Readings = new float[] {-1.5f, 0.25f};
+        ByteBuffer buf = ByteBuffer.allocate(64);
+        m.encode(buf);
+        byte[] b = Arrays.copyOf(buf.array(), buf.position());
+        byte[] want = {0x41, (byte) 0xac, 0, 0, 0, 0, 0, 0, 0, (byte) 0xaa, (byte) 0x8f, 0x40, 2, (byte) 0xbf, (byte) 0xc0, 0, 0, 0x3e, (byte) 0x80, 0, 0};
+        check(Arrays.equals(b, want), "encode " + Arrays.toString(b));
+        Lwe.LweMsg_Telemetry d = new Lwe.LweMsg_Telemetry();
+        d.decode(ByteBuffer.wrap(b));
+        check(d.Temp == 21.5f && d.Pressure == 1013.25 && d.Count == 2 && Arrays.equals(d.Readings, m.Readings), "decode");
+
+        //max clamps on encode and fails decode
+        m.Temp = 200;
+        buf.clear();
+        m.encode(buf);
+        check(buf.get(0) == 0x42 && buf.get(1) == (byte) 0xfb, "clamp");
+        b[0] = 0x43;
+        b[1] = 0;
+        expectError(() -> new Lwe.LweMsg_Telemetry().decode(ByteBuffer.wrap(b)), "over max");
+`)
+}
+
+func TestInterpGoBits(t *testing.T) {
+	//fields are packed from the most significant bit, xor applies to the whole word, a word over 8 bits takes the order of its first field
+	body, _ := ioutil.ReadFile("../data/bits.proto")
+	goBehave(t, string(body), `import (
+	"bytes"
+	"testing"
+)
+
+func TestBits(t *testing.T) {
+	m := &LweMsg_Radio{Ver: Version, Ack: 1, Rsv: 0x15, Seq: 0xabc, Kind: 0xd, Chan: 0x155, Power: 0x2aa, Rssi: 0xfff, Tick: 0x12345, Slot: 0x3f, Batt: 1}
+	want := []byte{0xb5, 0xab, 0xcd, 0x55, 0x6a, 0xf5, 0xa5, 0xc1, 0x5f, 0x34, 0x12}
+	b, err := Encode(m)
+	if err != nil || !bytes.Equal(b, want) {
+		t.Fatalf("encode %x %v, want %x", b, err, want)
+	}
+
+	v, n, err := Decode("LweMsg_Radio", b)
+	if err != nil || n != len(b) || *v.(*LweMsg_Radio) != *m {
+		t.Fatalf("decode %+v %d %v, want %+v", v, n, err, m)
+	}
+
+	b[0] ^= 0x40
+	if _, _, err := Decode("LweMsg_Radio", b); err == nil || err.(*DecodeError).Field != "Ver" || err.(*DecodeError).Reason != "equal" {
+		t.Errorf("decode Ver 3 error %v, want equal", err)
+	}
+}
+`)
+}
+
+func TestInterpBits(t *testing.T) {
+	//LweMsg_Wide packs u31 fields into a 64 bits word
+	body, _ := ioutil.ReadFile("../data/bits.proto")
+	src := string(body) + "defmsg LweMsg_Wide {\n Hi u31\n Lo u31\n Tag u2\n}\n"
+	backendRoundTrip(t, src, `
+int main(void) {
+    static const uint8_t want[] = {0xb5, 0xab, 0xcd, 0x55, 0x6a, 0xf5, 0xa5, 0xc1, 0x5f, 0x34, 0x12};
+    uint8_t data[64];
+    byte_buf buf;
+    LweMsg_Radio m = {Version, 1, 0x15, 0xabc, 0xd, 0x155, 0x2aa, 0xfff, 0x12345, 0x3f, 1}, d;
+
+    byte_buf_init(&buf, data, sizeof(data));
+    CHECK(encode_LweMsg_Radio(&buf, &m) == 0 && buf.pos == sizeof(want) && memcmp(data, want, sizeof(want)) == 0);
+    byte_buf_init(&buf, data, sizeof(want));
+    CHECK(decode_LweMsg_Radio(&buf, &d) == 0 && buf.pos == sizeof(want));
+    CHECK(d.Ver == m.Ver && d.Ack == m.Ack && d.Rsv == m.Rsv && d.Seq == m.Seq && d.Kind == m.Kind);
+    CHECK(d.Chan == m.Chan && d.Power == m.Power && d.Rssi == m.Rssi && d.Tick == m.Tick && d.Slot == m.Slot && d.Batt == m.Batt);
+
+    LweMsg_Wide w = {0x12345678, 0x2abcdef1, 2}, dw;
+    static const uint8_t wide[] = {0x24, 0x68, 0xac, 0xf0, 0xaa, 0xf3, 0x7b, 0xc6};
+    byte_buf_init(&buf, data, sizeof(data));
+    CHECK(encode_LweMsg_Wide(&buf, &w) == 0 && buf.pos == sizeof(wide) && memcmp(data, wide, sizeof(wide)) == 0);
+    byte_buf_init(&buf, data, sizeof(wide));
+    CHECK(decode_LweMsg_Wide(&buf, &dw) == 0 && dw.Hi == w.Hi && dw.Lo == w.Lo && dw.Tag == w.Tag);
+
+    //Ver 3 fails equal
+    byte_buf_init(&buf, data, sizeof(data));
+    CHECK(encode_LweMsg_Radio(&buf, &m) == 0);
+    data[0] ^= 0x40;
+    byte_buf_init(&buf, data, sizeof(want));
+    CHECK(decode_LweMsg_Radio(&buf, &d) < 0);
+    return 0;
+}
+`, `
+m = LweMsg_Radio(Version, 1, 0x15, 0xabc, 0xd, 0x155, 0x2aa, 0xfff, 0x12345, 0x3f, 1)
+buf = bytearray()
+encode_LweMsg_Radio(buf, m)
+assert buf == bytes.fromhex("b5abcd556af5a5c15f3412"), buf.hex()
+d = LweMsg_Radio()
+assert decode_LweMsg_Radio(bytes(buf), 0, d) == len(buf) and d == m, d
+
+w = LweMsg_Wide(0x12345678, 0x2abcdef1, 2)
+b = bytearray()
+encode_LweMsg_Wide(b, w)
+assert b == bytes.fromhex("2468acf0aaf37bc6"), b.hex()
+d = LweMsg_Wide()
+assert decode_LweMsg_Wide(bytes(b), 0, d) == len(b) and d == w, d
+
+# Ver 3 fails equal
+buf[0] ^= 0x40
+expect_error(decode_LweMsg_Radio, bytes(buf), 0, LweMsg_Radio())
+`, `
+const m: LweMsg_Radio = { Ver: Version, Ack: 1, Rsv: 0x15, Seq: 0xabc, Kind: 0xd, Chan: 0x155, Power: 0x2aa, Rssi: 0xfff, Tick: 0x12345, Slot: 0x3f, Batt: 1 };
+let w = new ByteWriter();
+encode_LweMsg_Radio(w, m);
+const b = w.bytes();
+check(b.join() === [0xb5, 0xab, 0xcd, 0x55, 0x6a, 0xf5, 0xa5, 0xc1, 0x5f, 0x34, 0x12].join(), "encode " + b);
+let r = new ByteReader(b);
+const d = new_LweMsg_Radio();
+decode_LweMsg_Radio(r, d);
+check(r.pos === b.length && JSON.stringify(d) === JSON.stringify(m), "decode " + JSON.stringify(d));
+
+const wide: LweMsg_Wide = { Hi: 0x12345678, Lo: 0x2abcdef1, Tag: 2 };
+w = new ByteWriter();
+encode_LweMsg_Wide(w, wide);
+check(w.bytes().join() === [0x24, 0x68, 0xac, 0xf0, 0xaa, 0xf3, 0x7b, 0xc6].join(), "encode wide " + w.bytes());
+r = new ByteReader(w.bytes());
+const dw = new_LweMsg_Wide();
+decode_LweMsg_Wide(r, dw);
+check(JSON.stringify(dw) === JSON.stringify(wide), "decode wide " + JSON.stringify(dw));
+
+//Ver 3 fails equal
+b[0] ^= 0x40;
+expectError(() => decode_LweMsg_Radio(new ByteReader(b), new_LweMsg_Radio()), "not equal");
+`, `
+fn main() {
+    let m = LweMsg_Radio { Ver: Version as u8, Ack: 1, Rsv: 0x15, Seq: 0xabc, Kind: 0xd, Chan: 0x155, Power: 0x2aa, Rssi: 0xfff, Tick: 0x12345, Slot: 0x3f, Batt: 1 };
+    let mut buf = Vec::new();
+    m.encode(&mut buf);
+    assert_eq!(buf, vec![0xb5, 0xab, 0xcd, 0x55, 0x6a, 0xf5, 0xa5, 0xc1, 0x5f, 0x34, 0x12]);
+    assert_eq!(LweMsg_Radio::decode(&buf), Ok(m.clone()));
+
+    let w = LweMsg_Wide { Hi: 0x12345678, Lo: 0x2abcdef1, Tag: 2 };
+    let mut b = Vec::new();
+    w.encode(&mut b);
+    assert_eq!(b, vec![0x24, 0x68, 0xac, 0xf0, 0xaa, 0xf3, 0x7b, 0xc6]);
+    assert_eq!(LweMsg_Wide::decode(&b), Ok(w));
+
+    //Ver 3 fails equal
+    buf[0] ^= 0x40;
+    assert_eq!(LweMsg_Radio::decode(&buf), Err(Error::Check { msg: "LweMsg_Radio", field: "Ver", reason: "equal" }));
+}
+`, `
+        Lwe.LweMsg_Radio m = new Lwe.LweMsg_Radio();
+        m.Ver = Lwe.Version;
+        m.Ack = 1;
+        m.Rsv = 0x15;
+        m.Seq = 0xabc;
+        m.Kind = 0xd;
+        m.Chan = 0x155;
+        m.Power = 0x2aa;
+        m.Rssi = 0xfff;
+        m.Tick = 0x12345;
+        m.Slot = 0x3f;
+        m.Batt = 1;
+        ByteBuffer buf = ByteBuffer.allocate(64);
+        m.encode(buf);
+        byte[] b = Arrays.copyOf(buf.array(), buf.position());
+        byte[] want = {(byte) 0xb5, (byte) 0xab, (byte) 0xcd, 0x55, 0x6a, (byte) 0xf5, (byte) 0xa5, (byte) 0xc1, 0x5f, 0x34, 0x12};
+        check(Arrays.equals(b, want), "encode " + Arrays.toString(b));
+        Lwe.LweMsg_Radio d = new Lwe.LweMsg_Radio();
+        d.decode(ByteBuffer.wrap(b));
+        check(d.Ver == m.Ver && d.Ack == m.Ack && d.Rsv == m.Rsv && d.Seq == m.Seq && d.Kind == m.Kind, "decode");
+        check(d.Chan == m.Chan && d.Power == m.Power && d.Rssi == m.Rssi && d.Tick == m.Tick && d.Slot == m.Slot && d.Batt == m.Batt, "decode");
+
+        Lwe.LweMsg_Wide w = new Lwe.LweMsg_Wide();
+        w.Hi = 0x12345678;
+        w.Lo = 0x2abcdef1;
+        w.Tag = 2;
+        buf.clear();
+        w.encode(buf);
+        byte[] wide = {0x24, 0x68, (byte) 0xac, (byte) 0xf0, (byte) 0xaa, (byte) 0xf3, 0x7b, (byte) 0xc6};
+        check(Arrays.equals(Arrays.copyOf(buf.array(), buf.position()), wide), "encode wide");
+        Lwe.LweMsg_Wide dw = new Lwe.LweMsg_Wide();
+        dw.decode(ByteBuffer.wrap(wide));
+        check(dw.Hi == w.Hi && dw.Lo == w.Lo && dw.Tag == w.Tag, "decode wide");
+
+        //Ver 3 fails equal
+        b[0] ^= 0x40;
+        expectError(() -> new Lwe.LweMsg_Radio().decode(ByteBuffer.wrap(b)), "not equal");
+`)
+}
+
+func TestInterpMin(t *testing.T) {
+	for _, mode := range []int{INTERP_MODE_GO, INTERP_MODE_C, INTERP_MODE_PYTHON, INTERP_MODE_TS, INTERP_MODE_RUST, INTERP_MODE_JAVA} {
+		interpFile(t, "../data/range.proto", mode)
+	}
+	interpFile(t, "../data/range.proto", INTERP_MODE_GO, func(interp *interpreter) {
+		interp.GoAppend = true
+	})
+}
+
+func TestInterpGoEnum(t *testing.T) {
+	interpFile(t, "../data/enum.proto", INTERP_MODE_GO)
+	interpFile(t, "../data/enum.proto", INTERP_MODE_GO, func(interp *interpreter) {
+		interp.GoAppend = true
+	})
+}
+
+func TestInterpFlags(t *testing.T) {
+	//strict flags fields reject undefined bits on decode at their offset, the others keep them
+	body, _ := ioutil.ReadFile("../data/flags.proto")
+	goBehave(t, string(body), `import (
+	"bytes"
+	"testing"
+)
+
+func TestFlags(t *testing.T) {
+	m := &LweMsg_Status{Opts: Opt_retry | Opt_local, Level: 5, Caps: Cap_lora | Cap_fsk | Cap_sleep, Hints: 0x4}
+	want := []byte{0x95, 0x03, 0x02, 0x40}
+	b, err := Encode(m)
+	if err != nil || !bytes.Equal(b, want) {
+		t.Fatalf("encode %x %v, want %x", b, err, want)
+	}
+
+	v, n, err := Decode("LweMsg_Status", b)
+	if err != nil || n != len(b) || *v.(*LweMsg_Status) != *m {
+		t.Fatalf("decode %+v %d %v, want %+v", v, n, err, m)
+	}
+	if s := v.(*LweMsg_Status).Hints.String(); s != "0x4" {
+		t.Errorf("undefined bits of Hints %q, want 0x4", s)
+	}
+
+	for _, c := range []struct {
+		b     []byte
+		field string
+		off   int
+	}{
+		{[]byte{0x45, 0x03, 0x02, 0x40}, "Opts", 0},
+		{[]byte{0x95, 0x13, 0x02, 0x40}, "Caps", 1},
+	} {
+		_, _, err := Decode("LweMsg_Status", c.b)
+		if de, ok := err.(*DecodeError); !ok || de.Field != c.field || de.Offset != c.off || de.Reason != "flags" {
+			t.Errorf("decode %x error %v, want flags of %s at %d", c.b, err, c.field, c.off)
+		}
+	}
+}
+`)
+
+	pro := NewParser("mspace lwe\ndefflags opts u8 {\n A,\n}\ndefmsg M {\n O opts\n}\n").Program()
+	if err := NewSemanticAnalyzer().DoAnalyze(pro); err != nil {
+		t.Fatalf("analyze error: %v", err)
+	}
+
+	for _, mode := range []int{INTERP_MODE_C, INTERP_MODE_PYTHON, INTERP_MODE_TS, INTERP_MODE_RUST, INTERP_MODE_JAVA} {
+		interp := NewInterpreter()
+		interp.Mode = mode
+		if err := interp.DoInterpret(pro); err != nil {
+			t.Errorf("flags in mode %d error: %v", mode, err)
+		}
+	}
+
+	//LweMsg_Wide holds flags with the top bit of u32 and u64
+	src := string(body) + "defflags lwe_mid u32 {\n M_lo = 0,\n M_top = 31,\n}\ndefflags lwe_wide u64 {\n W_lo = 0,\n W_top = 63,\n}\n" +
+		"defmsg LweMsg_Wide {\n Mid lwe_mid -> strict\n Big lwe_wide -> strict\n}\n"
+	backendRoundTrip(t, src, `
+int main(void) {
+    static const uint8_t want[] = {0x95, 0x03, 0x02, 0x40};
+    uint8_t data[64];
+    char s[64];
+    byte_buf buf;
+    LweMsg_Status m = {Opt_retry | Opt_local, 5, Cap_lora | Cap_fsk | Cap_sleep, 0x4, 0}, d;
+    LweMsg_Wide w = {M_lo | M_top, W_lo | W_top}, dw;
+
+    byte_buf_init(&buf, data, sizeof(data));
+    CHECK(encode_LweMsg_Status(&buf, &m) == 0 && buf.pos == sizeof(want) && memcmp(data, want, sizeof(want)) == 0);
+    byte_buf_init(&buf, data, sizeof(want));
+    CHECK(decode_LweMsg_Status(&buf, &d) == 0 && d.Opts == m.Opts && d.Level == 5 && d.Caps == m.Caps && d.Hints == 0x4);
+    CHECK(strcmp(lwe_opts_string(d.Opts, s, sizeof(s)), "Opt_retry|Opt_local") == 0);
+    CHECK(strcmp(lwe_caps_string(d.Caps, s, sizeof(s)), "Cap_lora|Cap_fsk|Cap_sleep") == 0);
+    CHECK(strcmp(lwe_opts_string(d.Hints, s, sizeof(s)), "0x4") == 0 && strcmp(lwe_opts_string(0, s, sizeof(s)), "0") == 0);
+    CHECK(strcmp(lwe_opts_string(d.Opts, s, 6), "Opt_r") == 0);
+    CHECK(lwe_caps_has(d.Caps, Cap_lora | Cap_sleep) && !lwe_caps_has(d.Caps, Cap_relay));
+    lwe_caps_set(&d.Caps, Cap_relay);
+    lwe_caps_clear(&d.Caps, Cap_lora | Cap_fsk);
+    CHECK(d.Caps == (Cap_relay | Cap_sleep));
+
+    //strict fields reject undefined bits, the others keep them
+    data[0] = 0x45;
+    byte_buf_init(&buf, data, sizeof(want));
+    CHECK(decode_LweMsg_Status(&buf, &d) < 0);
+    data[0] = 0x95;
+    data[1] = 0x13;
+    byte_buf_init(&buf, data, sizeof(want));
+    CHECK(decode_LweMsg_Status(&buf, &d) < 0);
+
+    byte_buf_init(&buf, data, sizeof(data));
+    CHECK(encode_LweMsg_Wide(&buf, &w) == 0 && buf.pos == 12 && data[0] == 0x80 && data[3] == 1 && data[4] == 0x80 && data[11] == 1);
+    byte_buf_init(&buf, data, 12);
+    CHECK(decode_LweMsg_Wide(&buf, &dw) == 0 && dw.Mid == w.Mid && dw.Big == w.Big);
+    CHECK(strcmp(lwe_wide_string(dw.Big | 2, s, sizeof(s)), "W_lo|W_top|0x2") == 0);
+    data[3] = 3;
+    byte_buf_init(&buf, data, 12);
+    CHECK(decode_LweMsg_Wide(&buf, &dw) < 0);
+    return 0;
+}
+`, `
+m = LweMsg_Status(Opt_retry | Opt_local, 5, Cap_lora | Cap_fsk | Cap_sleep, 0x4)
+buf = bytearray()
+encode_LweMsg_Status(buf, m)
+assert buf == bytes([0x95, 0x03, 0x02, 0x40]), buf.hex()
+d = LweMsg_Status()
+assert decode_LweMsg_Status(bytes(buf), 0, d) == len(buf) and d == m, d
+assert lwe_opts_string(d.Opts) == "Opt_retry|Opt_local"
+assert lwe_caps_string(d.Caps) == "Cap_lora|Cap_fsk|Cap_sleep"
+assert lwe_opts_string(d.Hints) == "0x4" and lwe_opts_string(0) == "0"
+assert lwe_caps_has(d.Caps, Cap_lora | Cap_sleep) and not lwe_caps_has(d.Caps, Cap_relay)
+assert lwe_caps_clear(lwe_caps_set(d.Caps, Cap_relay), Cap_lora | Cap_fsk) == Cap_relay | Cap_sleep
+
+# strict fields reject undefined bits, the others keep them
+expect_error(decode_LweMsg_Status, bytes([0x45, 0x03, 0x02, 0x40]), 0, LweMsg_Status())
+expect_error(decode_LweMsg_Status, bytes([0x95, 0x13, 0x02, 0x40]), 0, LweMsg_Status())
+
+w = LweMsg_Wide(M_lo | M_top, W_lo | W_top)
+buf = bytearray()
+encode_LweMsg_Wide(buf, w)
+assert buf == bytes.fromhex("80000001" "8000000000000001"), buf.hex()
+dw = LweMsg_Wide()
+assert decode_LweMsg_Wide(bytes(buf), 0, dw) == len(buf) and dw == w, dw
+assert lwe_wide_string(dw.Big | 2) == "W_lo|W_top|0x2"
+buf[3] = 3
+expect_error(decode_LweMsg_Wide, bytes(buf), 0, LweMsg_Wide())
+`, `
+const m: LweMsg_Status = { Opts: Opt_retry | Opt_local, Level: 5, Caps: Cap_lora | Cap_fsk | Cap_sleep, Hints: 0x4, Spare: 0 };
+let w = new ByteWriter();
+encode_LweMsg_Status(w, m);
+const b = w.bytes();
+check(b.join() === [0x95, 3, 2, 0x40].join(), "encode " + b);
+const d = new_LweMsg_Status();
+decode_LweMsg_Status(new ByteReader(b), d);
+check(JSON.stringify(d) === JSON.stringify(m), "decode " + JSON.stringify(d));
+check(lwe_opts_string(d.Opts) === "Opt_retry|Opt_local" && lwe_caps_string(d.Caps) === "Cap_lora|Cap_fsk|Cap_sleep", "string");
+check(lwe_opts_string(d.Hints) === "0x4" && lwe_opts_string(0) === "0", "string of undefined bits");
+check(lwe_caps_has(d.Caps, Cap_lora | Cap_sleep) && !lwe_caps_has(d.Caps, Cap_relay), "has");
+check(lwe_caps_clear(lwe_caps_set(d.Caps, Cap_relay), Cap_lora | Cap_fsk) === (Cap_relay | Cap_sleep), "set and clear");
+
+//strict fields reject undefined bits, the others keep them
+expectError(() => decode_LweMsg_Status(new ByteReader(Uint8Array.of(0x45, 3, 2, 0x40)), new_LweMsg_Status()), "undefined Opts");
+expectError(() => decode_LweMsg_Status(new ByteReader(Uint8Array.of(0x95, 0x13, 2, 0x40)), new_LweMsg_Status()), "undefined Caps");
+
+//M_top is the sign bit of a js int, set keeps it unsigned
+const wm: LweMsg_Wide = { Mid: lwe_mid_set(M_lo, M_top), Big: W_lo | W_top };
+w = new ByteWriter();
+encode_LweMsg_Wide(w, wm);
+const wb = w.bytes();
+check(wb.join() === [0x80, 0, 0, 1, 0x80, 0, 0, 0, 0, 0, 0, 1].join(), "encode wide " + wb);
+const dw = new_LweMsg_Wide();
+decode_LweMsg_Wide(new ByteReader(wb), dw);
+check(dw.Mid === wm.Mid && dw.Big === wm.Big && lwe_mid_has(dw.Mid, M_top), "decode wide");
+check(lwe_wide_string(dw.Big | BigInt(2)) === "W_lo|W_top|0x2", "wide string");
+wb[3] = 3;
+expectError(() => decode_LweMsg_Wide(new ByteReader(wb), new_LweMsg_Wide()), "undefined Mid");
+`, `
+fn main() {
+    let m = LweMsg_Status { Opts: Opt_retry | Opt_local, Level: 5, Caps: Cap_lora | Cap_fsk | Cap_sleep, Hints: 0x4, Spare: 0 };
+    let mut buf = Vec::new();
+    m.encode(&mut buf);
+    assert_eq!(buf, vec![0x95, 3, 2, 0x40]);
+    let mut d = LweMsg_Status::decode(&buf).unwrap();
+    assert_eq!(d, m);
+    assert_eq!(lwe_opts_string(d.Opts), "Opt_retry|Opt_local");
+    assert_eq!(lwe_caps_string(d.Caps), "Cap_lora|Cap_fsk|Cap_sleep");
+    assert_eq!(lwe_opts_string(d.Hints), "0x4");
+    assert_eq!(lwe_opts_string(0), "0");
+    assert!(lwe_caps_has(d.Caps, Cap_lora | Cap_sleep) && !lwe_caps_has(d.Caps, Cap_relay));
+    lwe_caps_set(&mut d.Caps, Cap_relay);
+    lwe_caps_clear(&mut d.Caps, Cap_lora | Cap_fsk);
+    assert_eq!(d.Caps, Cap_relay | Cap_sleep);
+
+    //strict fields reject undefined bits, the others keep them
+    assert_eq!(LweMsg_Status::decode(&[0x45, 3, 2, 0x40]), Err(Error::Check { msg: "LweMsg_Status", field: "Opts", reason: "flags" }));
+    assert_eq!(LweMsg_Status::decode(&[0x95, 0x13, 2, 0x40]), Err(Error::Check { msg: "LweMsg_Status", field: "Caps", reason: "flags" }));
+
+    let w = LweMsg_Wide { Mid: M_lo | M_top, Big: W_lo | W_top };
+    let mut b = Vec::new();
+    w.encode(&mut b);
+    assert_eq!(b, vec![0x80, 0, 0, 1, 0x80, 0, 0, 0, 0, 0, 0, 1]);
+    assert_eq!(LweMsg_Wide::decode(&b), Ok(w.clone()));
+    assert_eq!(lwe_wide_string(w.Big | 2), "W_lo|W_top|0x2");
+    b[3] = 3;
+    assert_eq!(LweMsg_Wide::decode(&b), Err(Error::Check { msg: "LweMsg_Wide", field: "Mid", reason: "flags" }));
+}
+`, `
+        Lwe.LweMsg_Status m = new Lwe.LweMsg_Status();
+        m.Opts = Lwe.Opt_retry | Lwe.Opt_local;
+        m.Level = 5;
+        m.Caps = Lwe.Cap_lora | Lwe.Cap_fsk | Lwe.Cap_sleep;
+        m.Hints = 0x4;
+        ByteBuffer buf = ByteBuffer.allocate(64);
+        m.encode(buf);
+        byte[] b = Arrays.copyOf(buf.array(), buf.position());
+        check(Arrays.equals(b, new byte[] {(byte) 0x95, 3, 2, 0x40}), "encode " + Arrays.toString(b));
+        Lwe.LweMsg_Status d = new Lwe.LweMsg_Status();
+        d.decode(ByteBuffer.wrap(b));
+        check(d.Opts == m.Opts && d.Level == 5 && d.Caps == m.Caps && d.Hints == 0x4, "decode");
+        check(Lwe.lwe_opts_string(d.Opts).equals("Opt_retry|Opt_local") && Lwe.lwe_caps_string(d.Caps).equals("Cap_lora|Cap_fsk|Cap_sleep"), "string");
+        check(Lwe.lwe_opts_string(d.Hints).equals("0x4") && Lwe.lwe_opts_string(0).equals("0"), "string of undefined bits");
+        check(Lwe.lwe_caps_has(d.Caps, Lwe.Cap_lora | Lwe.Cap_sleep) && !Lwe.lwe_caps_has(d.Caps, Lwe.Cap_relay), "has");
+        check(Lwe.lwe_caps_clear(Lwe.lwe_caps_set(d.Caps, Lwe.Cap_relay), Lwe.Cap_lora | Lwe.Cap_fsk) == (Lwe.Cap_relay | Lwe.Cap_sleep), "set and clear");
+
+        //strict fields reject undefined bits, the others keep them
+        expectError(() -> new Lwe.LweMsg_Status().decode(ByteBuffer.wrap(new byte[] {0x45, 3, 2, 0x40})), "undefined Opts");
+        expectError(() -> new Lwe.LweMsg_Status().decode(ByteBuffer.wrap(new byte[] {(byte) 0x95, 0x13, 2, 0x40})), "undefined Caps");
+
+        Lwe.LweMsg_Wide w = new Lwe.LweMsg_Wide();
+        w.Mid = Lwe.M_lo | Lwe.M_top;
+        w.Big = Lwe.W_lo | Lwe.W_top;
+        buf.clear();
+        w.encode(buf);
+        byte[] wb = Arrays.copyOf(buf.array(), buf.position());
+        check(Arrays.equals(wb, new byte[] {(byte) 0x80, 0, 0, 1, (byte) 0x80, 0, 0, 0, 0, 0, 0, 1}), "encode wide " + Arrays.toString(wb));
+        Lwe.LweMsg_Wide dw = new Lwe.LweMsg_Wide();
+        dw.decode(ByteBuffer.wrap(wb));
+        check(dw.Mid == w.Mid && dw.Big == w.Big && Lwe.lwe_wide_string(dw.Big | 2).equals("W_lo|W_top|0x2"), "decode wide");
+        wb[3] = 3;
+        expectError(() -> new Lwe.LweMsg_Wide().decode(ByteBuffer.wrap(wb)), "undefined Mid");
+`)
+}
+
+func TestInterpFlagsNote(t *testing.T) {
+	src := "mspace lwe\ndefflags opts u8 {\n //*100% retried\n A,\n}\ndefmsg M {\n O opts\n}\n"
+	for _, mode := range []int{INTERP_MODE_GO, INTERP_MODE_C, INTERP_MODE_PYTHON, INTERP_MODE_TS, INTERP_MODE_RUST, INTERP_MODE_JAVA} {
+		if code := genCode(t, src, mode); !strings.Contains(code, "100% retried") {
+			t.Errorf("flags note not kept in mode %d:\n%s", mode, code)
+		}
+	}
+}
+
+func TestInterpMend(t *testing.T) {
+	for _, mode := range []int{INTERP_MODE_GO, INTERP_MODE_C, INTERP_MODE_PYTHON, INTERP_MODE_TS, INTERP_MODE_RUST, INTERP_MODE_JAVA} {
+		interpFile(t, "../data/mend.proto", mode)
+	}
+	interpFile(t, "../data/mend.proto", INTERP_MODE_GO, func(interp *interpreter) {
+		interp.GoAppend = true
+	})
+
+	//c tells extra bytes from other errors by BYTE_BUF_EXTRA, the count is what remains in buf
+	gcc(t, genFixture(t, "mend", INTERP_MODE_C), checkC+`
+int main(void) {
+    uint8_t data[] = {0, 1, 0, 0, 0, 2, 0xaa, 0xbb};
+    byte_buf buf;
+    LweMsg_Ping m;
+
+    byte_buf_init(&buf, data, sizeof(data));
+    CHECK(decodeLweMsgById(&buf, Lwe_msg_ping, &m) == BYTE_BUF_EXTRA && buf.size - buf.pos == 2);
+    CHECK(m.Seq == 1 && m.Stamp == 2);
+    byte_buf_init(&buf, data, 6);
+    CHECK(decode_LweMsg_Ping(&buf, &m) == 0);
+    byte_buf_init(&buf, data, 5);
+    CHECK(decode_LweMsg_Ping(&buf, &m) == -1);
+    return 0;
+}
+`)
+}
+
+func TestInterpExistFollow(t *testing.T) {
+	for _, mode := range []int{INTERP_MODE_GO, INTERP_MODE_C, INTERP_MODE_PYTHON, INTERP_MODE_TS, INTERP_MODE_RUST, INTERP_MODE_JAVA} {
+		interpFile(t, "../data/exist.proto", mode)
+	}
+	interpFile(t, "../data/exist.proto", INTERP_MODE_GO, func(interp *interpreter) {
+		interp.GoAppend = true
+	})
+}
+
+func TestInterpGoUnion(t *testing.T) {
+	//the tag picks the case type, a tag without case and a value not of the case type are errors, not panics
+	body, _ := ioutil.ReadFile("../data/union.proto")
+	goBehave(t, string(body), `import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestUnion(t *testing.T) {
+	for _, c := range []struct {
+		m    interface{}
+		want []byte
+	}{
+		{&LweMsg_Frame{Kind: Lwe_kind_connect, Len: 5, Body: &LweMsg_Connect{DevId: 0x01020304, Version: 7}}, []byte{1, 5, 1, 2, 3, 4, 7}},
+		{&LweMsg_Frame{Kind: Lwe_kind_bye, Body: LweMsg_Frame_BodyRaw{0xaa, 0xbb}}, []byte{3, 0, 0xaa, 0xbb}},
+		{&LweMsg_Event{Kind: 2, Body: &LweMsg_Ping{Seq: 0x0102}, Crc: 0xbeef}, []byte{2, 1, 2, 0xbe, 0xef}},
+	} {
+		b, err := Encode(c.m)
+		if err != nil || !bytes.Equal(b, c.want) {
+			t.Fatalf("encode %+v %x %v, want %x", c.m, b, err, c.want)
+		}
+
+		v, n, err := Decode(reflect.TypeOf(c.m).Elem().Name(), b)
+		if err != nil || n != len(b) || !reflect.DeepEqual(v, c.m) {
+			t.Fatalf("decode %x %+v %d %v, want %+v", b, v, n, err, c.m)
+		}
+	}
+
+	for _, c := range []struct {
+		m      interface{}
+		off    int
+		reason string
+	}{
+		{&LweMsg_Frame{Kind: Lwe_kind_ping, Body: &LweMsg_Connect{}}, 2, "union"},
+		{&LweMsg_Event{Kind: 3, Body: &LweMsg_Ping{}}, 1, "tag"},
+	} {
+		_, err := Encode(c.m)
+		if ee, ok := err.(*EncodeError); !ok || ee.Field != "Body" || ee.Offset != c.off || ee.Reason != c.reason {
+			t.Errorf("encode %+v error %v, want %s of Body at %d", c.m, err, c.reason, c.off)
+		}
+	}
+
+	_, _, err := Decode("LweMsg_Event", []byte{3, 0, 0, 0xbe, 0xef})
+	if de, ok := err.(*DecodeError); !ok || de.Field != "Body" || de.Offset != 1 || de.Reason != "tag" {
+		t.Errorf("decode tag 3 error %v, want tag of Body at 1", err)
+	}
+}
+`)
+
+	//a union value not matching its tag is an error returned by AppendX, of the messages nesting it too
+	src := "mspace lwe\ndefmsg A {\n X u8\n}\ndefmsg M {\n K u8\n Body switch K {\n 1: A\n }\n}\ndefmsg N {\n M M\n A A\n}\n"
+	code := genCode(t, src, INTERP_MODE_GO, func(interp *interpreter) {
+		interp.GoAppend = true
+	})
+	for _, line := range []string{
+		"func AppendA(dst []byte, m *A) []byte {",
+		"func AppendM(dst []byte, m *M) ([]byte, error) {",
+		"func AppendN(dst []byte, m *N) ([]byte, error) {",
+		"if dst, err = AppendM(dst, &m.M); err != nil {",
+		"dst = AppendA(dst, &m.A)",
+	} {
+		if !strings.Contains(code, line) {
+			t.Errorf("append code should contain %q", line)
+		}
+	}
+	if strings.Contains(code, "panic(") {
+		t.Errorf("append code should not panic")
+	}
+}
+
+func TestInterpGoOptional(t *testing.T) {
+	//the presence bitmap leads the message, only the fields set present are encoded
+	body, _ := ioutil.ReadFile("../data/optional.proto")
+	goBehave(t, string(body), `import (
+	"bytes"
+	"testing"
+)
+
+func TestOptional(t *testing.T) {
+	m := &LweMsg_Report{DevId: 0x0a0b0c0d, Humid: 7, NameLen: 3, Seq: 9}
+	m.SetTemp(0x1234)
+	m.SetPing(LweMsg_Ping{Seq: 0x0506})
+	want := []byte{0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x12, 0x34, 0, 0x05, 0x06, 9}
+	b, err := Encode(m)
+	if err != nil || !bytes.Equal(b, want) {
+		t.Fatalf("encode %x %v, want %x", b, err, want)
+	}
+
+	v, n, err := Decode("LweMsg_Report", b)
+	r := v.(*LweMsg_Report)
+	if err != nil || n != len(b) || !r.HasTemp() || r.HasHumid() || r.HasName() || !r.HasPing() || r.Temp != 0x1234 || r.Ping.Seq != 0x0506 || r.Seq != 9 {
+		t.Fatalf("decode %+v %d %v, want %+v", v, n, err, m)
+	}
+
+	m.ClearTemp()
+	m.SetName([LWE_NAME_MAX]uint8{'a', 'b'})
+	m.NameLen = 2
+	want = []byte{0x0c, 0x0a, 0x0b, 0x0c, 0x0d, 2, 'a', 'b', 0x05, 0x06, 9}
+	if b, err := Encode(m); err != nil || !bytes.Equal(b, want) || m.Temp != 0x1234 {
+		t.Fatalf("encode %x %v, want %x", b, err, want)
+	}
+
+	_, _, err = Decode("LweMsg_Report", []byte{0x10, 0x0a, 0x0b, 0x0c, 0x0d, 0, 9})
+	if de, ok := err.(*DecodeError); !ok || de.Offset != 0 || de.Reason != "optional" {
+		t.Errorf("decode presence 0x10 error %v, want optional at 0", err)
+	}
+}
+`)
+
+	//an absent optional array encodes 0 for its limit field, in the array and the slice mode alike
+	src := "mspace lwe\nconst C 4\ndefmsg M {\n N u8 -> max C\n A []u8 -> limit by N optional\n}\n"
+	for _, slice := range []bool{false, true} {
+		code := genCode(t, src, INTERP_MODE_GO, func(interp *interpreter) {
+			interp.GoSlice = slice
+		})
+		if !strings.Contains(code, "if !m.HasA() {\n\t\tm.N = 0\n\t}") {
+			t.Errorf("limit field of absent optional array should be 0, slice: %v", slice)
+		}
+	}
+}
+
+func TestInterpGoSized(t *testing.T) {
+	//encode sets the size, decode skips the unknown bytes after the message within the size, too long fails
+	body, _ := ioutil.ReadFile("../data/sized.proto")
+	big := "const BigN 300\ndefmsg LweMsg_Big {\n Data []u8 -> limit by BigN\n}\ndefmsg LweMsg_Wrap {\n Len u8\n Big LweMsg_Big -> sized by Len\n}\n"
+	union := "defmsg LweMsg_U {\n K u8\n B switch K {\n 1: LweMsg_Connect\n }\n}\ndefmsg LweMsg_WrapU {\n Seq u8\n Len u8\n U LweMsg_U -> sized by Len\n}\n"
+	goBehave(t, string(body)+big+union, `import (
+	"bytes"
+	"testing"
+)
+
+func TestSized(t *testing.T) {
+	m := &LweMsg_Hello{Seq: 1, Payload: LweMsg_Connect{DevId: 0x01020304, Version: 2}, Ext: LweMsg_Connect{DevId: 5, Version: 6}, Crc: 0xbeef}
+	want := []byte{1, 0, 5, 1, 2, 3, 4, 2, 5, 0, 0, 0, 5, 6, 0xbe, 0xef}
+	b, err := Encode(m)
+	if err != nil || !bytes.Equal(b, want) || m.PayloadLen != 5 || m.ExtLen != 5 {
+		t.Fatalf("encode %x %v, want %x", b, err, want)
+	}
+
+	newer := []byte{1, 0, 7, 1, 2, 3, 4, 2, 0xff, 0xff, 5, 0, 0, 0, 5, 6, 0xbe, 0xef}
+	v, n, err := Decode("LweMsg_Hello", newer)
+	if r := v.(*LweMsg_Hello); err != nil || n != len(newer) || r.Payload != m.Payload || r.PayloadLen != 7 || r.Ext != m.Ext || r.Crc != m.Crc {
+		t.Fatalf("decode %x %+v %d %v, want %+v", newer, v, n, err, m)
+	}
+
+	_, _, err = Decode("LweMsg_Hello", newer[:9])
+	if de, ok := err.(*DecodeError); !ok || de.Field != "Payload" || de.Offset != 9 || de.Reason != "short" {
+		t.Errorf("decode cut in the unknown bytes error %v, want short of Payload at 9", err)
+	}
+
+	_, _, err = Decode("LweMsg_Hello", newer[:5])
+	if de, ok := err.(*DecodeError); !ok || de.Msg != "LweMsg_Connect" || de.Field != "DevId" || de.Offset != 3 || de.Reason != "short" {
+		t.Errorf("decode cut in the message error %v, want short of LweMsg_Connect.DevId at 3", err)
+	}
+
+	_, err = Encode(&LweMsg_Wrap{})
+	if ee, ok := err.(*EncodeError); !ok || ee.Field != "Big" || ee.Offset != 1 || ee.Reason != "size" {
+		t.Errorf("encode 300 bytes sized by u8 error %v, want size of Big at 1", err)
+	}
+
+	_, err = Encode(&LweMsg_WrapU{U: LweMsg_U{K: 2}})
+	if ee, ok := err.(*EncodeError); !ok || ee.Msg != "LweMsg_U" || ee.Field != "B" || ee.Offset != 3 || ee.Reason != "tag" {
+		t.Errorf("encode tag 2 in a sized message error %v, want tag of LweMsg_U.B at 3", err)
+	}
+}
+`)
+
+	//a sized message too long for its size field is an error returned by AppendX, not for a u64 size field
+	src := "mspace lwe\ndefmsg A {\n X u8\n}\ndefmsg M {\n L u8\n P A -> sized by L\n}\ndefmsg W {\n L u64\n P A -> sized by L\n}\n"
+	code := genCode(t, src, INTERP_MODE_GO, func(interp *interpreter) {
+		interp.GoAppend = true
+	})
+	for _, line := range []string{
+		"func AppendM(dst []byte, m *M) ([]byte, error) {",
+		"func AppendW(dst []byte, m *W) []byte {",
+		"if uint64(len(dst)-startP) > 0xff {",
+	} {
+		if !strings.Contains(code, line) {
+			t.Errorf("append code should contain %q", line)
+		}
+	}
+	if strings.Contains(code, "panic(") {
+		t.Errorf("append code should not panic")
+	}
+}
+
+func TestInterpGoOnly(t *testing.T) {
+	//the go only features are rejected by every other backend
+	sources := map[string]string{
+		"union":    "mspace lwe\ndefmsg A {\n X u8\n}\ndefmsg M {\n K u8\n Body switch K {\n 1: A\n }\n}\n",
+		"optional": "mspace lwe\ndefmsg M {\n A u8 -> optional\n}\n",
+		"sized by": "mspace lwe\ndefmsg A {\n X u8\n}\ndefmsg M {\n L u8\n P A -> sized by L\n}\n",
+		"varint":   "mspace lwe\ndefmsg M {\n A v32\n}\n",
+	}
+	modes := map[string]int{
+		"c":      INTERP_MODE_C,
+		"python": INTERP_MODE_PYTHON,
+		"ts":     INTERP_MODE_TS,
+		"rust":   INTERP_MODE_RUST,
+		"java":   INTERP_MODE_JAVA,
+	}
+	for feature, src := range sources {
+		for name, mode := range modes {
+			pro := NewParser(src).Program()
+			if err := NewSemanticAnalyzer().DoAnalyze(pro); err != nil {
+				t.Fatalf("%s analyze error: %v", feature, err)
+			}
+
+			interp := NewInterpreter()
+			interp.Mode = mode
+			if err := interp.DoInterpret(pro); err == nil {
+				t.Errorf("%s in %s mode should fail", feature, name)
+			}
+		}
+	}
+}
+
+func TestInterpGoUntilEnd(t *testing.T) {
+	//an until end array takes the elements up to the end of the input, or of the sized region when nested
+	body, _ := ioutil.ReadFile("../data/until.proto")
+	goBehave(t, string(body), `import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestUntilEnd(t *testing.T) {
+	m := &LweMsg_Batch{
+		Log:  LweMsg_LogUpload{DevId: 1, Seq: 2, Data: []byte{0xaa, 0xbb, 0xcc}},
+		Tail: LweMsg_Samples{DevId: 3, Items: []LweMsg_Sample{{Ts: 4, Value: -2}}},
+	}
+	want := []byte{0, 9, 0, 0, 0, 1, 0, 2, 0xaa, 0xbb, 0xcc, 0, 0, 0, 3, 0, 0, 0, 4, 0xff, 0xfe}
+	b, err := Encode(m)
+	if err != nil || !bytes.Equal(b, want) {
+		t.Fatalf("encode %x %v, want %x", b, err, want)
+	}
+
+	v, n, err := Decode("LweMsg_Batch", b)
+	if err != nil || n != len(b) || !reflect.DeepEqual(v, m) {
+		t.Fatalf("decode %+v %d %v, want %+v", v, n, err, m)
+	}
+
+	v, n, err = Decode("LweMsg_LogUpload", []byte{0, 0, 0, 1, 0, 2})
+	if err != nil || n != 6 || len(v.(*LweMsg_LogUpload).Data) != 0 {
+		t.Errorf("decode no data %+v %d %v, want empty", v, n, err)
+	}
+
+	levels := &LweMsg_Levels{Levels: []uint16{0x0102, 0x0304}}
+	if b, err := Encode(levels); err != nil || !bytes.Equal(b, []byte{2, 1, 4, 3}) {
+		t.Errorf("encode %x %v, want 02010403", b, err)
+	}
+
+	for _, c := range []struct {
+		name  string
+		b     []byte
+		msg   string
+		field string
+		off   int
+	}{
+		{"LweMsg_Levels", []byte{2, 1, 4}, "LweMsg_Levels", "Levels", 2},
+		{"LweMsg_Samples", []byte{0, 0, 0, 3, 0, 0, 0, 4, 0xff, 0xfe, 0, 0, 0}, "LweMsg_Sample", "Ts", 10},
+	} {
+		_, _, err := Decode(c.name, c.b)
+		if de, ok := err.(*DecodeError); !ok || de.Msg != c.msg || de.Field != c.field || de.Offset != c.off || de.Reason != "short" {
+			t.Errorf("decode %s %x error %v, want short of %s.%s at %d", c.name, c.b, err, c.msg, c.field, c.off)
+		}
+	}
+}
+`)
+}
+
+func TestInterpUntilEnd(t *testing.T) {
+	//sized by is go only, so LweMsg_Batch is replaced by LweMsg_Frame nesting an until end message as its last field
+	body, _ := ioutil.ReadFile("../data/until.proto")
+	src := string(body)
+	src = src[:strings.Index(src, "defmsg LweMsg_Batch")] + "defmsg LweMsg_Frame {\n Kind u8\n Tail LweMsg_Samples\n}\n"
+	backendRoundTrip(t, src, `
+int main(void) {
+    static const uint8_t want[] = {9, 0, 0, 0, 3, 0, 0, 0, 4, 0xff, 0xfe, 0, 0, 0, 5, 0, 1};
+    uint8_t data[64];
+    byte_buf buf;
+    LweMsg_LogUpload log = {1, 2, {0xaa, 0xbb, 0xcc}, 3}, dlog;
+    LweMsg_Frame m = {9, {3, {{4, -2}, {5, 1}}, 2}}, d;
+    LweMsg_Levels levels = {{0x0102, 0x0304}, 2}, dlevels;
+
+    byte_buf_init(&buf, data, sizeof(data));
+    CHECK(encode_LweMsg_Frame(&buf, &m) == 0 && buf.pos == sizeof(want) && memcmp(data, want, sizeof(want)) == 0);
+    byte_buf_init(&buf, data, sizeof(want));
+    CHECK(decode_LweMsg_Frame(&buf, &d) == 0 && buf.pos == sizeof(want) && d.Kind == 9 && d.Tail.DevId == 3 && d.Tail.Items_count == 2);
+    CHECK(d.Tail.Items[0].Ts == 4 && d.Tail.Items[0].Value == -2 && d.Tail.Items[1].Ts == 5 && d.Tail.Items[1].Value == 1);
+
+    byte_buf_init(&buf, data, sizeof(data));
+    CHECK(encode_LweMsg_LogUpload(&buf, &log) == 0 && buf.pos == 9 && data[8] == 0xcc);
+    byte_buf_init(&buf, data, 9);
+    CHECK(decode_LweMsg_LogUpload(&buf, &dlog) == 0 && dlog.Data_count == 3 && memcmp(dlog.Data, log.Data, 3) == 0);
+    byte_buf_init(&buf, data, 6);
+    CHECK(decode_LweMsg_LogUpload(&buf, &dlog) == 0 && dlog.Data_count == 0);
+    log.Data_count = UNTIL_END_MAX + 1;
+    byte_buf_init(&buf, data, sizeof(data));
+    CHECK(encode_LweMsg_LogUpload(&buf, &log) < 0);
+
+    //a trailing partial element is short
+    byte_buf_init(&buf, data, sizeof(data));
+    CHECK(encode_LweMsg_Levels(&buf, &levels) == 0 && buf.pos == 4 && data[0] == 2 && data[3] == 3);
+    byte_buf_init(&buf, data, 4);
+    CHECK(decode_LweMsg_Levels(&buf, &dlevels) == 0 && dlevels.Levels_count == 2 && dlevels.Levels[1] == 0x0304);
+    byte_buf_init(&buf, data, 3);
+    CHECK(decode_LweMsg_Levels(&buf, &dlevels) < 0);
+    return 0;
+}
+`, `
+m = LweMsg_Frame(9, LweMsg_Samples(3, [LweMsg_Sample(4, -2), LweMsg_Sample(5, 1)]))
+buf = bytearray()
+encode_LweMsg_Frame(buf, m)
+assert buf == bytes([9, 0, 0, 0, 3, 0, 0, 0, 4, 0xff, 0xfe, 0, 0, 0, 5, 0, 1]), buf.hex()
+d = LweMsg_Frame()
+assert decode_LweMsg_Frame(bytes(buf), 0, d) == len(buf) and d == m, d
+
+log = LweMsg_LogUpload(1, 2, b"\xaa\xbb\xcc")
+buf = bytearray()
+encode_LweMsg_LogUpload(buf, log)
+assert buf == bytes([0, 0, 0, 1, 0, 2, 0xaa, 0xbb, 0xcc]), buf.hex()
+d = LweMsg_LogUpload()
+assert decode_LweMsg_LogUpload(bytes(buf), 0, d) == len(buf) and d == log, d
+d = LweMsg_LogUpload()
+assert decode_LweMsg_LogUpload(bytes(buf[:6]), 0, d) == 6 and d.Data == b"", d
+
+# a trailing partial element is short
+buf = bytearray()
+encode_LweMsg_Levels(buf, LweMsg_Levels([0x0102, 0x0304]))
+assert buf == bytes([2, 1, 4, 3]), buf.hex()
+d = LweMsg_Levels()
+assert decode_LweMsg_Levels(bytes(buf), 0, d) == 4 and d.Levels == [0x0102, 0x0304], d
+expect_error(decode_LweMsg_Levels, bytes(buf[:3]), 0, LweMsg_Levels())
+`, `
+const m: LweMsg_Frame = { Kind: 9, Tail: { DevId: 3, Items: [{ Ts: 4, Value: -2 }, { Ts: 5, Value: 1 }] } };
+let w = new ByteWriter();
+encode_LweMsg_Frame(w, m);
+const b = w.bytes();
+check(b.join() === [9, 0, 0, 0, 3, 0, 0, 0, 4, 0xff, 0xfe, 0, 0, 0, 5, 0, 1].join(), "encode " + b);
+let r = new ByteReader(b);
+const d = new_LweMsg_Frame();
+decode_LweMsg_Frame(r, d);
+check(r.pos === b.length && JSON.stringify(d) === JSON.stringify(m), "decode " + JSON.stringify(d));
+
+const log: LweMsg_LogUpload = { DevId: 1, Seq: 2, Data: Uint8Array.of(0xaa, 0xbb, 0xcc) };
+w = new ByteWriter();
+encode_LweMsg_LogUpload(w, log);
+const lb = w.bytes();
+check(lb.join() === [0, 0, 0, 1, 0, 2, 0xaa, 0xbb, 0xcc].join(), "encode log " + lb);
+const dlog = new_LweMsg_LogUpload();
+decode_LweMsg_LogUpload(new ByteReader(lb), dlog);
+check(dlog.Data.join() === log.Data.join(), "decode log " + dlog.Data);
+decode_LweMsg_LogUpload(new ByteReader(lb.subarray(0, 6)), dlog);
+check(dlog.Data.length === 0, "decode no data");
+
+//a trailing partial element is short
+w = new ByteWriter();
+encode_LweMsg_Levels(w, { Levels: [0x0102, 0x0304] });
+const vb = w.bytes();
+check(vb.join() === [2, 1, 4, 3].join(), "encode levels " + vb);
+const dlevels = new_LweMsg_Levels();
+decode_LweMsg_Levels(new ByteReader(vb), dlevels);
+check(dlevels.Levels.join() === [0x0102, 0x0304].join(), "decode levels");
+expectError(() => decode_LweMsg_Levels(new ByteReader(vb.subarray(0, 3)), new_LweMsg_Levels()), "partial level");
+`, `
+fn main() {
+    let m = LweMsg_Frame { Kind: 9, Tail: LweMsg_Samples { DevId: 3, Items: vec![LweMsg_Sample { Ts: 4, Value: -2 }, LweMsg_Sample { Ts: 5, Value: 1 }] } };
+    let mut buf = Vec::new();
+    m.encode(&mut buf);
+    assert_eq!(buf, vec![9, 0, 0, 0, 3, 0, 0, 0, 4, 0xff, 0xfe, 0, 0, 0, 5, 0, 1]);
+    assert_eq!(LweMsg_Frame::decode(&buf), Ok(m));
+
+    let log = LweMsg_LogUpload { DevId: 1, Seq: 2, Data: vec![0xaa, 0xbb, 0xcc] };
+    let mut buf = Vec::new();
+    log.encode(&mut buf);
+    assert_eq!(buf, vec![0, 0, 0, 1, 0, 2, 0xaa, 0xbb, 0xcc]);
+    assert_eq!(LweMsg_LogUpload::decode(&buf), Ok(log.clone()));
+    assert_eq!(LweMsg_LogUpload::decode(&buf[..6]).map(|d| d.Data.len()), Ok(0));
+
+    //a trailing partial element is short
+    let levels = LweMsg_Levels { Levels: vec![0x0102, 0x0304] };
+    let mut buf = Vec::new();
+    levels.encode(&mut buf);
+    assert_eq!(buf, vec![2, 1, 4, 3]);
+    assert_eq!(LweMsg_Levels::decode(&buf), Ok(levels));
+    assert_eq!(LweMsg_Levels::decode(&buf[..3]), Err(Error::Short { need: 2, offset: 2 }));
+}
+`, `
+        Lwe.LweMsg_Frame m = new Lwe.LweMsg_Frame();
+        m.Kind = 9;
+        m.Tail.DevId = 3;
+        m.Tail.Items = new Lwe.LweMsg_Sample[] {new Lwe.LweMsg_Sample(), new Lwe.LweMsg_Sample()};
+        m.Tail.Items[0].Ts = 4;
+        m.Tail.Items[0].Value = -2;
+        m.Tail.Items[1].Ts = 5;
+        m.Tail.Items[1].Value = 1;
+        ByteBuffer buf = ByteBuffer.allocate(64);
+        m.encode(buf);
+        byte[] b = Arrays.copyOf(buf.array(), buf.position());
+        byte[] want = {9, 0, 0, 0, 3, 0, 0, 0, 4, (byte) 0xff, (byte) 0xfe, 0, 0, 0, 5, 0, 1};
+        check(Arrays.equals(b, want), "encode " + Arrays.toString(b));
+        Lwe.LweMsg_Frame d = new Lwe.LweMsg_Frame();
+        d.decode(ByteBuffer.wrap(b));
+        check(d.Kind == 9 && d.Tail.DevId == 3 && d.Tail.Items.length == 2 && d.Tail.Items[0].Value == -2 && d.Tail.Items[1].Ts == 5, "decode");
+
+        Lwe.LweMsg_LogUpload log = new Lwe.LweMsg_LogUpload();
+        log.DevId = 1;
+        log.Seq = 2;
+        log.Data = new byte[] {(byte) 0xaa, (byte) 0xbb, (byte) 0xcc};
+        buf.clear();
+        log.encode(buf);
+        byte[] lb = Arrays.copyOf(buf.array(), buf.position());
+        check(Arrays.equals(lb, new byte[] {0, 0, 0, 1, 0, 2, (byte) 0xaa, (byte) 0xbb, (byte) 0xcc}), "encode log " + Arrays.toString(lb));
+        Lwe.LweMsg_LogUpload dlog = new Lwe.LweMsg_LogUpload();
+        dlog.decode(ByteBuffer.wrap(lb));
+        check(Arrays.equals(dlog.Data, log.Data), "decode log");
+        dlog.decode(ByteBuffer.wrap(lb, 0, 6));
+        check(dlog.Data.length == 0, "decode no data");
+
+        //a trailing partial element is short
+        Lwe.LweMsg_Levels levels = new Lwe.LweMsg_Levels();
+        levels.Levels = new int[] {0x0102, 0x0304};
+        buf.clear();
+        levels.encode(buf);
+        byte[] vb = Arrays.copyOf(buf.array(), buf.position());
+        check(Arrays.equals(vb, new byte[] {2, 1, 4, 3}), "encode levels " + Arrays.toString(vb));
+        Lwe.LweMsg_Levels dlevels = new Lwe.LweMsg_Levels();
+        dlevels.decode(ByteBuffer.wrap(vb));
+        check(Arrays.equals(dlevels.Levels, levels.Levels), "decode levels");
+        expectError(() -> new Lwe.LweMsg_Levels().decode(ByteBuffer.wrap(vb, 0, 3)), "partial level");
+`)
+}
+
+func TestInterpGoString(t *testing.T) {
+	//strings are cut on a rune boundary to their limit, cstrings end by a NUL within max, fixed strings are padded
+	body, _ := ioutil.ReadFile("../data/string.proto")
+	goBehave(t, string(body), `import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	m := &LweMsg_DevInfo{DevId: 1, Name: "h\u00e9llo", Model: "m1", Serial: "ab"}
+	want := []byte("\x00\x00\x00\x00\x01\x06h\xc3\xa9llom1\x00ab      ")
+	b, err := Encode(m)
+	if err != nil || !bytes.Equal(b, want) || m.NameLen != 6 {
+		t.Fatalf("encode %q %v, want %q", b, err, want)
+	}
+
+	v, n, err := Decode("LweMsg_DevInfo", b)
+	if err != nil || n != len(b) || *v.(*LweMsg_DevInfo) != *m {
+		t.Fatalf("decode %+v %d %v, want %+v", v, n, err, m)
+	}
+
+	m = &LweMsg_DevInfo{Name: strings.Repeat("\u00e9", 9), Model: "model-1234567", Serial: "serial-12"}
+	m.SetTag("xy")
+	want = []byte("\x01\x00\x00\x00\x00\x10" + strings.Repeat("\u00e9", 8) + "model-123456\x00serial-1xy\x00\x00\x00\x00\x00\x00")
+	if b, err := Encode(m); err != nil || !bytes.Equal(b, want) {
+		t.Fatalf("encode %q %v, want %q", b, err, want)
+	}
+
+	for _, c := range []struct {
+		b      []byte
+		field  string
+		off    int
+		reason string
+	}{
+		{[]byte("\x00\x00\x00\x00\x01\x02\xff\xfem1\x00ab      "), "Name", 6, "utf8"},
+		{[]byte("\x00\x00\x00\x00\x01\x00model-1234567\x00ab      "), "Model", 6, "max"},
+		{[]byte("\x00\x00\x00\x00\x01\x00model"), "Model", 6, "short"},
+		{[]byte("\x00\x00\x00\x00\x01\x00m1\x00ab"), "Serial", 9, "short"},
+	} {
+		_, _, err := Decode("LweMsg_DevInfo", c.b)
+		if de, ok := err.(*DecodeError); !ok || de.Field != c.field || de.Offset != c.off || de.Reason != c.reason {
+			t.Errorf("decode %q error %v, want %s of %s at %d", c.b, err, c.reason, c.field, c.off)
+		}
+	}
+}
+`)
+}
+
+func TestInterpString(t *testing.T) {
+	//optional is go only, so Tag is a fixed string padded by zeros
+	body, _ := ioutil.ReadFile("../data/string.proto")
+	backendRoundTrip(t, strings.Replace(string(body), " optional", "", 1), `
+int main(void) {
+    static const uint8_t want[] = {0, 0, 0, 1, 6, 'h', 0xc3, 0xa9, 'l', 'l', 'o', 'm', '1', 0, 'a', 'b', ' ', ' ', ' ', ' ', ' ', ' ', 'x', 'y', 0, 0, 0, 0, 0, 0};
+    static const uint8_t bad[] = {0, 0, 0, 1, 2, 0xff, 0xfe, 'm', '1', 0, 'a', 'b', ' ', ' ', ' ', ' ', ' ', ' ', 'x', 'y', 0, 0, 0, 0, 0, 0};
+    static const uint8_t nonul[] = {0, 0, 0, 1, 0, 'm', 'o', 'd', 'e', 'l', '-', '1', '2', '3', '4', '5', '6', '7', 0};
+    uint8_t data[64];
+    byte_buf buf;
+    LweMsg_DevInfo m = {1, 0, "h\xc3\xa9llo", "m1", "ab", "xy"}, d;
+
+    byte_buf_init(&buf, data, sizeof(data));
+    CHECK(encode_LweMsg_DevInfo(&buf, &m) == 0 && m.NameLen == 6 && buf.pos == sizeof(want) && memcmp(data, want, sizeof(want)) == 0);
+    byte_buf_init(&buf, data, sizeof(want));
+    CHECK(decode_LweMsg_DevInfo(&buf, &d) == 0 && buf.pos == sizeof(want) && d.NameLen == 6);
+    CHECK(strcmp(d.Name, m.Name) == 0 && strcmp(d.Model, "m1") == 0 && strcmp(d.Serial, "ab") == 0 && strcmp(d.Tag, "xy") == 0);
+
+    //a name filling its array without a NUL is cut on a rune boundary
+    memcpy(m.Name, "abcdefghijklmno\xc3\xa9", sizeof(m.Name));
+    strcpy(m.Model, "model-123456");
+    strcpy(m.Serial, "serial-1");
+    m.Tag[0] = 0;
+    byte_buf_init(&buf, data, sizeof(data));
+    CHECK(encode_LweMsg_DevInfo(&buf, &m) == 0 && m.NameLen == 15 && buf.pos == 49);
+    CHECK(data[4] == 15 && memcmp(data + 20, "model-123456", 13) == 0 && memcmp(data + 33, "serial-1\0\0\0\0\0\0\0\0", 16) == 0);
+
+    memcpy(data, bad, sizeof(bad));
+    byte_buf_init(&buf, data, sizeof(bad));
+    CHECK(decode_LweMsg_DevInfo(&buf, &d) < 0);
+    memcpy(data, nonul, sizeof(nonul));
+    byte_buf_init(&buf, data, sizeof(nonul));
+    CHECK(decode_LweMsg_DevInfo(&buf, &d) < 0);
+    byte_buf_init(&buf, data, 10);
+    CHECK(decode_LweMsg_DevInfo(&buf, &d) < 0);
+    return 0;
+}
+`, `
+m = LweMsg_DevInfo(1, 0, "h\u00e9llo", "m1", "ab", "xy")
+buf = bytearray()
+encode_LweMsg_DevInfo(buf, m)
+assert buf == b"\x00\x00\x00\x01\x06h\xc3\xa9llom1\x00ab      xy\x00\x00\x00\x00\x00\x00" and m.NameLen == 6, buf.hex()
+d = LweMsg_DevInfo()
+assert decode_LweMsg_DevInfo(bytes(buf), 0, d) == len(buf) and d == m, d
+
+# strings over their size are cut on a rune boundary
+buf = bytearray()
+encode_LweMsg_DevInfo(buf, LweMsg_DevInfo(Name="\u00e9" * 9, Model="model-1234567", Serial="serial-12"))
+assert buf == b"\x00\x00\x00\x00\x10" + "\u00e9".encode() * 8 + b"model-123456\x00serial-1" + bytes(8), buf.hex()
+
+expect_error(decode_LweMsg_DevInfo, b"\x00\x00\x00\x01\x02\xff\xfem1\x00ab      xy\x00\x00\x00\x00\x00\x00", 0, LweMsg_DevInfo())
+expect_error(decode_LweMsg_DevInfo, b"\x00\x00\x00\x01\x00model-1234567\x00", 0, LweMsg_DevInfo())
+expect_error(decode_LweMsg_DevInfo, b"\x00\x00\x00\x01\x00model", 0, LweMsg_DevInfo())
+`, `
+const bytesOf = (s: string) => Uint8Array.from(s, (c) => c.charCodeAt(0));
+const m: LweMsg_DevInfo = { DevId: 1, NameLen: 0, Name: "h\u00e9llo", Model: "m1", Serial: "ab", Tag: "xy" };
+let w = new ByteWriter();
+encode_LweMsg_DevInfo(w, m);
+const b = w.bytes();
+check(b.join() === bytesOf("\x00\x00\x00\x01\x06h\xc3\xa9llom1\x00ab      xy\x00\x00\x00\x00\x00\x00").join() && m.NameLen === 6, "encode " + b);
+const r = new ByteReader(b);
+const d = new_LweMsg_DevInfo();
+decode_LweMsg_DevInfo(r, d);
+check(r.pos === b.length && JSON.stringify(d) === JSON.stringify(m), "decode " + JSON.stringify(d));
+
+//strings over their size are cut on a rune boundary
+w = new ByteWriter();
+encode_LweMsg_DevInfo(w, { ...new_LweMsg_DevInfo(), Name: "\u00e9".repeat(9), Model: "model-1234567", Serial: "serial-12" });
+const cb = w.bytes();
+check(cb.join() === bytesOf("\x00\x00\x00\x00\x10" + "\xc3\xa9".repeat(8) + "model-123456\x00serial-1" + "\x00".repeat(8)).join(), "encode cut " + cb);
+
+expectError(() => decode_LweMsg_DevInfo(new ByteReader(bytesOf("\x00\x00\x00\x01\x02\xff\xfem1\x00ab      xy\x00\x00\x00\x00\x00\x00")), new_LweMsg_DevInfo()), "utf8");
+expectError(() => decode_LweMsg_DevInfo(new ByteReader(bytesOf("\x00\x00\x00\x01\x00model-1234567\x00")), new_LweMsg_DevInfo()), "no NUL");
+expectError(() => decode_LweMsg_DevInfo(new ByteReader(bytesOf("\x00\x00\x00\x01\x00model")), new_LweMsg_DevInfo()), "short");
+`, `
+fn main() {
+    let m = LweMsg_DevInfo { DevId: 1, NameLen: 6, Name: "h\u{e9}llo".to_string(), Model: "m1".to_string(), Serial: "ab".to_string(), Tag: "xy".to_string() };
+    let mut buf = Vec::new();
+    m.encode(&mut buf);
+    assert_eq!(buf, b"\x00\x00\x00\x01\x06h\xc3\xa9llom1\x00ab      xy\x00\x00\x00\x00\x00\x00".to_vec());
+    assert_eq!(LweMsg_DevInfo::decode(&buf), Ok(m));
+
+    //strings over their size are cut on a rune boundary
+    let m = LweMsg_DevInfo { Name: "\u{e9}".repeat(9), Model: "model-1234567".to_string(), Serial: "serial-12".to_string(), ..Default::default() };
+    let mut buf = Vec::new();
+    m.encode(&mut buf);
+    let mut want = b"\x00\x00\x00\x00\x10".to_vec();
+    want.extend_from_slice("\u{e9}".repeat(8).as_bytes());
+    want.extend_from_slice(b"model-123456\x00serial-1\x00\x00\x00\x00\x00\x00\x00\x00");
+    assert_eq!(buf, want);
+
+    let check = |b: &[u8], field: &'static str, reason: &'static str| {
+        assert_eq!(LweMsg_DevInfo::decode(b), Err(Error::Check { msg: "LweMsg_DevInfo", field, reason }));
+    };
+    check(b"\x00\x00\x00\x01\x02\xff\xfem1\x00ab      xy\x00\x00\x00\x00\x00\x00", "Name", "utf8");
+    check(b"\x00\x00\x00\x01\x00model-1234567\x00", "Model", "max");
+    assert_eq!(LweMsg_DevInfo::decode(b"\x00\x00\x00\x01\x00model"), Err(Error::Short { need: 6, offset: 5 }));
+}
+`, `
+        Lwe.LweMsg_DevInfo m = new Lwe.LweMsg_DevInfo();
+        m.DevId = 1;
+        m.Name = "h\u00e9llo";
+        m.Model = "m1";
+        m.Serial = "ab";
+        m.Tag = "xy";
+        ByteBuffer buf = ByteBuffer.allocate(64);
+        m.encode(buf);
+        byte[] b = Arrays.copyOf(buf.array(), buf.position());
+        byte[] want = "\u0000\u0000\u0000\u0001\u0006h\u00c3\u00a9llom1\u0000ab      xy\u0000\u0000\u0000\u0000\u0000\u0000".getBytes(java.nio.charset.StandardCharsets.ISO_8859_1);
+        check(Arrays.equals(b, want) && m.NameLen == 6, "encode " + Arrays.toString(b));
+        Lwe.LweMsg_DevInfo d = new Lwe.LweMsg_DevInfo();
+        d.decode(ByteBuffer.wrap(b));
+        check(d.NameLen == 6 && d.Name.equals(m.Name) && d.Model.equals("m1") && d.Serial.equals("ab") && d.Tag.equals("xy"), "decode");
+
+        //strings over their size are cut on a rune boundary
+        m = new Lwe.LweMsg_DevInfo();
+        m.Name = "\u00e9\u00e9\u00e9\u00e9\u00e9\u00e9\u00e9\u00e9\u00e9";
+        m.Model = "model-1234567";
+        m.Serial = "serial-12";
+        buf.clear();
+        m.encode(buf);
+        check(m.NameLen == 16 && buf.position() == 4 + 1 + 16 + 13 + 8 + 8 && buf.get(21) == 'm' && buf.get(33) == 0 && buf.get(34) == 's', "encode cut");
+
+        expectError(() -> new Lwe.LweMsg_DevInfo().decode(ByteBuffer.wrap(new byte[] {0, 0, 0, 1, 2, (byte) 0xff, (byte) 0xfe, 'm', '1', 0,
+            'a', 'b', ' ', ' ', ' ', ' ', ' ', ' ', 'x', 'y', 0, 0, 0, 0, 0, 0})), "utf8");
+        expectError(() -> new Lwe.LweMsg_DevInfo().decode(ByteBuffer.wrap("\u0000\u0000\u0000\u0001\u0000model-1234567\u0000".getBytes(java.nio.charset.StandardCharsets.ISO_8859_1))), "no NUL");
+        expectError(() -> new Lwe.LweMsg_DevInfo().decode(ByteBuffer.wrap("\u0000\u0000\u0000\u0001\u0000model".getBytes(java.nio.charset.StandardCharsets.ISO_8859_1))), "short");
+`)
+}
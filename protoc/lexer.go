@@ -2,6 +2,7 @@ package protoc
 
 import (
 	"fmt"
+	"strings"
 	"unicode"
 
 	"github.com/pkg/errors"
@@ -11,6 +12,7 @@ import (
 const (
 	//const
 	INT_CONST    = "INT_CONST"
+	FLOAT_CONST  = "FLOAT_CONST"
 	STRING_CONST = "STRING_CONST"
 
 	//primitive type
@@ -23,11 +25,20 @@ const (
 	TYPE_U6     = "U6"
 	TYPE_U7     = "U7"
 	TYPE_U8     = "U8"
+	TYPE_UBITS  = "UBITS" //u9..u31 bit fields
 	TYPE_U16    = "U16"
 	TYPE_U32    = "U32"
 	TYPE_U64    = "U64"
 	TYPE_V32    = "V32"
 	TYPE_V64    = "V64"
+	TYPE_I8     = "I8"
+	TYPE_I16    = "I16"
+	TYPE_I32    = "I32"
+	TYPE_I64    = "I64"
+	TYPE_S32    = "S32"
+	TYPE_S64    = "S64"
+	TYPE_F32    = "F32"
+	TYPE_F64    = "F64"
 	TYPE_CHAR   = "CHAR"
 	TYPE_STRING = "STRING"
 	TYPE_ANY    = "ANY"
@@ -51,10 +62,24 @@ const (
 	//operator
 	LIMIT    = "LIMIT"
 	BY       = "BY"
+	SIZED    = "SIZED"
+	UNTIL    = "UNTIL"
+	END      = "END"
 	MAX      = "MAX"
+	MIN      = "MIN"
+	OF       = "OF"
+	STRICT   = "STRICT"
 	NEW      = "NEW"
 	DEFMSG   = "DEFMSG"
 	DEFID    = "DEFID"
+	DEFFLAGS = "DEFFLAGS"
+	SWITCH   = "SWITCH"
+	DEFAULT  = "DEFAULT"
+	OPTIONAL = "OPTIONAL"
+	CSTRING  = "CSTRING"
+	FIXED    = "FIXED"
+	SPACE    = "SPACE"
+	UTF8     = "UTF8"
 	SCOMMENT = "SCOMMENT"
 	DEFMID   = "DEFMID"
 	DEFBIND  = "DEFBIND"
@@ -64,6 +89,9 @@ const (
 	XOR    = "XOR"
 	MEND   = "MEND"
 	MSPACE = "MSPACE"
+	ENDIAN = "ENDIAN"
+	LE     = "LE"
+	BE     = "BE"
 
 	AND = "AND" //"&&"
 
@@ -143,14 +171,29 @@ var keywords = map[string]string{
 	"u64":    TYPE_U64,
 	"v32":    TYPE_V32,
 	"v64":    TYPE_V64,
+	"i8":     TYPE_I8,
+	"i16":    TYPE_I16,
+	"i32":    TYPE_I32,
+	"i64":    TYPE_I64,
+	"s32":    TYPE_S32, //zig-zag varint
+	"s64":    TYPE_S64,
+	"f32":    TYPE_F32, //IEEE-754
+	"f64":    TYPE_F64,
 	"defmsg": DEFMSG,
 	"defid":  DEFID,
 	"limit":  LIMIT,
 	"by":     BY,
+	"sized":  SIZED, //nested message prefixed by its byte length
+	"until":  UNTIL, //last array takes the rest of the message
+	"end":    END,
 	"max":    MAX,
+	"min":    MIN,
+	"of":     OF, //field values are ids of a group
 	"equal":  EQU,
 	"xor":    XOR,
 	"exist":  EXIST,
+	"follow": FOLLOW, //share exist if of the conditional field above
+	"above":  ABOVE,
 	"this":   THIS,
 	"extern": EXTERN,
 	"defmid": DEFMID,
@@ -158,6 +201,32 @@ var keywords = map[string]string{
 	"nil":    NIL,
 	"mend":   MEND, //mark message end, and do strict decode check
 	"mspace": MSPACE,
+	"endian": ENDIAN,
+	"le":     LE, //little endian field
+	"be":     BE, //big endian field
+
+	//bit positions of flags, strict field rejects undefined bits
+	"defflags": DEFFLAGS,
+	"strict":   STRICT,
+
+	//union field chosen by a tag field
+	"switch":  SWITCH,
+	"default": DEFAULT,
+
+	//field encoded only when present, flagged in a leading bitmap
+	"optional": OPTIONAL,
+
+	//string forms: NUL terminated, fixed size padded by zeros or spaces, UTF-8 checked on decode
+	"cstring": CSTRING,
+	"fixed":   FIXED,
+	"space":   SPACE,
+	"utf8":    UTF8,
+}
+
+func init() {
+	for name := range symTypeBits {
+		keywords[name] = TYPE_UBITS
+	}
 }
 
 type Token struct {
@@ -290,6 +359,36 @@ loop:
 	return string(numDigits)
 }
 
+//getFraction read the '.digits' and exponent part following the integer part of a float literal
+func (lex *hskLexer) getFraction() string {
+	if lex.curChar != '.' || !unicode.IsDigit(lex.peekChar(1)) {
+		return ""
+	}
+
+	frac := []rune{'.'}
+	lex.advance()
+	for unicode.IsDigit(lex.curChar) {
+		frac = append(frac, lex.curChar)
+		lex.advance()
+	}
+
+	if lex.curChar == 'e' || lex.curChar == 'E' {
+		frac = append(frac, 'e')
+		lex.advance()
+		if lex.curChar == '+' || lex.curChar == '-' {
+			frac = append(frac, lex.curChar)
+			lex.advance()
+		}
+
+		for unicode.IsDigit(lex.curChar) {
+			frac = append(frac, lex.curChar)
+			lex.advance()
+		}
+	}
+
+	return string(frac)
+}
+
 func (lex *hskLexer) escapedChar(escaped rune) rune {
 	switch escaped {
 	//case 'u':
@@ -391,6 +490,9 @@ func (lex *hskLexer) getNextToken() (tok *Token) {
 		line := lex.lineNo
 		if unicode.IsDigit(lex.curChar) {
 			val := lex.getInteger()
+			if frac := lex.getFraction(); frac != "" && !strings.HasPrefix(val, "0x") {
+				return &Token{type_: FLOAT_CONST, value: val + frac, line: line, column: col}
+			}
 			return &Token{type_: INT_CONST, value: val, line: line, column: col}
 		}
 
@@ -417,7 +519,6 @@ func (lex *hskLexer) getNextToken() (tok *Token) {
 				lex.advanceBy(2)
 				return token
 			}
-			token = &Token{DIV, string(lex.curChar), lex.lineNo, lex.colNo}
 			lex.advance()
 			return token
 
@@ -25,3 +25,13 @@ func TestLexer(t *testing.T) {
 		}
 	}
 }
+
+func TestLexerNumbers(t *testing.T) {
+	lex := newLexer("12 0x1f 1.5 2.5e-3 - 3.x")
+	want := []string{INT_CONST, INT_CONST, FLOAT_CONST, FLOAT_CONST, MINUS, INT_CONST, DOT, ID, EOF}
+	for _, tp := range want {
+		if token := lex.getNextToken(); token.type_ != tp {
+			t.Fatalf("want %s, got %v", tp, token)
+		}
+	}
+}
@@ -47,6 +47,14 @@ const (
 	symTypeU64    = "u64"
 	symTypeV32    = "v32"
 	symTypeV64    = "v64"
+	symTypeI8     = "i8"
+	symTypeI16    = "i16"
+	symTypeI32    = "i32"
+	symTypeI64    = "i64"
+	symTypeS32    = "s32"
+	symTypeS64    = "s64"
+	symTypeF32    = "f32"
+	symTypeF64    = "f64"
 	symTypeFloat  = "float"
 	symTypeString = "string"
 	symTypeArray  = "array"
@@ -187,6 +195,16 @@ func (p *hskParser) declarations() AstNode {
 			p.eat(ID)
 			program.mspace = p.prevToken.value
 			p.eatSeperator()
+		} else if p.curToken.type_ == ENDIAN {
+			//endian little|big, default byte order of multi-byte fields
+			p.eat(ENDIAN)
+			p.eat(ID)
+			if p.prevToken.value != "little" && p.prevToken.value != "big" {
+				p.panic("expect endian little or big, but recv: %s, line: %d", p.prevToken.value, p.prevToken.line)
+				return nil
+			}
+			program.endian = p.prevToken.value
+			p.eatSeperator()
 		} else if p.curToken.type_ == CONST {
 			ast := p.const_decl()
 			p.eatSeperator()
@@ -202,6 +220,10 @@ func (p *hskParser) declarations() AstNode {
 			ast := p.id_decl()
 			p.eatSeperator()
 			program.decl_list = append(program.decl_list, ast)
+		} else if p.curToken.type_ == DEFFLAGS {
+			ast := p.flags_decl()
+			p.eatSeperator()
+			program.decl_list = append(program.decl_list, ast)
 		} else if p.curToken.type_ == DEFMID {
 			ast := p.msgid_decl()
 			p.eatSeperator()
@@ -297,39 +319,7 @@ func (p *hskParser) id_decl() *AstIdGroupDef {
 	ast.name = p.curToken.value
 	ast.line = p.curToken.line
 	p.eat(ID)
-	p.eat(LBRACE)
-
-	for p.curToken.type_ == SCOMMENT {
-		p.eat(SCOMMENT)
-		ast.notes = append(ast.notes, &AstSrcComment{line: p.prevToken.line, value: p.prevToken.value})
-	}
-
-	if p.curToken.type_ == ID {
-		ast.items = append(ast.items, p.msgidItem_decl())
-		for {
-			if p.curToken.type_ == COMMA {
-				p.eat(COMMA)
-				if p.curToken.type_ == SCOMMENT {
-					p.eat(SCOMMENT)
-					ast.notes = append(ast.notes, &AstSrcComment{line: p.prevToken.line, value: p.prevToken.value})
-				} else if p.curToken.type_ == RBRACE {
-					break
-				}
-				ast.items = append(ast.items, p.msgidItem_decl())
-			} else if p.curToken.type_ == SCOMMENT {
-				p.eat(SCOMMENT)
-				ast.notes = append(ast.notes, &AstSrcComment{line: p.prevToken.line, value: p.prevToken.value})
-			} else {
-				break
-			}
-		}
-	}
-
-	for p.curToken.type_ == SCOMMENT {
-		p.eat(SCOMMENT)
-		ast.notes = append(ast.notes, &AstSrcComment{line: p.prevToken.line, value: p.prevToken.value})
-	}
-	p.eat(RBRACE)
+	ast.items, ast.notes = p.idList_decl()
 	return ast
 }
 
@@ -340,28 +330,36 @@ func (p *hskParser) msgid_decl() *AstIdGroupDef {
 	ast.name = p.curToken.value
 	ast.line = p.curToken.line
 	p.eat(ID)
+	ast.items, ast.notes = p.idList_decl()
+	return ast
+}
+
+//idList_decl: LBRACE (msgidItem_decl (COMMA msgidItem_decl)*)? RBRACE
+func (p *hskParser) idList_decl() ([]*idItem, []*AstSrcComment) {
+	var items []*idItem
+	var notes []*AstSrcComment
 	p.eat(LBRACE)
 
 	for p.curToken.type_ == SCOMMENT {
 		p.eat(SCOMMENT)
-		ast.notes = append(ast.notes, &AstSrcComment{line: p.prevToken.line, value: p.prevToken.value})
+		notes = append(notes, &AstSrcComment{line: p.prevToken.line, value: p.prevToken.value})
 	}
 
 	if p.curToken.type_ == ID {
-		ast.items = append(ast.items, p.msgidItem_decl())
+		items = append(items, p.msgidItem_decl())
 		for {
 			if p.curToken.type_ == COMMA {
 				p.eat(COMMA)
 				if p.curToken.type_ == SCOMMENT {
 					p.eat(SCOMMENT)
-					ast.notes = append(ast.notes, &AstSrcComment{line: p.prevToken.line, value: p.prevToken.value})
+					notes = append(notes, &AstSrcComment{line: p.prevToken.line, value: p.prevToken.value})
 				} else if p.curToken.type_ == RBRACE {
 					break
 				}
-				ast.items = append(ast.items, p.msgidItem_decl())
+				items = append(items, p.msgidItem_decl())
 			} else if p.curToken.type_ == SCOMMENT {
 				p.eat(SCOMMENT)
-				ast.notes = append(ast.notes, &AstSrcComment{line: p.prevToken.line, value: p.prevToken.value})
+				notes = append(notes, &AstSrcComment{line: p.prevToken.line, value: p.prevToken.value})
 			} else {
 				break
 			}
@@ -370,9 +368,34 @@ func (p *hskParser) msgid_decl() *AstIdGroupDef {
 
 	for p.curToken.type_ == SCOMMENT {
 		p.eat(SCOMMENT)
-		ast.notes = append(ast.notes, &AstSrcComment{line: p.prevToken.line, value: p.prevToken.value})
+		notes = append(notes, &AstSrcComment{line: p.prevToken.line, value: p.prevToken.value})
 	}
 	p.eat(RBRACE)
+	return items, notes
+}
+
+//DEFFLAGS ID type_spec LBRACE (msgidItem_decl (COMMA msgidItem_decl)*)? RBRACE, the item value is the bit position
+func (p *hskParser) flags_decl() *AstFlagsDef {
+	ast := &AstFlagsDef{}
+	p.eat(DEFFLAGS)
+	ast.name = p.curToken.value
+	ast.line = p.curToken.line
+	p.eat(ID)
+
+	base, ok := p.type_spec().(*AstPrimType)
+	if !ok {
+		p.panic("flags \"%s\" must be based on int type, line: %d", ast.name, ast.line)
+		return nil
+	}
+
+	ast.base = base
+	ast.items, ast.notes = p.idList_decl()
+	if _, ok := p.tpMap[ast.name]; ok {
+		p.panic("duplicate type define, name: %s, line: %d", ast.name, ast.line)
+		return nil
+	}
+
+	p.tpMap[ast.name] = &AstPrimType{name: base.name, flags: ast}
 	return ast
 }
 
@@ -393,6 +416,7 @@ func (p *hskParser) msgidItem_decl() *idItem {
 	return item
 }
 
+//msg_decl: DEFMSG ID LBRACE (field_decl | src_comment)* MEND? RBRACE
 func (p *hskParser) msg_decl() *AstStructType {
 	p.eat(DEFMSG)
 	p.eat(ID)
@@ -407,6 +431,11 @@ func (p *hskParser) msg_decl() *AstStructType {
 			note := &AstSrcComment{line: p.curToken.line, value: p.curToken.value}
 			p.eat(SCOMMENT)
 			ast.notes = append(ast.notes, note)
+		} else if ast.mend {
+			p.panic("mend must be the last of message \"%s\", line: %d", name, p.curToken.line)
+		} else if p.curToken.type_ == MEND {
+			p.eat(MEND)
+			ast.mend = true
 		} else {
 			ast.fields = append(ast.fields, p.field_decl())
 		}
@@ -426,11 +455,22 @@ func (p *hskParser) msg_decl() *AstStructType {
 	return ast
 }
 
-//field_decl: ID type_spec (limit by ID | max NICK_SIZE | equal ID)* src_comment
+//field_decl: ID (type_spec | union_spec) (of ID)? (limit by ID | sized by ID | until end | cstring | fixed ID space? | utf8 | max NICK_SIZE | min ID | equal ID | le | be | strict | optional | exist (if expr | follow above))* src_comment
 func (p *hskParser) field_decl() *AstVarDecl {
 	ast := &AstVarDecl{name: p.curToken.value, line: p.curToken.line}
 	p.eat(ID)
-	ast.type_ = p.type_spec()
+	if p.curToken.type_ == SWITCH {
+		ast.type_ = p.union_spec()
+	} else {
+		ast.type_ = p.type_spec()
+	}
+
+	if p.curToken.type_ == OF {
+		p.eat(OF)
+		token := p.curToken
+		p.eat(ID)
+		ast.enum = &AstVarNameRef{line: token.line, name: p.prevToken.value}
+	}
 
 	if p.curToken.type_ == DESC {
 		p.eat(DESC)
@@ -444,12 +484,48 @@ func (p *hskParser) field_decl() *AstVarDecl {
 				limAst := &AstVarNameRef{line: token.line, name: p.prevToken.value}
 				ast.limit = limAst
 				has = true
+			} else if p.curToken.type_ == SIZED {
+				p.eat(SIZED)
+				p.eat(BY)
+				token := p.curToken
+				p.eat(ID)
+				ast.sized = &AstVarNameRef{line: token.line, name: p.prevToken.value}
+				has = true
+			} else if p.curToken.type_ == CSTRING {
+				p.eat(CSTRING)
+				ast.cstring = true
+				has = true
+			} else if p.curToken.type_ == FIXED {
+				p.eat(FIXED)
+				token := p.curToken
+				p.eat(ID)
+				ast.fixed = &AstVarNameRef{line: token.line, name: p.prevToken.value}
+				if p.curToken.type_ == SPACE {
+					p.eat(SPACE)
+					ast.padSpace = true
+				}
+				has = true
+			} else if p.curToken.type_ == UTF8 {
+				p.eat(UTF8)
+				ast.utf8 = true
+				has = true
+			} else if p.curToken.type_ == UNTIL {
+				p.eat(UNTIL)
+				p.eat(END)
+				ast.untilEnd = true
+				has = true
 			} else if p.curToken.type_ == MAX {
 				p.eat(MAX)
 				token := p.curToken
 				p.eat(ID)
 				ast.max = &AstVarNameRef{line: token.line, name: p.prevToken.value}
 				has = true
+			} else if p.curToken.type_ == MIN {
+				p.eat(MIN)
+				token := p.curToken
+				p.eat(ID)
+				ast.min = &AstVarNameRef{line: token.line, name: p.prevToken.value}
+				has = true
 			} else if p.curToken.type_ == EQU {
 				p.eat(EQU)
 				token := p.curToken
@@ -462,7 +538,27 @@ func (p *hskParser) field_decl() *AstVarDecl {
 				p.eat(ID)
 				ast.xor = &AstVarNameRef{line: token.line, name: p.prevToken.value}
 				has = true
+			} else if p.curToken.type_ == STRICT {
+				p.eat(STRICT)
+				ast.strict = true
+				has = true
+			} else if p.curToken.type_ == OPTIONAL {
+				p.eat(OPTIONAL)
+				ast.optional = true
+				has = true
+			} else if p.curToken.type_ == LE || p.curToken.type_ == BE {
+				if ast.order != "" {
+					p.panic("byte order declared twice, field: %s, line: %d", ast.name, p.curToken.line)
+					return nil
+				}
+				ast.order = p.curToken.value
+				p.eat(p.curToken.type_)
+				has = true
 			} else if p.curToken.type_ == EXIST {
+				if ast.existIf != nil || ast.existCondFollow {
+					p.panic("exist declared twice, field: %s, line: %d", ast.name, p.curToken.line)
+					return nil
+				}
 				p.eat(EXIST)
 
 				if p.curToken.type_ == FOLLOW {
@@ -495,6 +591,49 @@ func (p *hskParser) field_decl() *AstVarDecl {
 	return ast
 }
 
+//union_spec: SWITCH ID LBRACE ((INT_CONST | ID | DEFAULT) COLON type_spec COMMA?)* RBRACE
+func (p *hskParser) union_spec() *AstUnionType {
+	ast := &AstUnionType{line: p.curToken.line}
+	p.eat(SWITCH)
+	p.eat(ID)
+	ast.tag = &AstVarNameRef{line: p.prevToken.line, name: p.prevToken.value}
+	p.eat(LBRACE)
+
+	for p.curToken.type_ != RBRACE {
+		if p.curToken.type_ == SCOMMENT || p.curToken.type_ == COMMA {
+			p.eat(p.curToken.type_)
+			continue
+		}
+
+		line := p.curToken.line
+		if p.curToken.type_ == DEFAULT {
+			p.eat(DEFAULT)
+			p.eat(COLON)
+			if ast.def != nil {
+				p.panic("default declared twice, switch: %s, line: %d", ast.tag.name, line)
+				return nil
+			}
+			ast.def = p.type_spec()
+			continue
+		}
+
+		c := &unionCase{line: line}
+		if p.curToken.type_ == INT_CONST {
+			p.eat(INT_CONST)
+			c.label = &AstIntConst{value: intConstVal(p.prevToken.value), line: line}
+		} else {
+			p.eat(ID)
+			c.label = &AstVarNameRef{line: line, name: p.prevToken.value}
+		}
+		p.eat(COLON)
+		c.type_ = p.type_spec()
+		ast.cases = append(ast.cases, c)
+	}
+
+	p.eat(RBRACE)
+	return ast
+}
+
 func (p *hskParser) type_spec() AstType {
 	//type_spec : INT | STRING |  ID | LBRACKET RBRACKET type_spec
 
@@ -528,6 +667,9 @@ func (p *hskParser) type_spec() AstType {
 	} else if p.curToken.type_ == TYPE_U7 {
 		p.eat(p.curToken.type_)
 		return p.tpMap[symTypeU7]
+	} else if p.curToken.type_ == TYPE_UBITS {
+		p.eat(TYPE_UBITS)
+		return p.tpMap[p.prevToken.value]
 	} else if p.curToken.type_ == TYPE_U8 {
 		p.eat(TYPE_U8)
 		return p.tpMap[symTypeU8]
@@ -549,6 +691,30 @@ func (p *hskParser) type_spec() AstType {
 	} else if p.curToken.type_ == TYPE_V64 {
 		p.eat(TYPE_V64)
 		return p.tpMap[symTypeV64]
+	} else if p.curToken.type_ == TYPE_I8 {
+		p.eat(TYPE_I8)
+		return p.tpMap[symTypeI8]
+	} else if p.curToken.type_ == TYPE_I16 {
+		p.eat(TYPE_I16)
+		return p.tpMap[symTypeI16]
+	} else if p.curToken.type_ == TYPE_I32 {
+		p.eat(TYPE_I32)
+		return p.tpMap[symTypeI32]
+	} else if p.curToken.type_ == TYPE_I64 {
+		p.eat(TYPE_I64)
+		return p.tpMap[symTypeI64]
+	} else if p.curToken.type_ == TYPE_S32 {
+		p.eat(TYPE_S32)
+		return p.tpMap[symTypeS32]
+	} else if p.curToken.type_ == TYPE_S64 {
+		p.eat(TYPE_S64)
+		return p.tpMap[symTypeS64]
+	} else if p.curToken.type_ == TYPE_F32 {
+		p.eat(TYPE_F32)
+		return p.tpMap[symTypeF32]
+	} else if p.curToken.type_ == TYPE_F64 {
+		p.eat(TYPE_F64)
+		return p.tpMap[symTypeF64]
 	} else if p.curToken.type_ == LBRACKET {
 		p.eat(LBRACKET)
 		p.eat(RBRACKET)
@@ -703,6 +869,10 @@ func (p *hskParser) factor() AstNode {
 		p.eat(INT_CONST)
 		ast := &AstIntConst{value: intConstVal(p.prevToken.value)}
 		return ast
+	} else if p.curToken.type_ == FLOAT_CONST {
+		p.eat(FLOAT_CONST)
+		ast := &AstFloatConst{value: floatConstVal(p.prevToken.value), line: p.prevToken.line}
+		return ast
 	} else if p.curToken.type_ == STRING_CONST {
 		p.eat(STRING_CONST)
 		ast := &AstStringConst{value: p.prevToken.value}
@@ -767,6 +937,12 @@ loop:
 	return ast
 }
 
+//isString check if a type is string, a text field of bytes
+func isString(tp AstType) bool {
+	pt, ok := realType(tp).(*AstPrimType)
+	return ok && pt.name == symTypeString
+}
+
 func isIntType(tp AstType) (bool, int) {
 	switch ft := tp.(type) {
 	case *AstPrimType:
@@ -792,21 +968,25 @@ func isIntType(tp AstType) (bool, int) {
 		case symTypeU7:
 			return true, 7
 
-		case symTypeU8:
+		case symTypeU8, symTypeI8:
 			return true, 8
 
 		case symTypeChar:
 			return true, 8
 
-		case symTypeU16:
+		case symTypeU16, symTypeI16:
 			return true, 16
 
-		case symTypeU32, symTypeV32:
+		case symTypeU32, symTypeV32, symTypeI32, symTypeS32:
 			return true, 32
 
-		case symTypeU64, symTypeV64:
+		case symTypeU64, symTypeV64, symTypeI64, symTypeS64:
 			return true, 64
 		}
+
+		if bn, ok := symTypeBits[ft.name]; ok {
+			return true, bn
+		}
 	}
 
 	return false, 0
@@ -816,7 +996,46 @@ func isVarInt(tp AstType) bool {
 	switch ft := tp.(type) {
 	case *AstPrimType:
 		switch ft.name {
-		case symTypeV32, symTypeV64:
+		case symTypeV32, symTypeV64, symTypeS32, symTypeS64:
+			return true
+		}
+	}
+
+	return false
+}
+
+//isFloatType check if a type is an IEEE-754 float, return the bits
+func isFloatType(tp AstType) (bool, int) {
+	switch ft := tp.(type) {
+	case *AstPrimType:
+		switch ft.name {
+		case symTypeF32:
+			return true, 32
+
+		case symTypeF64:
+			return true, 64
+		}
+	}
+
+	return false, 0
+}
+
+//primBits return the bits of an int or float type
+func primBits(tp AstType) int {
+	if ok, bn := isIntType(tp); ok {
+		return bn
+	}
+
+	_, bn := isFloatType(tp)
+	return bn
+}
+
+//isSigned check if an int type is signed, s32/s64 are zig-zag varints
+func isSigned(tp AstType) bool {
+	switch ft := tp.(type) {
+	case *AstPrimType:
+		switch ft.name {
+		case symTypeI8, symTypeI16, symTypeI32, symTypeI64, symTypeS32, symTypeS64:
 			return true
 		}
 	}
@@ -837,6 +1056,55 @@ var builtinTypeArr = []string{
 	symTypeU8, symTypeChar,
 	symTypeU16, symTypeU32, symTypeU64,
 	symTypeV32, symTypeV64,
+	symTypeI8, symTypeI16, symTypeI32, symTypeI64,
+	symTypeS32, symTypeS64,
+	symTypeF32, symTypeF64,
+}
+
+//symTypeBits hold the bit field types wider than a byte, u9..u31 except u16
+var symTypeBits = bitFieldTypes()
+
+func bitFieldTypes() map[string]int {
+	types := map[string]int{}
+	for bn := 9; bn < 32; bn++ {
+		if bn != 16 {
+			types[fmt.Sprintf("u%d", bn)] = bn
+		}
+	}
+
+	return types
+}
+
+func init() {
+	for bn := 9; bn < 32; bn++ {
+		if name := fmt.Sprintf("u%d", bn); symTypeBits[name] > 0 {
+			builtinTypeArr = append(builtinTypeArr, name)
+		}
+	}
+}
+
+//storageBits return the width of the smallest of 8/16/32/64 bits ints holding 'bits' bits
+func storageBits(bits int) int {
+	switch {
+	case bits <= 8:
+		return 8
+	case bits <= 16:
+		return 16
+	case bits <= 32:
+		return 32
+	}
+
+	return 64
+}
+
+//isBitWord check if a bit field series of 'bits' width closes one word
+func isBitWord(bits int) bool {
+	switch bits {
+	case 8, 16, 32, 64:
+		return true
+	}
+
+	return false
 }
 
 func NewParser(text string) *hskParser {
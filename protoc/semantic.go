@@ -2,6 +2,7 @@ package protoc
 
 import (
 	"fmt"
+	"math"
 	"reflect"
 	"runtime/debug"
 
@@ -124,6 +125,9 @@ type semanticAnalyzer struct {
 	debug          bool
 	brkStack       []bool
 	midMap         map[string]*idItem
+	littleEndian   bool
+	constMap       map[string]AstNode
+	groupMap       map[string]*AstIdGroupDef
 }
 
 func (p *semanticAnalyzer) pushBrk() {
@@ -159,6 +163,7 @@ func (se *semanticAnalyzer) visitProgram(program *AstProgram) {
 	if program.mspace == "" {
 		doPanic("mid space not specified")
 	}
+	se.littleEndian = program.endian == "little"
 
 	//just inflate symbol table with type symbol
 	for _, decl := range program.decl_list {
@@ -181,6 +186,12 @@ func (se *semanticAnalyzer) visitProgram(program *AstProgram) {
 			}
 			break
 
+		case *AstFlagsDef:
+			if se.firstPass {
+				se.visitFlagsDefine(node)
+			}
+			break
+
 		case *AstStructType:
 			if se.firstPass {
 				se.visitMsgDefine(node)
@@ -243,6 +254,32 @@ func (se *semanticAnalyzer) visitConstDef(node *AstConstDef) {
 	//ok
 	sym := newVarSymbol(node.name, tp, se.curSymbolTable.level, node.line)
 	se.curSymbolTable.insertSymbol(sym, se.debug)
+	se.constMap[node.name] = node.val
+}
+
+//constValue evaluate a const to compare bounds, ok is false if it is not a plain number
+func (se *semanticAnalyzer) constValue(ast AstNode) (float64, bool) {
+	switch node := ast.(type) {
+	case *AstIntConst:
+		return float64(node.value), true
+
+	case *AstFloatConst:
+		return node.value, true
+
+	case *AstUnaryOP:
+		val, ok := se.constValue(node.dst)
+		if node.op == MINUS {
+			return -val, ok
+		}
+		return val, ok && node.op == PLUS
+
+	case *AstVarNameRef:
+		if val, ok := se.constMap[node.name]; ok {
+			return se.constValue(val)
+		}
+	}
+
+	return 0, false
 }
 
 func (se *semanticAnalyzer) visitIdGroupDefine(node *AstIdGroupDef) {
@@ -261,6 +298,7 @@ func (se *semanticAnalyzer) visitIdGroupDefine(node *AstIdGroupDef) {
 	//ok
 	sym := newVarSymbol(node.name, tp, se.curSymbolTable.level, node.line)
 	se.curSymbolTable.insertSymbol(sym, se.debug)
+	se.groupMap[node.name] = node
 
 	val := 0
 	for i, id := range node.items {
@@ -283,6 +321,52 @@ func (se *semanticAnalyzer) visitIdGroupDefine(node *AstIdGroupDef) {
 	}
 }
 
+//visitFlagsDefine number the flag positions from 0 like ids, each flag name is an int symbol
+func (se *semanticAnalyzer) visitFlagsDefine(node *AstFlagsDef) {
+	if sym := se.curSymbolTable.lookup(node.name, false); sym != nil {
+		doPanic("error symbol defined in level: %d, name: %s, line: %d, type: %s, already exist: %s",
+			se.curSymbolTable.level, node.name, node.line, "AstFlagsDef", sym.symName())
+		return
+	}
+
+	ok, bn := isIntType(node.base)
+	if !ok || isSigned(node.base) || isVarInt(node.base) {
+		doPanic("flags \"%s\" must be based on fixed size unsigned int, line: %d", node.name, node.line)
+	}
+
+	if len(node.items) == 0 {
+		doPanic("flags \"%s\" has no flag, line: %d", node.name, node.line)
+	}
+
+	tp := &AstPrimType{name: symTypeInt}
+	sym := newVarSymbol(node.name, tp, se.curSymbolTable.level, node.line)
+	se.curSymbolTable.insertSymbol(sym, se.debug)
+
+	pos := -1
+	for i, id := range node.items {
+		if id.base {
+			if i > 0 && id.idVal <= pos {
+				doPanic("\"%s\": bit %d must be great than \"%s\" -> %d", id.name, id.idVal, node.items[i-1].name, pos)
+			}
+			pos = id.idVal
+		} else {
+			pos++
+			id.idVal = pos
+		}
+
+		if pos >= bn {
+			doPanic("\"%s\": bit %d not fit in flags \"%s\" of %d bits, line: %d", id.name, pos, node.name, bn, id.line)
+		}
+
+		if sym := se.curSymbolTable.lookup(id.name, false); sym != nil {
+			doPanic("error symbol defined in level: %d, name: %s, line: %d, type: %s, already exist: %s",
+				se.curSymbolTable.level, id.name, id.line, "flag", sym.symName())
+		}
+		sym := newVarSymbol(id.name, tp, se.curSymbolTable.level, id.line)
+		se.curSymbolTable.insertSymbol(sym, se.debug)
+	}
+}
+
 func (se *semanticAnalyzer) visitMsgDefine(node *AstStructType) {
 	if sym := se.curSymbolTable.lookup(node.name, false); sym != nil {
 		doPanic("error symbol defined in level: %d, name: %s, line: %d, type: %s, already exist: %s",
@@ -294,87 +378,572 @@ func (se *semanticAnalyzer) visitMsgDefine(node *AstStructType) {
 	sym := newVarSymbol(node.name, node, se.curSymbolTable.level, node.line)
 	se.curSymbolTable.insertSymbol(sym, se.debug)
 
-	visit := func(ast AstNode, name string) {
+	//float fields can be checked by float or int consts
+	visit := func(ast AstNode, name string, float bool) {
 		if ast == nil || reflect.ValueOf(ast).IsNil() {
 			return
 		}
 
-		if se.visitAst(ast).(AstType).signature() != "I" {
+		sig := se.visitAst(ast).(AstType).signature()
+		if float && sig == "F" {
+			return
+		}
+
+		if sig != "I" {
 			doPanic("visit msg define error, '%s' should be type int", name)
 			return
 		}
 	}
 
 	se.pushSymbolTable()
-	inAggr := false
+	var aggr *AstVarDecl
+	var cond AstNode //exist if of the last conditional field
 	bits := 0
+	node.optionals = nil
+	node.presence = nil
+	inRun := map[*AstVarDecl]bool{} //fields of bit fields words
 	for _, f := range node.fields {
 		xorOk := true
+		inAggr := aggr != nil
 		ok, bn := isIntType(f.type_)
 		if inAggr {
 			xorOk = false
-			if !ok {
-				doPanic("fields in aggregate, but follow filed: \"%s\" line: %d is not int", f.name, f.line)
+			if !ok || isVarInt(f.type_) || isSigned(f.type_) {
+				doPanic("fields in aggregate, but follow filed: \"%s\" line: %d is not unsigned int", f.name, f.line)
+			} else if f.order != "" {
+				doPanic("byte order only allowed on the first field of bit fields, field: \"%s\" line: %d", f.name, f.line)
 			} else {
 				bits += bn
-				if bits < 8 {
-					//go on
-				} else if bits == 8 {
+				if isBitWord(bits) {
+					se.resolveWordOrder(aggr, bits)
+					aggr = nil
 					bits = 0
-					inAggr = false
-				} else {
-					doPanic("fields in aggregate, but field series not fit in 8 bits boundary: \"%s\" line: %d", f.name, f.line)
+				} else if bits > 64 {
+					doPanic("fields in aggregate, but field series not fit in 8/16/32/64 bits boundary: \"%s\" line: %d", f.name, f.line)
 				}
 			}
 		} else if ok {
 			if bn%8 != 0 {
 				bits = bn
+				aggr = f
 				inAggr = true
 			}
 		} else {
 			//not int
 			xorOk = false
-			inAggr = false
-			bits = 0
 		}
+		inRun[f] = inAggr
 
 		se.visitAst(f)
-		if f.type_.astType() == AST_TP_Array {
+		elem := f.type_
+		if at, ok := elem.(*AstArrayType); ok {
+			elem = at.elemType
+		}
+
+		if st, ok := realType(elem).(*AstStructType); ok && st.mend {
+			doPanic("message \"%s\" marked mend can not be nested, field: \"%s\" line: %d", st.name, f.name, f.line)
+		}
+
+		if st, ok := realType(elem).(*AstStructType); ok && openEnded(st) {
+			if elem != f.type_ {
+				doPanic("message \"%s\" reading to the end can not be array element, field: \"%s\" line: %d", st.name, f.name, f.line)
+			} else if f.sized == nil && f != node.fields[len(node.fields)-1] {
+				doPanic("message \"%s\" reading to the end must be sized or the last field, field: \"%s\" line: %d", st.name, f.name, f.line)
+			}
+		}
+
+		if isString(elem) && elem != f.type_ {
+			doPanic("string can not be array element, field: \"%s\" line: %d", f.name, f.line)
+		}
+
+		if isString(f.type_) {
+			se.resolveString(node, f)
+		} else if f.cstring || f.fixed != nil || f.utf8 {
+			doPanic("cstring, fixed and utf8 only allowed on string field, field: \"%s\" line: %d", f.name, f.line)
+		}
+
+		if f.untilEnd {
+			se.resolveUntilEnd(node, f)
+		} else if f.type_.astType() == AST_TP_Array {
 			if f.limit == nil {
 				doPanic("\"%s\" must limited by one field or const, line: %d", f.name, f.line)
 				return
 			}
-		}
 
-		if f.existIf != nil {
-			if ok {
-				//do more check?
-				if !xorOk {
-					doPanic("not allow exist if in bit field, name: %s, line: %d", f.name, f.line)
+			if lf := getMsgField(node, f.limit.name); lf != nil && isSigned(lf.type_) {
+				doPanic("\"%s\" limited by signed field: \"%s\", line: %d", f.name, lf.name, f.line)
+			}
+
+			if lf := getMsgField(node, f.limit.name); lf != nil && lf.enum != nil {
+				doPanic("\"%s\" limited by id group field: \"%s\", line: %d", f.name, lf.name, f.line)
+			}
+
+			if lf := getMsgField(node, f.limit.name); lf != nil && flagsType(lf.type_) != nil {
+				doPanic("\"%s\" limited by flags field: \"%s\", line: %d", f.name, lf.name, f.line)
+			}
+
+			if lf := getMsgField(node, f.limit.name); lf != nil && lf.optional {
+				doPanic("\"%s\" limited by optional field: \"%s\", line: %d", f.name, lf.name, f.line)
+			}
+
+			//the limit field of an absent optional array is encoded as 0, which must not cut another array
+			if lf := getMsgField(node, f.limit.name); lf != nil && f.optional {
+				for _, of := range node.fields {
+					if of != f && of.limit != nil && of.limit.name == lf.name {
+						doPanic("limit field \"%s\" of optional array \"%s\" is also used by field \"%s\", line: %d", lf.name, f.name, of.name, f.line)
+					}
 				}
 			}
 		}
 
-		visit(f.equ, "equal")
-		visit(f.limit, "limit")
-		visit(f.max, "max")
-		visit(f.min, "min")
+		if f.existCondFollow {
+			if cond == nil {
+				doPanic("no conditional field above \"%s\" to follow, line: %d", f.name, f.line)
+			}
+			f.existIf = cond
+		} else if f.existIf != nil {
+			cond = f.existIf
+		}
+
+		if f.existIf != nil && inAggr {
+			doPanic("not allow exist if in bit field, name: %s, line: %d", f.name, f.line)
+		}
+
+		if f.optional {
+			if f.existIf != nil {
+				doPanic("optional and exist are exclusive, field: \"%s\" line: %d", f.name, f.line)
+			} else if inAggr {
+				doPanic("not allow optional in bit field, name: %s, line: %d", f.name, f.line)
+			}
+			node.optionals = append(node.optionals, f)
+		}
+
+		if !inAggr {
+			se.resolveByteOrder(f)
+		}
+
+		if f.enum != nil {
+			if flagsType(f.type_) != nil {
+				doPanic("flags field can not be of id group, field: \"%s\" line: %d", f.name, f.line)
+			}
+			se.resolveEnum(f)
+		}
+
+		if ut, ok := f.type_.(*AstUnionType); ok {
+			se.resolveUnion(node, f, ut)
+		}
+
+		if f.sized != nil {
+			se.resolveSized(node, f, inRun)
+		}
+
+		if f.strict && flagsType(f.type_) == nil {
+			doPanic("strict only allowed on flags field, field: \"%s\" line: %d", f.name, f.line)
+		}
+		float, _ := isFloatType(f.type_)
+		visit(f.equ, "equal", float)
+		visit(f.limit, "limit", false)
+		visit(f.max, "max", float)
+		visit(f.min, "min", float)
+		visit(f.fixed, "fixed", false)
+		se.resolveRange(f, f.max, "max")
+		se.resolveRange(f, f.min, "min")
+		if f.min != nil {
+			if inAggr || !(ok || float) {
+				doPanic("min only allowed on int or float fields out of bit fields, field: \"%s\" line: %d", f.name, f.line)
+			}
+
+			if f.max != nil {
+				min, minOk := se.constValue(f.min)
+				max, maxOk := se.constValue(f.max)
+				if minOk && maxOk && min > max {
+					doPanic("min %s greater than max %s, field: \"%s\" line: %d", f.min.name, f.max.name, f.name, f.line)
+				}
+			}
+		}
 		if f.xor != nil {
 			if isVarInt(f.type_) {
 				doPanic("var int and xor are exclusive, line: %d", f.line)
 			}
 
+			if isSigned(f.type_) {
+				doPanic("signed int and xor are exclusive, line: %d", f.line)
+			}
+
 			if xorOk {
-				visit(f.xor, "xor")
+				visit(f.xor, "xor", false)
 			} else {
 				doPanic("fields xor not in 8 bit boundary, field: \"%s\" line: %d", f.name, f.line)
 			}
 		}
 	}
 
+	if aggr != nil {
+		doPanic("bit fields from \"%s\" line: %d not closed in 8/16/32/64 bits boundary", aggr.name, aggr.line)
+	}
+
+	if n := len(node.optionals); n > 64 {
+		doPanic("message \"%s\" has %d optional fields, the presence bitmap holds at most 64, line: %d", node.name, n, node.line)
+	} else if n > 0 {
+		tp := symTypeV64
+		if n <= 8 {
+			tp = symTypeU8
+		} else if n <= 16 {
+			tp = symTypeU16
+		}
+		node.presence = &AstVarDecl{name: "present", type_: &AstPrimType{name: tp}, line: node.line}
+		node.presence.le = tp == symTypeU16 && se.littleEndian
+	}
+
 	se.popSymbolTable()
 }
 
+//resolveRange check a min or max const is representable by the int or float field, or the generated compare would not compile
+func (se *semanticAnalyzer) resolveRange(f *AstVarDecl, ref *AstVarNameRef, name string) {
+	if ref == nil {
+		return
+	}
+
+	val, ok := se.constValue(ref)
+	if !ok {
+		return
+	}
+
+	if isInt, bn := isIntType(f.type_); isInt {
+		lo, hi := 0.0, math.Exp2(float64(bn))-1
+		if isSigned(f.type_) {
+			lo, hi = -math.Exp2(float64(bn-1)), math.Exp2(float64(bn-1))-1
+		}
+
+		if val != math.Trunc(val) || val < lo || val > hi {
+			doPanic("%s %s = %v out of the range of field \"%s\" type %s, line: %d", name, ref.name, val, f.name, f.type_.desc(), f.line)
+		}
+	} else if float, bn := isFloatType(f.type_); float && bn == 32 && math.Abs(val) > math.MaxFloat32 {
+		doPanic("%s %s = %v out of the range of field \"%s\" type f32, line: %d", name, ref.name, val, f.name, f.line)
+	}
+}
+
+//resolveString check the length of a string field, by an unsigned int field above, a NUL within max or a fixed size
+func (se *semanticAnalyzer) resolveString(node *AstStructType, f *AstVarDecl) {
+	forms := 0
+	for _, has := range []bool{f.limit != nil, f.cstring, f.fixed != nil} {
+		if has {
+			forms++
+		}
+	}
+
+	if forms != 1 {
+		doPanic("string field must have exactly one of limit by, cstring or fixed, field: \"%s\" line: %d", f.name, f.line)
+	}
+
+	if f.cstring && f.max == nil {
+		doPanic("cstring field must declare its max length by max, field: \"%s\" line: %d", f.name, f.line)
+	} else if !f.cstring && f.max != nil {
+		doPanic("max only allowed on cstring among string fields, field: \"%s\" line: %d", f.name, f.line)
+	}
+
+	if f.min != nil || f.equ != nil || f.xor != nil || f.order != "" || f.enum != nil || f.strict {
+		doPanic("string field only allows its length, utf8, exist or optional, field: \"%s\" line: %d", f.name, f.line)
+	}
+
+	for _, ref := range []*AstVarNameRef{f.max, f.fixed} {
+		if ref == nil {
+			continue
+		}
+
+		if val, ok := se.constValue(ref); !ok || val < 1 {
+			doPanic("length \"%s\" of string \"%s\" must be a positive int const, line: %d", ref.name, f.name, f.line)
+		}
+	}
+
+	if f.limit == nil {
+		return
+	}
+
+	var lf *AstVarDecl
+	for _, of := range node.fields {
+		if of == f {
+			break
+		}
+
+		if of.name == f.limit.name {
+			lf = of
+		}
+	}
+
+	if lf == nil {
+		doPanic("limit field \"%s\" of string \"%s\" must be a field above it, line: %d", f.limit.name, f.name, f.line)
+	}
+
+	if ok, _ := isIntType(lf.type_); !ok || isSigned(lf.type_) || lf.enum != nil || flagsType(lf.type_) != nil || lf.min != nil ||
+		lf.existIf != nil || lf.existCondFollow || lf.optional {
+		doPanic("limit field \"%s\" of string \"%s\" must be a plain unsigned int, line: %d", lf.name, f.name, f.line)
+	}
+
+	for _, of := range node.fields {
+		used := of != f && of.limit != nil && of.limit.name == lf.name
+		used = used || (of.sized != nil && of.sized.name == lf.name)
+		if ut, ok := of.type_.(*AstUnionType); ok && ut.tag.name == lf.name {
+			used = true
+		}
+
+		if used {
+			doPanic("limit field \"%s\" of string \"%s\" is also used by field \"%s\", line: %d", lf.name, f.name, of.name, f.line)
+		}
+	}
+}
+
+//resolveUntilEnd check the array taking the rest of the message, it is the last field of fixed size elements or messages
+func (se *semanticAnalyzer) resolveUntilEnd(node *AstStructType, f *AstVarDecl) {
+	at, ok := f.type_.(*AstArrayType)
+	if !ok {
+		doPanic("until end only allowed on array field, field: \"%s\" line: %d", f.name, f.line)
+	}
+
+	if f != node.fields[len(node.fields)-1] {
+		doPanic("until end array must be the last field, field: \"%s\" line: %d", f.name, f.line)
+	}
+
+	if f.limit != nil || f.existIf != nil || f.existCondFollow || f.optional {
+		doPanic("until end array can not be limited, conditional or optional, field: \"%s\" line: %d", f.name, f.line)
+	}
+
+	switch et := realType(at.elemType).(type) {
+	case *AstPrimType:
+		if bn := primBits(et); bn == 0 || bn%8 != 0 || isVarInt(et) {
+			doPanic("until end array elements must be fixed size, field: \"%s\" line: %d", f.name, f.line)
+		}
+
+	case *AstStructType:
+		//messages are read one after another
+
+	default:
+		doPanic("until end array elements must be int, float or message, field: \"%s\" line: %d", f.name, f.line)
+	}
+}
+
+//openEnded check if a message reads to the end of its input, by an until end array or a []u8 union case at its end
+func openEnded(st *AstStructType) bool {
+	if len(st.fields) == 0 {
+		return false
+	}
+
+	f := st.fields[len(st.fields)-1]
+	switch ft := f.type_.(type) {
+	case *AstArrayType:
+		return f.untilEnd
+
+	case *AstUnionType:
+		for _, c := range ft.cases {
+			if c.type_.astType() == AST_TP_Array {
+				return true
+			}
+		}
+		return ft.def != nil && ft.def.astType() == AST_TP_Array
+	}
+
+	if nested, ok := realType(f.type_).(*AstStructType); ok && f.sized == nil {
+		return openEnded(nested)
+	}
+	return false
+}
+
+//resolveSized check the size field above a sized message field, a plain u8/u16/u32/u64 used for nothing else
+func (se *semanticAnalyzer) resolveSized(node *AstStructType, f *AstVarDecl, inRun map[*AstVarDecl]bool) {
+	if _, ok := realType(f.type_).(*AstStructType); !ok {
+		doPanic("sized by only allowed on message field, field: \"%s\" line: %d", f.name, f.line)
+	}
+
+	if f.existIf != nil || f.existCondFollow || f.optional {
+		doPanic("sized message field can not be conditional or optional, field: \"%s\" line: %d", f.name, f.line)
+	}
+
+	var sf *AstVarDecl
+	for _, lf := range node.fields {
+		if lf == f {
+			break
+		}
+
+		if lf.name == f.sized.name {
+			sf = lf
+		}
+	}
+
+	if sf == nil {
+		doPanic("size field \"%s\" of \"%s\" must be a field above it, line: %d", f.sized.name, f.name, f.line)
+	}
+
+	if ok, bn := isIntType(sf.type_); !ok || bn%8 != 0 || isVarInt(sf.type_) || isSigned(sf.type_) || inRun[sf] {
+		doPanic("size field \"%s\" of \"%s\" must be u8, u16, u32 or u64 out of bit fields, line: %d", sf.name, f.name, f.line)
+	}
+
+	if sf.enum != nil || flagsType(sf.type_) != nil || sf.max != nil || sf.min != nil || sf.equ != nil || sf.xor != nil ||
+		sf.existIf != nil || sf.existCondFollow || sf.optional {
+		doPanic("size field \"%s\" of \"%s\" only allows byte order, line: %d", sf.name, f.name, f.line)
+	}
+
+	for _, of := range node.fields {
+		used := of != f && of.sized != nil && of.sized.name == sf.name
+		used = used || (of.limit != nil && of.limit.name == sf.name)
+		if ut, ok := of.type_.(*AstUnionType); ok && ut.tag.name == sf.name {
+			used = true
+		}
+
+		if used {
+			doPanic("size field \"%s\" of \"%s\" is also used by field \"%s\", line: %d", sf.name, f.name, of.name, f.line)
+		}
+	}
+}
+
+//resolveUnion check the tag field above the union and resolve the case values, cases must not overlap
+func (se *semanticAnalyzer) resolveUnion(node *AstStructType, f *AstVarDecl, ut *AstUnionType) {
+	if f.limit != nil || f.max != nil || f.min != nil || f.equ != nil || f.xor != nil || f.order != "" || f.enum != nil || f.strict {
+		doPanic("union field only allows exist or optional, field: \"%s\" line: %d", f.name, f.line)
+	}
+
+	var tag *AstVarDecl
+	last := false
+	for i, lf := range node.fields {
+		if lf == f {
+			last = i == len(node.fields)-1
+			break
+		}
+
+		if lf.name == ut.tag.name {
+			tag = lf
+		}
+	}
+
+	if tag == nil {
+		doPanic("tag \"%s\" of union: \"%s\" must be a field above it, line: %d", ut.tag.name, f.name, f.line)
+	}
+
+	if tag.optional {
+		doPanic("tag \"%s\" of union: \"%s\" can not be optional, line: %d", tag.name, f.name, f.line)
+	}
+
+	isInt, bn := isIntType(tag.type_)
+	if !isInt || isSigned(tag.type_) {
+		doPanic("tag \"%s\" of union: \"%s\" must be unsigned int, line: %d", tag.name, f.name, f.line)
+	}
+
+	if len(ut.cases) == 0 {
+		doPanic("union \"%s\" has no case, line: %d", f.name, f.line)
+	}
+
+	//a byte array case takes the rest of the input
+	checkType := func(tp AstType, line int) {
+		if at, ok := tp.(*AstArrayType); ok && isByteArray(at) {
+			if !last {
+				doPanic("union \"%s\" with []u8 case must be the last field, line: %d", f.name, line)
+			}
+			return
+		}
+
+		st, ok := realType(tp).(*AstStructType)
+		if !ok {
+			doPanic("union \"%s\" case must be a message or []u8, line: %d", f.name, line)
+		}
+
+		if st.mend {
+			doPanic("message \"%s\" marked mend can not be a union case, field: \"%s\" line: %d", st.name, f.name, line)
+		}
+	}
+
+	seen := map[int]*unionCase{}
+	for _, c := range ut.cases {
+		switch label := c.label.(type) {
+		case *AstIntConst:
+			c.value = label.value
+
+		case *AstVarNameRef:
+			if id, ok := se.midMap[label.name]; ok {
+				c.value = id.idVal
+			} else if val, ok := se.constValue(label); ok && val == float64(int(val)) {
+				c.value = int(val)
+			} else {
+				doPanic("case \"%s\" of union: \"%s\" is not an int const or id, line: %d", label.name, f.name, c.line)
+			}
+		}
+
+		if c.value < 0 || (bn < 64 && uint64(c.value) >= uint64(1)<<uint(bn)) {
+			doPanic("case %d of union: \"%s\" not fit in tag \"%s\" of %d bits, line: %d", c.value, f.name, tag.name, bn, c.line)
+		}
+
+		if oc, ok := seen[c.value]; ok {
+			doPanic("case %d of union: \"%s\" overlaps the case at line: %d, line: %d", c.value, f.name, oc.line, c.line)
+		}
+		seen[c.value] = c
+		checkType(c.type_, c.line)
+	}
+
+	if ut.def != nil {
+		checkType(ut.def, ut.line)
+	}
+}
+
+//resolveEnum bind a field to the id group of its values, every id must fit in the field
+func (se *semanticAnalyzer) resolveEnum(f *AstVarDecl) {
+	group, ok := se.groupMap[f.enum.name]
+	if !ok {
+		doPanic("id group \"%s\" of field: \"%s\" not found, line: %d", f.enum.name, f.name, f.line)
+	}
+
+	isInt, bn := isIntType(f.type_)
+	if !isInt || isSigned(f.type_) {
+		doPanic("field of id group must be unsigned int, field: \"%s\" line: %d", f.name, f.line)
+	}
+
+	for _, id := range group.items {
+		if bn < 64 && uint64(id.idVal) >= uint64(1)<<uint(bn) {
+			doPanic("id \"%s\": %d not fit in field: \"%s\" of %d bits, line: %d", id.name, id.idVal, f.name, bn, f.line)
+		}
+	}
+
+	//one group is one go type, all its fields share the storage width
+	if bits := storageBits(bn); group.enumBits == 0 {
+		group.enumBits = bits
+	} else if group.enumBits != bits {
+		doPanic("id group \"%s\" used by fields of %d and %d bits storage, field: \"%s\" line: %d", group.name, group.enumBits, bits, f.name, f.line)
+	}
+	f.enumGroup = group
+}
+
+//resolveWordOrder apply the byte order of a bit field word to its first field, only words over 8 bits have one
+func (se *semanticAnalyzer) resolveWordOrder(f *AstVarDecl, bits int) {
+	if f.order != "" && bits == 8 {
+		doPanic("byte order '%s' only allowed on bit fields over 8 bits, field: \"%s\" line: %d", f.order, f.name, f.line)
+	}
+
+	f.le = bits > 8 && (f.order == "le" || (f.order == "" && se.littleEndian))
+}
+
+//resolveByteOrder apply field or mspace byte order, only fixed size ints over 8 bits and arrays of them have one
+func (se *semanticAnalyzer) resolveByteOrder(f *AstVarDecl) {
+	tp := f.type_
+	if at, ok := tp.(*AstArrayType); ok {
+		tp = at.elemType
+	}
+
+	ok, bn := isIntType(tp)
+	float, _ := isFloatType(tp)
+	multi := (ok && bn > 8 && !isVarInt(tp)) || float
+	if f.order != "" && !multi {
+		doPanic("byte order '%s' only allowed on multi-byte int or float fields, field: \"%s\" line: %d", f.order, f.name, f.line)
+	}
+
+	f.le = multi && (f.order == "le" || (f.order == "" && se.littleEndian))
+}
+
+//flagsType return the flags define of a field type, nil if it is not typed by defflags
+func flagsType(tp AstType) *AstFlagsDef {
+	if pt, ok := tp.(*AstPrimType); ok {
+		return pt.flags
+	}
+
+	return nil
+}
+
 func isAnyType(ast AstNode) bool {
 	if tp, ok := ast.(*AstPrimType); ok {
 		if tp.name == symTypeAny {
@@ -493,7 +1062,7 @@ func (se *semanticAnalyzer) visitBinOP(node *AstBinOP) interface{} {
 func (se *semanticAnalyzer) visitUnaryOP(node *AstUnaryOP) interface{} {
 	var rhs AstType
 	switch node.dst.(type) {
-	case *AstBinOP, *AstUnaryOP, *AstIntConst, *AstVarNameRef:
+	case *AstBinOP, *AstUnaryOP, *AstIntConst, *AstFloatConst, *AstVarNameRef:
 		rhs = se.visitAst(node.dst).(AstType)
 		break
 
@@ -508,6 +1077,10 @@ func (se *semanticAnalyzer) visitIntConst(node *AstIntConst) interface{} {
 	return &AstPrimType{name: symTypeInt}
 }
 
+func (se *semanticAnalyzer) visitFloatConst(node *AstFloatConst) interface{} {
+	return &AstPrimType{name: symTypeFloat}
+}
+
 func (se *semanticAnalyzer) visitStringConst(node *AstStringConst) interface{} {
 	return &AstPrimType{name: symTypeString}
 }
@@ -714,6 +1287,9 @@ func (se *semanticAnalyzer) visitAst(ast AstNode) interface{} {
 	case *AstIntConst:
 		return se.visitIntConst(statement)
 
+	case *AstFloatConst:
+		return se.visitFloatConst(statement)
+
 	case *AstVarNameRef:
 		return se.visitVarRef(statement)
 
@@ -740,6 +1316,8 @@ func NewSemanticAnalyzer() *semanticAnalyzer {
 	se.curSymbolTable = se.symbolStack[0]
 	se.brkStack = []bool{}
 	se.midMap = make(map[string]*idItem)
+	se.constMap = make(map[string]AstNode)
+	se.groupMap = make(map[string]*AstIdGroupDef)
 	se.firstPass = true
 	return se
 }
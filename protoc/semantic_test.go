@@ -21,3 +21,298 @@ func TestSemantic(t *testing.T) {
 		t.Errorf("analyze error: %v\n", err)
 	}
 }
+
+func TestSemanticByteOrder(t *testing.T) {
+	pro := NewParser("mspace lwe\nendian little\ndefmsg M {\n A u16\n B u32 -> be\n}\n").Program()
+	if err := NewSemanticAnalyzer().DoAnalyze(pro); err != nil {
+		t.Fatalf("analyze error: %v", err)
+	}
+
+	fields := pro.(*AstProgram).decl_list[0].(*AstStructType).fields
+	if !fields[0].le || fields[1].le {
+		t.Errorf("unexpected byte order, A: %v, B: %v", fields[0].le, fields[1].le)
+	}
+
+	pro = NewParser("mspace lwe\ndefmsg M {\n A u8 -> le\n}\n").Program()
+	if err := NewSemanticAnalyzer().DoAnalyze(pro); err == nil {
+		t.Errorf("byte order on u8 should fail")
+	}
+}
+
+func TestSemanticSigned(t *testing.T) {
+	for _, src := range []string{
+		"mspace lwe\nconst Key 1\ndefmsg M {\n A i32 -> xor Key\n}\n",
+		"mspace lwe\ndefmsg M {\n N i8\n A []u8 -> limit by N\n}\n",
+	} {
+		if err := NewSemanticAnalyzer().DoAnalyze(NewParser(src).Program()); err == nil {
+			t.Errorf("analyze should fail: %s", src)
+		}
+	}
+}
+
+func TestSemanticBitWord(t *testing.T) {
+	pro := NewParser("mspace lwe\nendian little\ndefmsg M {\n A u4\n B u4\n Seq u12\n Kind u4\n}\n").Program()
+	if err := NewSemanticAnalyzer().DoAnalyze(pro); err != nil {
+		t.Fatalf("analyze error: %v", err)
+	}
+
+	fields := pro.(*AstProgram).decl_list[0].(*AstStructType).fields
+	if fields[0].le || !fields[2].le {
+		t.Errorf("unexpected word byte order, A: %v, Seq: %v", fields[0].le, fields[2].le)
+	}
+
+	for _, src := range []string{
+		"mspace lwe\ndefmsg M {\n A u12\n B u12\n}\n",
+		"mspace lwe\ndefmsg M {\n A u31\n B u31\n C u31\n}\n",
+		"mspace lwe\ndefmsg M {\n A u4\n B i8\n C u4\n}\n",
+		"mspace lwe\ndefmsg M {\n A u12\n B u4 -> le\n}\n",
+		"mspace lwe\ndefmsg M {\n A u4 -> le\n B u4\n}\n",
+	} {
+		if err := NewSemanticAnalyzer().DoAnalyze(NewParser(src).Program()); err == nil {
+			t.Errorf("analyze should fail: %s", src)
+		}
+	}
+}
+
+func TestSemanticMin(t *testing.T) {
+	pro := NewParser("mspace lwe\nconst Lo -2.5\nconst Hi 10\ndefmsg M {\n A f32 -> min Lo max Hi\n}\n").Program()
+	if err := NewSemanticAnalyzer().DoAnalyze(pro); err != nil {
+		t.Fatalf("analyze error: %v", err)
+	}
+
+	pro = NewParser("mspace lwe\nconst Lo -128\nconst Hi 127\nconst Top 0xffff\ndefmsg M {\n A i8 -> min Lo max Hi\n B u16 -> max Top\n}\n").Program()
+	if err := NewSemanticAnalyzer().DoAnalyze(pro); err != nil {
+		t.Fatalf("analyze error: %v", err)
+	}
+
+	for _, src := range []string{
+		"mspace lwe\nconst Lo 8\nconst Hi 4\ndefmsg M {\n A u8 -> min Lo max Hi\n}\n",
+		"mspace lwe\nconst Lo 1\ndefmsg M {\n A u4 -> min Lo\n B u4\n}\n",
+		"mspace lwe\nconst Lo 1\ndefmsg M {\n N u8\n A []u8 -> limit by N min Lo\n}\n",
+		"mspace lwe\nconst Lo -5\ndefmsg M {\n A u8 -> min Lo\n}\n",
+		"mspace lwe\nconst Hi 256\ndefmsg M {\n A u8 -> max Hi\n}\n",
+		"mspace lwe\nconst Lo -129\ndefmsg M {\n A i8 -> min Lo\n}\n",
+		"mspace lwe\nconst Hi 16\ndefmsg M {\n A u4 -> max Hi\n B u4\n}\n",
+		"mspace lwe\nconst Hi 400000000000000000000000000000000000000.0\ndefmsg M {\n A f32 -> max Hi\n}\n",
+	} {
+		if err := NewSemanticAnalyzer().DoAnalyze(NewParser(src).Program()); err == nil {
+			t.Errorf("analyze should fail: %s", src)
+		}
+	}
+}
+
+func TestSemanticEnum(t *testing.T) {
+	pro := NewParser("mspace lwe\ndefid kind {\n A = 1,\n B = 0x10,\n}\ndefmsg M {\n K u8 of kind\n}\n").Program()
+	if err := NewSemanticAnalyzer().DoAnalyze(pro); err != nil {
+		t.Fatalf("analyze error: %v", err)
+	}
+
+	prog := pro.(*AstProgram)
+	group := prog.decl_list[0].(*AstIdGroupDef)
+	if f := prog.decl_list[1].(*AstStructType).fields[0]; f.enumGroup != group || group.enumBits != 8 {
+		t.Errorf("unexpected enum group: %v, bits: %d", f.enumGroup, group.enumBits)
+	}
+
+	for _, src := range []string{
+		"mspace lwe\ndefmsg M {\n K u8 of kind\n}\n",
+		"mspace lwe\ndefid kind {\n A = 1,\n B = 0x10,\n}\ndefmsg M {\n K u4 of kind\n R u4\n}\n",
+		"mspace lwe\ndefid kind {\n A = 1,\n}\ndefmsg M {\n K i8 of kind\n}\n",
+		"mspace lwe\ndefid kind {\n A = 1,\n}\ndefmsg M {\n K u8 of kind\n L u16 of kind\n}\n",
+		"mspace lwe\ndefid kind {\n A = 1,\n}\ndefmsg M {\n K u8 of kind\n D []u8 -> limit by K\n}\n",
+	} {
+		if err := NewSemanticAnalyzer().DoAnalyze(NewParser(src).Program()); err == nil {
+			t.Errorf("analyze should fail: %s", src)
+		}
+	}
+}
+
+func TestSemanticFlags(t *testing.T) {
+	pro := NewParser("mspace lwe\ndefflags opts u8 {\n A = 1,\n B,\n C = 7,\n}\ndefmsg M {\n O opts -> strict\n}\n").Program()
+	if err := NewSemanticAnalyzer().DoAnalyze(pro); err != nil {
+		t.Fatalf("analyze error: %v", err)
+	}
+
+	flags := pro.(*AstProgram).decl_list[0].(*AstFlagsDef)
+	if flags.items[0].idVal != 1 || flags.items[1].idVal != 2 || flags.items[2].idVal != 7 {
+		t.Errorf("unexpected flag bits: %d %d %d", flags.items[0].idVal, flags.items[1].idVal, flags.items[2].idVal)
+	}
+
+	for _, src := range []string{
+		"mspace lwe\ndefflags opts u4 {\n A = 4,\n}\n",
+		"mspace lwe\ndefflags opts i8 {\n A,\n}\n",
+		"mspace lwe\ndefflags opts v32 {\n A,\n}\n",
+		"mspace lwe\ndefflags opts u8 {\n A = 2,\n B = 1,\n}\n",
+		"mspace lwe\nconst A 1\ndefflags opts u8 {\n A,\n}\n",
+		"mspace lwe\ndefmsg M {\n O u8 -> strict\n}\n",
+		"mspace lwe\ndefid kind {\n K = 1,\n}\ndefflags opts u8 {\n A,\n}\ndefmsg M {\n O opts of kind\n}\n",
+	} {
+		if err := NewSemanticAnalyzer().DoAnalyze(NewParser(src).Program()); err == nil {
+			t.Errorf("analyze should fail: %s", src)
+		}
+	}
+}
+
+func TestSemanticMend(t *testing.T) {
+	pro := NewParser("mspace lwe\ndefmsg M {\n A u8\n mend //strict end\n}\n").Program()
+	if err := NewSemanticAnalyzer().DoAnalyze(pro); err != nil {
+		t.Fatalf("analyze error: %v", err)
+	}
+
+	if !pro.(*AstProgram).decl_list[0].(*AstStructType).mend {
+		t.Errorf("message should be marked mend")
+	}
+
+	src := "mspace lwe\ndefmsg M {\n A u8\n mend\n}\ndefmsg N {\n M M\n}\n"
+	if err := NewSemanticAnalyzer().DoAnalyze(NewParser(src).Program()); err == nil {
+		t.Errorf("analyze should fail: %s", src)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("field after mend should fail")
+			}
+		}()
+		NewParser("mspace lwe\ndefmsg M {\n mend\n A u8\n}\n").Program()
+	}()
+}
+
+func TestSemanticExistFollow(t *testing.T) {
+	pro := NewParser("mspace lwe\ndefmsg M {\n F u8\n A u8 -> exist if this.F == 1\n B u8\n C u8 -> exist follow above\n}\n").Program()
+	if err := NewSemanticAnalyzer().DoAnalyze(pro); err != nil {
+		t.Fatalf("analyze error: %v", err)
+	}
+
+	fields := pro.(*AstProgram).decl_list[0].(*AstStructType).fields
+	if fields[3].existIf != fields[1].existIf {
+		t.Errorf("field C should share exist if of field A")
+	}
+
+	for _, src := range []string{
+		"mspace lwe\ndefmsg M {\n F u8\n A u8 -> exist follow above\n}\n",
+		"mspace lwe\ndefmsg M {\n F u8\n A u8 -> exist if this.F == 1\n B u4 -> exist follow above\n C u4\n}\n",
+		"mspace lwe\ndefmsg M {\n F u8\n B u4 -> exist if this.F == 1\n C u4\n}\n",
+	} {
+		if err := NewSemanticAnalyzer().DoAnalyze(NewParser(src).Program()); err == nil {
+			t.Errorf("analyze should fail: %s", src)
+		}
+	}
+}
+
+func TestSemanticUnion(t *testing.T) {
+	msgs := "mspace lwe\ndefmsg A {\n X u8\n}\ndefmsg B {\n Y u16\n}\n"
+	pro := NewParser(msgs + "defmsg M {\n K u8\n Body switch K {\n 1: A,\n 2: B,\n default: []u8\n }\n}\n").Program()
+	if err := NewSemanticAnalyzer().DoAnalyze(pro); err != nil {
+		t.Fatalf("analyze error: %v", err)
+	}
+
+	for _, src := range []string{
+		msgs + "defmsg M {\n K u8\n Body switch K {\n 1: A,\n 1: B\n }\n}\n",
+		msgs + "defmsg M {\n Body switch K {\n 1: A\n }\n K u8\n}\n",
+		msgs + "defmsg M {\n K i8\n Body switch K {\n 1: A\n }\n}\n",
+		msgs + "defmsg M {\n K u2\n P u6\n Body switch K {\n 4: A\n }\n}\n",
+		msgs + "defmsg M {\n K u8\n Body switch K {\n 1: []u8\n }\n C u8\n}\n",
+		msgs + "defmsg M {\n K u8\n Body switch K {\n 1: u16\n }\n}\n",
+		msgs + "defmsg M {\n K u8\n Body switch K {\n }\n}\n",
+	} {
+		if err := NewSemanticAnalyzer().DoAnalyze(NewParser(src).Program()); err == nil {
+			t.Errorf("analyze should fail: %s", src)
+		}
+	}
+}
+
+func TestSemanticOptional(t *testing.T) {
+	src := "mspace lwe\ndefmsg M {\n"
+	for i := 0; i < 17; i++ {
+		src += fmt.Sprintf(" F%d u8 -> optional\n", i)
+	}
+	pro := NewParser(src + "}\n").Program()
+	if err := NewSemanticAnalyzer().DoAnalyze(pro); err != nil {
+		t.Fatalf("analyze error: %v", err)
+	}
+
+	node := pro.(*AstProgram).decl_list[0].(*AstStructType)
+	if len(node.optionals) != 17 || node.presence.type_.(*AstPrimType).name != symTypeV64 {
+		t.Errorf("17 optional fields should have a varint presence bitmap")
+	}
+
+	for _, src := range []string{
+		"mspace lwe\ndefmsg M {\n F u8\n A u8 -> optional exist if this.F == 1\n}\n",
+		"mspace lwe\ndefmsg M {\n A u4 -> optional\n B u4\n}\n",
+		"mspace lwe\ndefmsg M {\n N u8 -> optional\n A []u8 -> limit by N\n}\n",
+		"mspace lwe\ndefmsg A {\n X u8\n}\ndefmsg M {\n K u8 -> optional\n Body switch K {\n 1: A\n }\n}\n",
+		"mspace lwe\nconst C 4\ndefmsg M {\n N u8 -> max C\n A []u8 -> limit by N optional\n B []u8 -> limit by N\n}\n",
+		"mspace lwe\nconst C 4\ndefmsg M {\n N u8 -> max C\n A []u8 -> limit by N\n B []u8 -> limit by N optional\n}\n",
+	} {
+		if err := NewSemanticAnalyzer().DoAnalyze(NewParser(src).Program()); err == nil {
+			t.Errorf("analyze should fail: %s", src)
+		}
+	}
+}
+
+func TestSemanticSized(t *testing.T) {
+	msgs := "mspace lwe\ndefmsg A {\n X u8\n}\n"
+	pro := NewParser(msgs + "defmsg M {\n L u16 -> le\n P A -> sized by L\n}\n").Program()
+	if err := NewSemanticAnalyzer().DoAnalyze(pro); err != nil {
+		t.Fatalf("analyze error: %v", err)
+	}
+
+	for _, src := range []string{
+		msgs + "defmsg M {\n P A -> sized by L\n L u8\n}\n",
+		msgs + "defmsg M {\n L u8\n P []u8 -> limit by L sized by L\n}\n",
+		msgs + "defmsg M {\n L v32\n P A -> sized by L\n}\n",
+		msgs + "defmsg M {\n L u8 -> max L\n P A -> sized by L\n}\n",
+		msgs + "defmsg M {\n L u8\n P A -> sized by L\n Q A -> sized by L\n}\n",
+		msgs + "defmsg M {\n L u8\n P A -> sized by L optional\n}\n",
+		msgs + "defmsg M {\n L u4\n F u8\n G u4\n P A -> sized by F\n}\n",
+	} {
+		if err := NewSemanticAnalyzer().DoAnalyze(NewParser(src).Program()); err == nil {
+			t.Errorf("analyze should fail: %s", src)
+		}
+	}
+}
+
+func TestSemanticUntilEnd(t *testing.T) {
+	msgs := "mspace lwe\ndefmsg A {\n X u8\n D []u8 -> until end\n}\n"
+	pro := NewParser(msgs + "defmsg M {\n L u8\n P A -> sized by L\n T A\n}\n").Program()
+	if err := NewSemanticAnalyzer().DoAnalyze(pro); err != nil {
+		t.Fatalf("analyze error: %v", err)
+	}
+
+	for _, src := range []string{
+		"mspace lwe\ndefmsg M {\n D []u8 -> until end\n X u8\n}\n",
+		"mspace lwe\ndefmsg M {\n L u8\n D []u8 -> limit by L until end\n}\n",
+		"mspace lwe\ndefmsg M {\n X u8 -> until end\n}\n",
+		"mspace lwe\ndefmsg M {\n D []v32 -> until end\n}\n",
+		msgs + "defmsg M {\n T A\n X u8\n}\n",
+		msgs + "defmsg M {\n T []A -> until end\n}\n",
+	} {
+		if err := NewSemanticAnalyzer().DoAnalyze(NewParser(src).Program()); err == nil {
+			t.Errorf("analyze should fail: %s", src)
+		}
+	}
+}
+
+func TestSemanticString(t *testing.T) {
+	pro := NewParser("mspace lwe\nconst N 8\ndefmsg M {\n L u8\n S string -> limit by L utf8\n C string -> cstring max N\n F string -> fixed N space optional\n}\n").Program()
+	if err := NewSemanticAnalyzer().DoAnalyze(pro); err != nil {
+		t.Fatalf("analyze error: %v", err)
+	}
+
+	for _, src := range []string{
+		"mspace lwe\ndefmsg M {\n S string\n}\n",
+		"mspace lwe\nconst N 8\ndefmsg M {\n L u8\n S string -> limit by L fixed N\n}\n",
+		"mspace lwe\ndefmsg M {\n S string -> limit by L\n L u8\n}\n",
+		"mspace lwe\ndefmsg M {\n L i8\n S string -> limit by L\n}\n",
+		"mspace lwe\ndefmsg M {\n L u8\n S string -> limit by L\n D []u8 -> limit by L\n}\n",
+		"mspace lwe\ndefmsg M {\n S string -> cstring\n}\n",
+		"mspace lwe\nconst N 8\ndefmsg M {\n S string -> fixed N max N\n}\n",
+		"mspace lwe\nconst N 0\ndefmsg M {\n S string -> fixed N\n}\n",
+		"mspace lwe\nconst N 8\ndefmsg M {\n S []string -> limit by N\n}\n",
+		"mspace lwe\nconst N 8\ndefmsg M {\n D []u8 -> limit by N utf8\n}\n",
+	} {
+		if err := NewSemanticAnalyzer().DoAnalyze(NewParser(src).Program()); err == nil {
+			t.Errorf("analyze should fail: %s", src)
+		}
+	}
+}